@@ -0,0 +1,92 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+
+	gltr "github.com/gltr-sh/gltr/pkg"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+// codeCmd represents the code command
+var codeCmd = &cobra.Command{
+	Use:   "code",
+	Short: "Open a running task in VS Code",
+	Long: `Opens the project folder of a running task in VS Code using the Remote-SSH
+extension. The ssh config entry of the task is created or updated first, so
+this also works for tasks started on another machine or before the entry
+was removed. Extensions listed under customizations.vscode.extensions in
+gltr.yaml are installed in the workspace when it starts.`,
+	Args: cobra.NoArgs,
+	Run:  code,
+}
+
+func init() {
+	rootCmd.AddCommand(codeCmd)
+	addTaskSelectionFlags(codeCmd)
+}
+
+// ensureTaskHost makes sure that the project host entry in the gltr ssh
+// config points at the selected task
+func ensureTaskHost(t selectedTask) error {
+	config, err := readSSHConfig(gltrSSHConfigFile)
+	if err == nil {
+		definedHost := findHost(config, t.sshHostEntry())
+		if definedHost != nil && hostAnnotations(definedHost)[sshAnnotationTaskID] == t.endpoint.TaskID {
+			return nil
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	var host sshHost
+	switch t.platform {
+	case gltr.Docker:
+		host = sshHost{Hostname: "localhost", Port: t.port, TaskID: t.endpoint.TaskID}
+	case gltr.EcsFargate:
+		host = sshHostForEndpoint(t.endpoint, t.config.ProviderConfiguration, t.port)
+		host.ClusterName = t.gt.GetExecutionPlatformProjectConfig(gltr.EcsFargate).(gltr.EcsProjectConfig).ClusterName
+	default:
+		host = sshHostForEndpoint(t.endpoint, t.config.ProviderConfiguration, t.port)
+	}
+	host.Platform = t.platform.ToString()
+	host.User = t.sshUser()
+	return registerTaskHost(t.sshHostEntry(), host, gltr.HostKey{PublicKey: t.hostKey}, t.config.SSH)
+}
+
+func code(cmd *cobra.Command, args []string) {
+	t, err := selectTask(cmd)
+	if err != nil {
+		pterm.Error.Printf("Error finding task: %v\n", err)
+		os.Exit(1)
+	}
+
+	err = ensureTaskHost(t)
+	if err != nil {
+		pterm.Error.Printf("Error adding host to ssh config: %v\n", err)
+		os.Exit(1)
+	}
+	ensureSSHConfigInclude(getGltrConfigDir(), t.config)
+	if included, _ := sshConfigIncludesGltr(); !included {
+		pterm.Warning.Printf(
+			"VS Code only finds %v if remote.SSH.configFile is set to ~/.ssh/%v\n",
+			t.sshHostEntry(), gltrSSHConfigFile,
+		)
+	}
+
+	folder := fmt.Sprintf("/home/gltr/%v", t.gt.ProjectName)
+	pterm.Info.Printf("Opening %v:%v in VS Code\n", t.sshHostEntry(), folder)
+	codeCommand := exec.Command("code", "--remote", "ssh-remote+"+t.sshHostEntry(), folder)
+	codeCommand.Stdout = os.Stdout
+	codeCommand.Stderr = os.Stderr
+	err = codeCommand.Run()
+	if err != nil {
+		pterm.Error.Printf("Error running VS Code (is the code command on your PATH?): %v\n", err)
+		os.Exit(1)
+	}
+}
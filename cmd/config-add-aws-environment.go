@@ -0,0 +1,66 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"os"
+
+	gltr "github.com/gltr-sh/gltr/pkg"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+// configAddAWSEnvironmentCmd represents the config add-aws-environment command
+var configAddAWSEnvironmentCmd = &cobra.Command{
+	Use:   "add-aws-environment <name>",
+	Short: "Add a named AWS environment, eg another account or region",
+	Long: `Adds a named AWS environment to the gltr config. An environment selects the
+AWS account and region with an AWS cli profile, a region and optionally a
+role to assume; anything left out comes from the shared AWS config.
+
+Once added, the environment is set up like the default one by running
+commands with --aws-env, eg:
+
+  gltr init --aws --aws-env <name>
+  gltr config add-execution-platform --aws-env <name>`,
+	Args: cobra.ExactArgs(1),
+	Run:  configAddAWSEnvironment,
+}
+
+func init() {
+	configCmd.AddCommand(configAddAWSEnvironmentCmd)
+
+	configAddAWSEnvironmentCmd.Flags().String("profile", "", "AWS cli profile")
+	configAddAWSEnvironmentCmd.Flags().String("region", "", "AWS region")
+	configAddAWSEnvironmentCmd.Flags().String("role-arn", "", "ARN of a role to assume")
+}
+
+func configAddAWSEnvironment(cmd *cobra.Command, args []string) {
+	name := args[0]
+	var identity gltr.AWSConfig
+	identity.Profile, _ = cmd.Flags().GetString("profile")
+	identity.RegionName, _ = cmd.Flags().GetString("region")
+	identity.RoleArn, _ = cmd.Flags().GetString("role-arn")
+
+	gltrConfigDir := getGltrConfigDir()
+	config, err := readGltrConfig(gltrConfigDir)
+	if err != nil {
+		pterm.Error.Printf("Error reading gltr config: %v\n", err)
+		os.Exit(1)
+	}
+
+	err = config.ProviderConfiguration.AddAWSEnvironment(name, identity)
+	if err != nil {
+		pterm.Error.Printf("Error adding AWS environment: %v\n", err)
+		os.Exit(1)
+	}
+
+	err = writeGltrConfig(gltrConfigDir, config)
+	if err != nil {
+		pterm.Error.Printf("Error writing gltr config: %v\n", err)
+		os.Exit(1)
+	}
+	pterm.Success.Printf("AWS environment %v added\n", name)
+	pterm.Info.Printf("Set it up with: gltr init --aws --aws-env %v\n", name)
+}
@@ -0,0 +1,133 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"os"
+
+	gltr "github.com/gltr-sh/gltr/pkg"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+// configAddBastionCmd represents the config add-bastion command
+var configAddBastionCmd = &cobra.Command{
+	Use:   "add-bastion",
+	Short: "Launch a bastion for reaching workspaces in private subnets",
+	Long: `Launch a small gltr managed instance with a public IP address in a public
+subnet. Projects which use the bastion connection mode are reached by
+jumping through this instance (ssh ProxyJump), so their workspaces do not
+need public IP addresses.
+
+If the bastion already exists, its allowed CIDRs are updated instead.`,
+	Run: configAddBastion,
+}
+
+func init() {
+	configCmd.AddCommand(configAddBastionCmd)
+
+	configAddBastionCmd.Flags().String("key-name", "", "EC2 key pair used to log in to the bastion (default: the EC2 login key)")
+	configAddBastionCmd.Flags().StringSlice("cidr", nil, "CIDRs allowed to reach the bastion (default: this machine's public IP)")
+}
+
+func configAddBastion(cmd *cobra.Command, args []string) {
+	keyName, _ := cmd.Flags().GetString("key-name")
+	cidrs, _ := cmd.Flags().GetStringSlice("cidr")
+
+	gltrConfigDir := getGltrConfigDir()
+	gltrConfig, err := readGltrConfig(gltrConfigDir)
+	if err != nil {
+		pterm.Error.Printf("Error reading gltr config: %v\n", err)
+		os.Exit(1)
+	}
+
+	awsConfig := gltrConfig.ProviderConfiguration.AWS
+	if !awsConfig.Initialized {
+		pterm.Error.Printf("AWS is not initialized - run gltr init --aws first\n")
+		os.Exit(1)
+	}
+
+	allowedCIDRs, err := resolveAllowedCIDRs(cidrs)
+	if err != nil {
+		pterm.Error.Printf("Error determining allowed CIDRs: %v\n", err)
+		os.Exit(1)
+	}
+
+	// for an existing bastion, only the allowed CIDRs are refreshed
+	if awsConfig.Bastion.InstanceID != "" {
+		pterm.Info.Printf("Bastion already configured (id: %v, host: %v) - updating allowed CIDRs\n",
+			awsConfig.Bastion.InstanceID, awsConfig.Bastion.Host)
+		awsConfig.Bastion.AllowedCIDRs = allowedCIDRs
+		err = gltr.UpdateBastionIngress(awsConfig.Bastion)
+		if err != nil {
+			pterm.Error.Printf("Error updating bastion security group: %v\n", err)
+			os.Exit(1)
+		}
+		err = awsConfigSaver(gltrConfigDir, gltrConfig)(awsConfig)
+		if err != nil {
+			pterm.Error.Printf("Error writing gltr config: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if keyName == "" {
+		keyName = gltrConfig.Ec2KeyName()
+	}
+	if keyName == "" {
+		pterm.Error.Printf("No key pair specified - use --key-name or add the ec2 execution platform\n")
+		os.Exit(1)
+	}
+
+	bastion, err := gltr.CreateBastion(awsConfig, keyName, allowedCIDRs)
+	// record whatever was created so that remove-bastion can clean it up
+	awsConfig.Bastion = bastion
+	if saveErr := awsConfigSaver(gltrConfigDir, gltrConfig)(awsConfig); saveErr != nil {
+		pterm.Error.Printf("Error writing gltr config: %v\n", saveErr)
+		os.Exit(1)
+	}
+	if err != nil {
+		pterm.Error.Printf("Error creating bastion: %v\n", err)
+		os.Exit(1)
+	}
+	err = registerBastionHost(bastion, gltrConfig.SSH)
+	if err != nil {
+		pterm.Error.Printf("Error adding bastion to ssh config: %v\n", err)
+		os.Exit(1)
+	}
+	pterm.Success.Printf("Bastion available at %v@%v\n", bastion.User, bastion.Host)
+}
+
+// registerBastionHost adds the bastion to the gltr ssh config with its host
+// key pinned; workspaces in bastion mode use this entry as their ProxyJump
+func registerBastionHost(bastion gltr.AWSBastionConfig, settings gltr.SSHSettings) error {
+	hostKey, err := gltr.ParseHostPublicKey(bastion.HostKey)
+	if err != nil {
+		return err
+	}
+	err = recordHostKey(bastionSSHHostEntry, hostKey)
+	if err != nil {
+		return err
+	}
+	return addHostToSSHConfig(bastionSSHHostEntry, sshHost{
+		Hostname:            bastion.Host,
+		Port:                22,
+		User:                bastion.User,
+		ServerAliveInterval: settings.GetServerAliveInterval(),
+		HostKeyAlias:        bastionSSHHostEntry,
+		KnownHostsFile:      getKnownHostsPath(),
+		Platform:            bastionSSHPlatform,
+	})
+}
+
+// unregisterBastionHost removes the bastion from the gltr ssh config and
+// known_hosts file
+func unregisterBastionHost() error {
+	_, err := removeHostFromSSHConfig(bastionSSHHostEntry)
+	if err != nil {
+		return err
+	}
+	_, err = removeHostKey(bastionSSHHostEntry)
+	return err
+}
@@ -47,10 +47,10 @@ func configAddExecutionPlatform(cmd *cobra.Command, args []string) {
 		os.Exit(1)
 	}
 
+	// AWS platforms are configured per AWS environment
 	var configuredExecutionPlatforms []string
-	for _, e := range gltrConfig.ExecutionPlatforms {
-		platformName := e.Type.ToString()
-		configuredExecutionPlatforms = append(configuredExecutionPlatforms, platformName)
+	for _, p := range gltrConfig.ConfiguredExecutionPlatforms() {
+		configuredExecutionPlatforms = append(configuredExecutionPlatforms, p.ToString())
 	}
 
 	fmt.Printf("Execution platforms configured:\n")
@@ -96,7 +96,10 @@ func configAddExecutionPlatform(cmd *cobra.Command, args []string) {
 		fmt.Printf("Adding docker\n")
 		fmt.Printf("config: %v\n", dockerConfig)
 	case gltr.Ec2:
-		gltrConfig, err := gltr.ConfigAddEc2ExecutionPlatform(gltrConfig)
+		gltrConfig, err := gltr.ConfigAddEc2ExecutionPlatform(
+			gltrConfig,
+			awsConfigSaver(gltrConfigDir, gltrConfig),
+		)
 		if err != nil {
 			fmt.Printf("Error adding ec2 execution platform: %s\n", err)
 			os.Exit(1)
@@ -108,7 +111,10 @@ func configAddExecutionPlatform(cmd *cobra.Command, args []string) {
 		}
 		fmt.Printf("New gltr configuration written to file\n")
 	case gltr.EcsFargate:
-		gltrConfig, err := gltr.ConfigAddEcsFargateExecutionPlatform(gltrConfig)
+		gltrConfig, err := gltr.ConfigAddEcsFargateExecutionPlatform(
+			gltrConfig,
+			awsConfigSaver(gltrConfigDir, gltrConfig),
+		)
 		if err != nil {
 			fmt.Printf("Error adding ecs fargate execution platform: %s\n", err)
 			os.Exit(1)
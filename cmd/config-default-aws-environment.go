@@ -0,0 +1,66 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"os"
+	"strings"
+
+	gltr "github.com/gltr-sh/gltr/pkg"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+// configDefaultAWSEnvironmentCmd represents the config default-aws-environment command
+var configDefaultAWSEnvironmentCmd = &cobra.Command{
+	Use:   "default-aws-environment [name]",
+	Short: "Show or select the AWS environment used when none is given",
+	Long: `Shows the configured AWS environments or selects the one used by projects
+which do not name an AWS environment and by commands run without --aws-env.
+The environment in provider_configuration.aws is called "default".`,
+	Args: cobra.MaximumNArgs(1),
+	Run:  configDefaultAWSEnvironment,
+}
+
+func init() {
+	configCmd.AddCommand(configDefaultAWSEnvironmentCmd)
+}
+
+func configDefaultAWSEnvironment(cmd *cobra.Command, args []string) {
+	gltrConfigDir := getGltrConfigDir()
+	config, err := readGltrConfig(gltrConfigDir)
+	if err != nil {
+		pterm.Error.Printf("Error reading gltr config: %v\n", err)
+		os.Exit(1)
+	}
+	providerConfig := &config.ProviderConfiguration
+
+	if len(args) == 0 {
+		defaultAWSEnvironment := providerConfig.DefaultAWSEnvironment
+		if defaultAWSEnvironment == "" {
+			defaultAWSEnvironment = gltr.DefaultAWSEnvironment
+		}
+		pterm.Info.Printf("AWS environments: %v\n", strings.Join(providerConfig.AWSEnvironmentNames(), ", "))
+		pterm.Info.Printf("Default AWS environment: %v\n", defaultAWSEnvironment)
+		return
+	}
+
+	name := args[0]
+	if name != gltr.DefaultAWSEnvironment {
+		if err := providerConfig.UseAWSEnvironment(name); err != nil {
+			pterm.Error.Printf("Error selecting AWS environment: %v\n", err)
+			os.Exit(1)
+		}
+		providerConfig.DefaultAWSEnvironment = name
+	} else {
+		providerConfig.DefaultAWSEnvironment = ""
+	}
+
+	err = writeGltrConfig(gltrConfigDir, config)
+	if err != nil {
+		pterm.Error.Printf("Error writing gltr config: %v\n", err)
+		os.Exit(1)
+	}
+	pterm.Success.Printf("Default AWS environment set to %v\n", name)
+}
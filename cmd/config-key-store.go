@@ -0,0 +1,120 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"errors"
+	"os"
+
+	"github.com/gltr-sh/gltr/pkg/keystore"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+// configKeyStoreCmd represents the config key-store command
+var configKeyStoreCmd = &cobra.Command{
+	Use:   "key-store [file | passphrase-file | keyring | vault]",
+	Short: "Show or select where project private keys are kept",
+	Long: `Shows or selects the store for the private keys of projects:
+
+  file             unencrypted files in ~/.gltr/secrets (the default)
+  passphrase-file  files in ~/.gltr/secrets encrypted with a passphrase, which
+                   is asked for or taken from GLTR_KEY_PASSPHRASE
+  keyring          the OS keyring; the Secret Service on Linux
+  vault            a HashiCorp Vault KV version 2 secrets engine; the token is
+                   taken from VAULT_TOKEN or ~/.vault-token
+
+The keys of existing projects are moved to the selected store. Public keys
+stay in ~/.gltr/secrets whichever store is used.`,
+	Args:      cobra.MaximumNArgs(1),
+	ValidArgs: keystore.Types,
+	Run:       configKeyStore,
+}
+
+func init() {
+	configCmd.AddCommand(configKeyStoreCmd)
+
+	configKeyStoreCmd.Flags().String("vault-address", "", "Address of the vault server (default VAULT_ADDR)")
+	configKeyStoreCmd.Flags().String("vault-mount", "", "Mount of the KV version 2 secrets engine (default secret)")
+	configKeyStoreCmd.Flags().String("vault-path", "", "Path of the keys in the secrets engine (default gltr/project-keys)")
+}
+
+func configKeyStore(cmd *cobra.Command, args []string) {
+	gltrConfigDir := getGltrConfigDir()
+	config, err := readGltrConfig(gltrConfigDir)
+	if err != nil {
+		pterm.Error.Printf("Error reading gltr config: %v\n", err)
+		os.Exit(1)
+	}
+
+	currentStore, err := newProjectKeyStore(config.KeyStore)
+	if err != nil {
+		pterm.Error.Printf("Error opening key store: %v\n", err)
+		os.Exit(1)
+	}
+	if len(args) == 0 {
+		pterm.Info.Printf("Project keys are kept in %v\n", currentStore)
+		return
+	}
+
+	settings := config.KeyStore
+	settings.Type = args[0]
+	if settings.Type == keystore.TypeVault {
+		if address, _ := cmd.Flags().GetString("vault-address"); address != "" {
+			settings.Vault.Address = address
+		}
+		if mount, _ := cmd.Flags().GetString("vault-mount"); mount != "" {
+			settings.Vault.Mount = mount
+		}
+		if vaultPath, _ := cmd.Flags().GetString("vault-path"); vaultPath != "" {
+			settings.Vault.Path = vaultPath
+		}
+	}
+	newStore, err := newProjectKeyStore(settings)
+	if err != nil {
+		pterm.Error.Printf("Error opening key store: %v\n", err)
+		os.Exit(1)
+	}
+
+	// the keys are copied before the config is changed and only removed
+	// from the old store once the config points to the new one
+	projectIDs, err := storedProjectIDs()
+	if err != nil {
+		pterm.Error.Printf("Error listing projects: %v\n", err)
+		os.Exit(1)
+	}
+	var moved []string
+	if newStore.String() != currentStore.String() {
+		for _, projectID := range projectIDs {
+			privateKey, err := currentStore.Get(projectID)
+			if errors.Is(err, keystore.ErrNotFound) {
+				continue
+			}
+			if err == nil {
+				err = newStore.Put(projectID, privateKey)
+			}
+			if err != nil {
+				pterm.Error.Printf("Error moving key of project %v: %v\n", projectID, err)
+				os.Exit(1)
+			}
+			moved = append(moved, projectID)
+		}
+	}
+
+	config.KeyStore = settings
+	err = writeGltrConfig(gltrConfigDir, config)
+	if err != nil {
+		pterm.Error.Printf("Error writing gltr config: %v\n", err)
+		os.Exit(1)
+	}
+	for _, projectID := range moved {
+		if err := currentStore.Delete(projectID); err != nil {
+			pterm.Warning.Printf("Key of project %v could not be removed from %v: %v\n", projectID, currentStore, err)
+		}
+	}
+	pterm.Success.Printf("Project keys are kept in %v\n", newStore)
+	if len(moved) > 0 {
+		pterm.Info.Printf("Moved the keys of %v projects from %v\n", len(moved), currentStore)
+	}
+}
@@ -0,0 +1,58 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"os"
+
+	gltr "github.com/gltr-sh/gltr/pkg"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+// configRemoveBastionCmd represents the config remove-bastion command
+var configRemoveBastionCmd = &cobra.Command{
+	Use:   "remove-bastion",
+	Short: "Terminate the bastion used to reach workspaces in private subnets",
+	Run:   configRemoveBastion,
+}
+
+func init() {
+	configCmd.AddCommand(configRemoveBastionCmd)
+}
+
+func configRemoveBastion(cmd *cobra.Command, args []string) {
+	gltrConfigDir := getGltrConfigDir()
+	gltrConfig, err := readGltrConfig(gltrConfigDir)
+	if err != nil {
+		pterm.Error.Printf("Error reading gltr config: %v\n", err)
+		os.Exit(1)
+	}
+
+	awsConfig := gltrConfig.ProviderConfiguration.AWS
+	if awsConfig.Bastion.InstanceID == "" && awsConfig.Bastion.SecurityGroupID == "" {
+		pterm.Info.Printf("No bastion configured - nothing to do\n")
+		return
+	}
+
+	err = gltr.RemoveBastion(awsConfig.Bastion)
+	if err != nil {
+		pterm.Error.Printf("Error removing bastion: %v\n", err)
+		os.Exit(1)
+	}
+
+	err = unregisterBastionHost()
+	if err != nil {
+		pterm.Error.Printf("Error removing bastion from ssh config: %v\n", err)
+		os.Exit(1)
+	}
+
+	awsConfig.Bastion = gltr.AWSBastionConfig{}
+	err = awsConfigSaver(gltrConfigDir, gltrConfig)(awsConfig)
+	if err != nil {
+		pterm.Error.Printf("Error writing gltr config: %v\n", err)
+		os.Exit(1)
+	}
+	pterm.Success.Printf("Bastion removed\n")
+}
@@ -0,0 +1,51 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"os"
+
+	gltr "github.com/gltr-sh/gltr/pkg"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+// execCmd represents the exec command
+var execCmd = &cobra.Command{
+	Use:   "exec [flags] -- command [args...]",
+	Short: "Run a command in a running task",
+	Long: `Runs a single command in a running task of the project and exits with the
+exit code of the command. As with ssh, the arguments are joined with spaces
+and interpreted by the shell in the task. Without --task-id the most
+recently started task is used.`,
+	Args: cobra.MinimumNArgs(1),
+	Run:  execCommand,
+}
+
+func init() {
+	rootCmd.AddCommand(execCmd)
+	addTaskSelectionFlags(execCmd)
+	execCmd.Flags().Bool("forward-agent", true, "Forward the ssh agent to the task")
+	execCmd.Flags().BoolP("tty", "t", false, "Allocate a pty for the command")
+}
+
+func execCommand(cmd *cobra.Command, args []string) {
+	forwardAgent, _ := cmd.Flags().GetBool("forward-agent")
+	tty, _ := cmd.Flags().GetBool("tty")
+
+	client, _, err := connectToTask(cmd)
+	if err != nil {
+		pterm.Error.Printf("Error connecting to task: %v\n", err)
+		os.Exit(1)
+	}
+	defer client.Close()
+
+	exitCode, err := gltr.RunSSHSession(client, args, forwardAgent, tty)
+	if err != nil {
+		pterm.Error.Printf("Error running command: %v\n", err)
+		os.Exit(1)
+	}
+	client.Close()
+	os.Exit(exitCode)
+}
@@ -64,9 +64,87 @@ func readGltrConfig(configDir string) (c gltr.Config, err error) {
 	}
 
 	c.ExecutionPlatforms = typedExecutionPlatformConfigs
+
+	// the AMIs which older versions of gltr init pinned for everyone are
+	// resolved per region instead; the change is saved the next time the
+	// config is written
+	c.ProviderConfiguration.UnpinLegacyDefaultAmis()
+
+	// AWS clients are created for the environment given with --aws-env or
+	// else the default environment of the config
+	if err == nil {
+		awsEnvironment := awsEnvironmentFlag
+		if awsEnvironment == "" {
+			awsEnvironment = c.ProviderConfiguration.DefaultAWSEnvironment
+		}
+		if err := c.ProviderConfiguration.UseAWSEnvironment(awsEnvironment); err != nil {
+			fmt.Printf("Error selecting AWS environment: %v\n", err)
+			os.Exit(1)
+		}
+	}
 	return
 }
 
+// useProjectAWSEnvironment switches to the AWS environment of the project
+// unless one was given with --aws-env, and selects the AWS execution
+// platform configs of the project for the active environment
+func useProjectAWSEnvironment(c *gltr.Config, gt *gltr.Task) error {
+	if awsEnvironmentFlag == "" && gt.AWSEnvironment != "" {
+		if err := c.ProviderConfiguration.UseAWSEnvironment(gt.AWSEnvironment); err != nil {
+			return err
+		}
+	}
+	gt.UseAWSEnvironment(c.ProviderConfiguration.ActiveAWSEnvironment())
+	return nil
+}
+
+// loadProjectAWSEnvironment selects the AWS environment of the project for
+// commands which otherwise only need the gltr file; without a gltr config the
+// default environment is used
+func loadProjectAWSEnvironment(gt *gltr.Task, platform gltr.ExecutionPlatformType) error {
+	config, _ := readGltrConfig(getGltrConfigDir())
+	if err := useProjectAWSEnvironment(&config, gt); err != nil {
+		return err
+	}
+	return checkProjectPlatformConfig(config, *gt, platform)
+}
+
+// forEachProjectAWSEnvironment calls f with the config and the project
+// switched to each AWS environment the project has execution platform
+// configs for, or only to the environment given with --aws-env
+func forEachProjectAWSEnvironment(c *gltr.Config, gt *gltr.Task, f func() error) error {
+	names := gt.AWSEnvironments()
+	if awsEnvironmentFlag != "" {
+		names = []string{awsEnvironmentFlag}
+	}
+	for _, name := range names {
+		if err := c.ProviderConfiguration.UseAWSEnvironment(name); err != nil {
+			return err
+		}
+		gt.UseAWSEnvironment(name)
+		if err := f(); err != nil {
+			return fmt.Errorf("AWS environment %v: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// checkProjectPlatformConfig returns an error if the project has no config
+// for an AWS execution platform in the active AWS environment
+func checkProjectPlatformConfig(c gltr.Config, gt gltr.Task, platform gltr.ExecutionPlatformType) error {
+	if platform != gltr.Ec2 && platform != gltr.EcsFargate {
+		return nil
+	}
+	if gt.GetExecutionPlatformProjectConfig(platform) != nil {
+		return nil
+	}
+	awsEnvironment := c.ProviderConfiguration.ActiveAWSEnvironment()
+	return fmt.Errorf(
+		"project %v has no %v config for AWS environment %v - run gltr project add-execution-platform --aws-env %v",
+		gt.ProjectName, platform.ToString(), awsEnvironment, awsEnvironment,
+	)
+}
+
 // we will allow this to be specified in an env var, but for now, we just
 // assume it's ~/.gltr
 func getGltrConfigDir() string {
@@ -83,6 +161,8 @@ func writeGltrConfig(gltrConfigDir string, c gltr.Config) error {
 		return err
 	}
 
+	// the active AWS environment is written back to its own entry
+	c.ProviderConfiguration = c.ProviderConfiguration.Persisted()
 	configFilePath := filepath.Join(gltrConfigDir, "config.yaml")
 	data, err := yaml.Marshal(c)
 	err = os.WriteFile(configFilePath, data, 0644)
@@ -165,3 +245,12 @@ func writeGltrFile(filename string, gt gltr.Task) (err error) {
 	err = os.WriteFile(filename, dat, 0644)
 	return
 }
+
+// awsConfigSaver returns a function which writes the gltr config with the
+// given AWS config; this allows progress to be saved during AWS setup
+func awsConfigSaver(gltrConfigDir string, c gltr.Config) func(gltr.AWSConfig) error {
+	return func(awsConfig gltr.AWSConfig) error {
+		c.ProviderConfiguration.AWS = awsConfig
+		return writeGltrConfig(gltrConfigDir, c)
+	}
+}
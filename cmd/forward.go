@@ -0,0 +1,93 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+
+	gltr "github.com/gltr-sh/gltr/pkg"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+)
+
+// forwardCmd represents the forward command
+var forwardCmd = &cobra.Command{
+	Use:   "forward",
+	Short: "Forward the project ports of a running task to local ports",
+	Long: `Tunnels each port of the project (except ssh) over ssh to a local port until
+interrupted. The same port number is used locally if it is free, otherwise
+a free port is chosen.`,
+	Args: cobra.NoArgs,
+	Run:  forward,
+}
+
+func init() {
+	rootCmd.AddCommand(forwardCmd)
+	addTaskSelectionFlags(forwardCmd)
+}
+
+// startForwards forwards the given ports of the task to local ports
+func startForwards(client *ssh.Client, ports []int) ([]*gltr.PortForward, error) {
+	var forwards []*gltr.PortForward
+	for _, p := range ports {
+		if p == 22 {
+			continue
+		}
+		f, err := gltr.ListenForward(p)
+		if err != nil {
+			closeForwards(forwards)
+			return nil, fmt.Errorf("error listening for port %v: %w", p, err)
+		}
+		go f.Serve(client)
+		forwards = append(forwards, f)
+	}
+	return forwards, nil
+}
+
+func closeForwards(forwards []*gltr.PortForward) {
+	for _, f := range forwards {
+		f.Close()
+	}
+}
+
+// waitForInterrupt blocks until ctrl-c is pressed
+func waitForInterrupt() {
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	<-interrupt
+	signal.Stop(interrupt)
+}
+
+func forward(cmd *cobra.Command, args []string) {
+	client, gt, err := connectToTask(cmd)
+	if err != nil {
+		pterm.Error.Printf("Error connecting to task: %v\n", err)
+		os.Exit(1)
+	}
+	defer client.Close()
+
+	forwards, err := startForwards(client, gt.Ports)
+	if err != nil {
+		pterm.Error.Printf("%v\n", err)
+		os.Exit(1)
+	}
+	if len(forwards) == 0 {
+		pterm.Info.Printf("Project has no ports to forward\n")
+		return
+	}
+	defer closeForwards(forwards)
+
+	tableData := pterm.TableData{
+		[]string{"Task Port", "Local Address"},
+	}
+	for _, f := range forwards {
+		tableData = append(tableData, []string{fmt.Sprint(f.RemotePort), fmt.Sprintf("localhost:%v", f.LocalPort)})
+	}
+	pterm.DefaultTable.WithHasHeader().WithData(tableData).Render()
+	pterm.Info.Printf("Forwarding - press ctrl-c to stop\n")
+	waitForInterrupt()
+}
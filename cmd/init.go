@@ -5,6 +5,7 @@ package cmd
 
 import (
 	"fmt"
+	"os"
 
 	gltr "github.com/gltr-sh/gltr/pkg"
 	"github.com/spf13/cobra"
@@ -24,6 +25,7 @@ func init() {
 	// FIXME
 	initCmd.Flags().Bool("aws", false, "Initialize AWS")
 	initCmd.Flags().Bool("azure", false, "Initialize Azure")
+	initCmd.Flags().Bool("repair", false, "Reconcile a partially created AWS environment (with --aws)")
 }
 
 // this function checks if there is a valid AWS configuration
@@ -43,8 +45,9 @@ func checkAWSConfig(c gltr.AWSConfig) bool {
 }
 
 func gltrInit(cmd *cobra.Command, args []string) {
-	// initializeAws, _ := cmd.Flags().GetBool("aws")
+	initializeAws, _ := cmd.Flags().GetBool("aws")
 	initializeAzure, _ := cmd.Flags().GetBool("azure")
+	repair, _ := cmd.Flags().GetBool("repair")
 
 	gltrConfigDir := getGltrConfigDir()
 	config, err := readGltrConfig(gltrConfigDir)
@@ -52,6 +55,29 @@ func gltrInit(cmd *cobra.Command, args []string) {
 		fmt.Printf("No existing configuration - creating new configuration...\n")
 	}
 
+	if repair && !initializeAws {
+		fmt.Printf("--repair is only supported with --aws\n")
+		os.Exit(1)
+	}
+
+	if initializeAws {
+		awsConfig := config.ProviderConfiguration.AWS
+		switch {
+		case awsConfig.Initialized && !repair:
+			fmt.Printf("AWS already initialized (vpc %v) - use --repair to reconcile\n", awsConfig.VpcID)
+		default:
+			// with repair set, everything is checked again from scratch
+			awsConfig.Initialized = false
+			awsConfig, err = gltr.InitializeAWS(awsConfig, awsConfigSaver(gltrConfigDir, config))
+			if err != nil {
+				fmt.Printf("Error initializing AWS: %v\n", err)
+				os.Exit(1)
+			}
+			config.ProviderConfiguration.AWS = awsConfig
+			fmt.Printf("AWS initialized\n")
+		}
+	}
+
 	if initializeAzure {
 		fmt.Printf("Azure not yet supported - unable to initialize.")
 	}
@@ -0,0 +1,112 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	gltr "github.com/gltr-sh/gltr/pkg"
+	"github.com/gltr-sh/gltr/pkg/secrets"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+// installSecretsCmd represents the install-secrets command; it runs in the
+// workspace container
+var installSecretsCmd = &cobra.Command{
+	Use:   "install-secrets",
+	Short: "Install the secrets declared in gltr.yaml in the workspace",
+	Long: `Decrypts the secrets declared in the secrets section of gltr.yaml with the
+project key and writes them to their files and to ~/.gltr/secrets.env, which
+login shells source. This is run by the workspace container when it starts.`,
+	Hidden: true,
+	Args:   cobra.NoArgs,
+	Run:    installSecrets,
+}
+
+func init() {
+	rootCmd.AddCommand(installSecretsCmd)
+
+	installSecretsCmd.Flags().String("dir", ".", "Directory of the repository clone")
+	installSecretsCmd.Flags().Duration("wait", 0, "How long to wait for the repository clone")
+}
+
+func installSecrets(cmd *cobra.Command, args []string) {
+	dir, _ := cmd.Flags().GetString("dir")
+	wait, _ := cmd.Flags().GetDuration("wait")
+
+	// the clone may still be in progress when this is run over ssh
+	gltrFilename := filepath.Join(dir, "gltr.yaml")
+	deadline := time.Now().Add(wait)
+	for {
+		if _, err := os.Stat(gltrFilename); err == nil || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(2 * time.Second)
+	}
+	gt, err := readGltrFile(gltrFilename)
+	if err != nil {
+		pterm.Info.Printf("No gltr.yaml in %v - no secrets to install\n", dir)
+		return
+	}
+	if len(gt.Secrets) == 0 {
+		return
+	}
+
+	// on EC2 the project key is installed after the container has started;
+	// the secrets are installed then
+	if _, err := readPrivateKey(gt.ProjectID); err != nil {
+		pterm.Info.Printf("Project key not installed yet - secrets are installed once it is\n")
+		return
+	}
+
+	if err := os.Chdir(dir); err != nil {
+		pterm.Error.Printf("Error changing to %v: %v\n", dir, err)
+		os.Exit(1)
+	}
+	if _, err := os.Stat(secrets.DefaultFileName); err != nil {
+		pterm.Error.Printf("No %v in %v - is it committed and pushed?\n", secrets.DefaultFileName, dir)
+		os.Exit(1)
+	}
+	projectSecrets, err := openProjectSecrets(gt)
+	if err != nil {
+		pterm.Error.Printf("Error opening %v: %v\n", secrets.DefaultFileName, err)
+		os.Exit(1)
+	}
+	err = gltr.InstallWorkspaceSecrets(gt, ".", os.Getenv("HOME"), projectSecrets.Get)
+	if err != nil {
+		pterm.Error.Printf("Error installing secrets: %v\n", err)
+		os.Exit(1)
+	}
+	pterm.Success.Printf("%v secrets installed\n", len(gt.Secrets))
+}
+
+// checkWorkspaceSecrets makes sure that the secrets declared in gltr.yaml are
+// in gltr-secrets.yaml before a workspace is launched
+func checkWorkspaceSecrets(gltrFilename string, gt gltr.Task) error {
+	if len(gt.Secrets) == 0 {
+		return nil
+	}
+	projectSecrets, err := openProjectSecrets(gt)
+	if err != nil {
+		return err
+	}
+	if err := gt.ValidateSecrets(projectSecrets.List()); err != nil {
+		return err
+	}
+
+	// the workspace reads both files from its clone of the repository
+	output, err := exec.Command("git", "status", "--porcelain", "--", gltrFilename, secrets.DefaultFileName).Output()
+	if err == nil && len(strings.TrimSpace(string(output))) > 0 {
+		pterm.Warning.Printf(
+			"%v or %v has uncommitted changes - the workspace uses the versions pushed to the repository\n",
+			gltrFilename, secrets.DefaultFileName,
+		)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+
+	gltr "github.com/gltr-sh/gltr/pkg"
+	"github.com/gltr-sh/gltr/pkg/keystore"
+	"golang.org/x/term"
+)
+
+// the key store is opened once per run, so that a passphrase is only asked
+// for once
+var openedProjectKeyStore keystore.Store
+
+// projectKeyStore returns the store for project private keys selected in the
+// gltr config; without a config the keys are kept in files
+func projectKeyStore() (keystore.Store, error) {
+	if openedProjectKeyStore != nil {
+		return openedProjectKeyStore, nil
+	}
+	config, err := readGltrConfig(getGltrConfigDir())
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("error reading gltr config: %w", err)
+	}
+	store, err := newProjectKeyStore(config.KeyStore)
+	if err != nil {
+		return nil, err
+	}
+	openedProjectKeyStore = store
+	return store, nil
+}
+
+// newProjectKeyStore returns the key store of the settings
+func newProjectKeyStore(settings gltr.KeyStoreSettings) (keystore.Store, error) {
+	return keystore.New(settings, path.Join(getGltrConfigDir(), "secrets"), readKeyStorePassphrase)
+}
+
+// readKeyStorePassphrase returns the passphrase of the passphrase-file key
+// store from GLTR_KEY_PASSPHRASE or asks for it on the terminal
+func readKeyStorePassphrase(confirm bool) ([]byte, error) {
+	if passphrase := os.Getenv("GLTR_KEY_PASSPHRASE"); passphrase != "" {
+		return []byte(passphrase), nil
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return nil, errors.New("no terminal to ask for the project key passphrase - set GLTR_KEY_PASSPHRASE")
+	}
+	fmt.Printf("Enter passphrase for project keys: ")
+	passphrase, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Println()
+	if err != nil || !confirm {
+		return passphrase, err
+	}
+	fmt.Printf("Enter the same passphrase again: ")
+	again, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Println()
+	if err != nil {
+		return nil, err
+	}
+	if string(again) != string(passphrase) {
+		return nil, errors.New("the passphrases do not match")
+	}
+	return passphrase, nil
+}
+
+// storedProjectIDs returns the IDs of the projects which have a key
+// directory; the public keys stay there whichever store holds the private
+// keys
+func storedProjectIDs() ([]string, error) {
+	entries, err := os.ReadDir(path.Join(getGltrConfigDir(), "secrets"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var projectIDs []string
+	for _, e := range entries {
+		if !e.IsDir() || filepath.Ext(e.Name()) == ".new" {
+			continue
+		}
+		projectIDs = append(projectIDs, e.Name())
+	}
+	return projectIDs, nil
+}
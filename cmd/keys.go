@@ -5,12 +5,14 @@ import (
 	"crypto/rand"
 	"crypto/x509"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
 	"path"
 
+	"github.com/gltr-sh/gltr/pkg/keystore"
 	"github.com/mikesmitty/edkey"
 
 	"golang.org/x/crypto/ssh"
@@ -73,9 +75,11 @@ func encodePrivateKeyToPEM(privateKey *ed25519.PrivateKey) []byte {
 // 	return publicKey, privateKey, nil
 // }
 
-// writePemToFile writes keys to a file
-func writeKeysToDirectory(
-	keyDirectory, projectID string,
+// writeProjectKeys stores the private key of the project in the key store
+// and writes the public key to the key directory of the project
+func writeProjectKeys(
+	store keystore.Store,
+	projectID string,
 	publicKey *ed25519.PublicKey,
 	privateKey *ed25519.PrivateKey,
 ) error {
@@ -89,48 +93,38 @@ func writeKeysToDirectory(
 	pemEncodedPrivateKey := pem.EncodeToMemory(pemKey)
 	authorizedKey := ssh.MarshalAuthorizedKey(sshPublicKey)
 
+	keyDirectory := path.Join(getGltrConfigDir(), "secrets", projectID)
 	err := os.MkdirAll(keyDirectory, 0700)
 	if err != nil {
-		fmt.Printf("Error creating directory for keys: %v\n", err)
-		os.Exit(1)
+		return fmt.Errorf("error creating directory for keys: %w", err)
 	}
 
-	privateKeyFilename := projectID
-	publicKeyFilename := projectID + ".pub"
-
-	privateKeyLongFilename := path.Join(keyDirectory, privateKeyFilename)
-
-	// _ = ioutil.WriteFile("id_ed25519", pemEncodedPrivateKey, 0600)
-	// _ = ioutil.WriteFile("id_ed25519.pub", authorizedKey, 0644)
-
-	err = ioutil.WriteFile(privateKeyLongFilename, pemEncodedPrivateKey, 0600)
+	err = store.Put(projectID, pemEncodedPrivateKey)
 	if err != nil {
-		fmt.Printf("Error writing private key to file: %v\n", err)
-		return err
+		return fmt.Errorf("error storing private key in %v: %w", store, err)
 	}
 
-	publicKeyLongFilename := path.Join(keyDirectory, publicKeyFilename)
+	publicKeyLongFilename := path.Join(keyDirectory, projectID+".pub")
 	err = ioutil.WriteFile(publicKeyLongFilename, authorizedKey, 0644)
 	if err != nil {
-		fmt.Printf("Error writing public key to file: %v\n", err)
-		return err
+		return fmt.Errorf("error writing public key to file: %w", err)
 	}
 
-	fmt.Printf("Keypair generated for project ID %v\n", projectID)
+	fmt.Printf("Keypair for project ID %v stored in %v\n", projectID, store)
 	return nil
 }
 
-// writePemToFile writes keys to a file
-func readPrivateKey(gltrConfigDir, projectID string) (privateKey []byte, err error) {
-	// private key is stored in config-dir/projectid/projectid
-	filename := path.Join(gltrConfigDir, "secrets", projectID, projectID)
-	keyBytes, err := ioutil.ReadFile(filename)
+// readPrivateKey returns the private key of the project from the key store
+func readPrivateKey(projectID string) (privateKey []byte, err error) {
+	store, err := projectKeyStore()
 	if err != nil {
 		return nil, err
 	}
-
-	// log.Printf("Public Key saved to: %s", saveFileTo)
-	return keyBytes, nil
+	privateKey, err = store.Get(projectID)
+	if errors.Is(err, keystore.ErrNotFound) {
+		return nil, fmt.Errorf("no key for project %v in %v", projectID, store)
+	}
+	return privateKey, err
 }
 
 // writePemToFile writes keys to a file
@@ -41,6 +41,12 @@ func killTask(cmd *cobra.Command, args []string) {
 		os.Exit(1)
 	}
 
+	err = loadProjectAWSEnvironment(&gt, gt.DefaultExecutionPlatform)
+	if err != nil {
+		log.Printf("Error selecting AWS environment: %v", err)
+		os.Exit(1)
+	}
+
 	switch gt.DefaultExecutionPlatform {
 	case gltr.Ec2:
 		gltr.KillTaskEc2(taskID)
@@ -60,4 +66,19 @@ func killTask(cmd *cobra.Command, args []string) {
 		pterm.Error.Printf("Unknown execution platform %v\n", gt.DefaultExecutionPlatform)
 		os.Exit(1)
 	}
+
+	removed, err := removeTaskFromSSHConfig(taskID)
+	if err != nil {
+		pterm.Error.Printf("Error removing task from ssh config: %v\n", err)
+		os.Exit(1)
+	}
+	for _, h := range removed {
+		pterm.Success.Printf("Host %v removed from ssh config\n", h)
+	}
+	// the task may no longer own a host entry but its key is still recorded
+	_, err = removeHostKey(taskHostKeyAlias(taskID))
+	if err != nil {
+		pterm.Error.Printf("Error removing host key of task: %v\n", err)
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	gltr "github.com/gltr-sh/gltr/pkg"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+var (
+	gltrKnownHostsFile = "known_hosts"
+)
+
+// getKnownHostsPath returns the known_hosts file which holds the host keys
+// gltr generated for its tasks; the ssh config entries point to this file
+func getKnownHostsPath() string {
+	return filepath.Join(getGltrConfigDir(), gltrKnownHostsFile)
+}
+
+// taskHostKeyAlias returns the alias under which the host key of a single
+// task is recorded; gltr ssh uses it to verify tasks which no longer own the
+// project host entry
+func taskHostKeyAlias(taskID string) string {
+	return fmt.Sprintf("gltr-task-%v", taskID)
+}
+
+// readKnownHostsExcept returns the lines of the gltr known_hosts file which
+// do not belong to the given host alias
+func readKnownHostsExcept(alias string) (lines []string, removed bool, err error) {
+	dat, err := os.ReadFile(getKnownHostsPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(dat))
+	for scanner.Scan() {
+		line := scanner.Text()
+		fields := strings.Fields(line)
+		if len(fields) > 0 && fields[0] == knownhosts.Normalize(alias) {
+			removed = true
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, removed, scanner.Err()
+}
+
+func writeKnownHosts(lines []string) error {
+	err := os.MkdirAll(getGltrConfigDir(), 0700)
+	if err != nil {
+		return err
+	}
+	content := ""
+	if len(lines) > 0 {
+		content = strings.Join(lines, "\n") + "\n"
+	}
+	return writeFileAtomic(getKnownHostsPath(), []byte(content), 0600)
+}
+
+// recordHostKey stores the host key for the alias in the gltr known_hosts
+// file, replacing any key previously recorded for it
+func recordHostKey(alias string, key ssh.PublicKey) error {
+	lines, _, err := readKnownHostsExcept(alias)
+	if err != nil {
+		return err
+	}
+	lines = append(lines, knownhosts.Line([]string{alias}, key))
+	return writeKnownHosts(lines)
+}
+
+// removeHostKey removes the host key recorded for the alias; it returns true
+// if a key was removed
+func removeHostKey(alias string) (bool, error) {
+	lines, removed, err := readKnownHostsExcept(alias)
+	if err != nil || !removed {
+		return false, err
+	}
+	return true, writeKnownHosts(lines)
+}
+
+// lookupHostKey returns the host key recorded for the alias
+func lookupHostKey(alias string) (ssh.PublicKey, error) {
+	dat, err := os.ReadFile(getKnownHostsPath())
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(dat))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) > 1 && fields[0] == knownhosts.Normalize(alias) {
+			return gltr.ParseHostPublicKey(strings.Join(fields[1:], " "))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("no host key recorded for %v", alias)
+}
@@ -65,6 +65,12 @@ func listTasks(cmd *cobra.Command, args []string) {
 		os.Exit(1)
 	}
 
+	err = loadProjectAWSEnvironment(&gt, gt.DefaultExecutionPlatform)
+	if err != nil {
+		pterm.Error.Printf("Error selecting AWS environment: %v\n", err)
+		os.Exit(1)
+	}
+
 	switch gt.DefaultExecutionPlatform {
 	case gltr.Ec2:
 		gltr.ListTasksEc2(gt.ProjectName)
@@ -0,0 +1,66 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"os"
+
+	gltr "github.com/gltr-sh/gltr/pkg"
+	"github.com/pkg/browser"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+// openCmd represents the open command
+var openCmd = &cobra.Command{
+	Use:   "open jupyter",
+	Short: "Open a service running in a task in the browser",
+	Long: `Forwards the jupyter port of a running task to a local port, looks up the
+jupyter token in the task and opens the authenticated URL in the browser.
+The tunnel stays open until interrupted.`,
+	ValidArgs: []string{"jupyter"},
+	Args:      cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
+	Run:       openService,
+}
+
+func init() {
+	rootCmd.AddCommand(openCmd)
+	addTaskSelectionFlags(openCmd)
+	openCmd.Flags().Bool("no-browser", false, "Only print the URL")
+}
+
+func openService(cmd *cobra.Command, args []string) {
+	noBrowser, _ := cmd.Flags().GetBool("no-browser")
+
+	client, _, err := connectToTask(cmd)
+	if err != nil {
+		pterm.Error.Printf("Error connecting to task: %v\n", err)
+		os.Exit(1)
+	}
+	defer client.Close()
+
+	forwards, err := startForwards(client, []int{gltr.JupyterPort})
+	if err != nil {
+		pterm.Error.Printf("%v\n", err)
+		os.Exit(1)
+	}
+	defer closeForwards(forwards)
+
+	spinner, _ := pterm.DefaultSpinner.Start("Waiting for jupyter...")
+	url, err := gltr.JupyterURL(client, forwards[0].LocalPort)
+	if err != nil {
+		spinner.Fail(err.Error())
+		os.Exit(1)
+	}
+	spinner.Success("Jupyter available at " + url)
+
+	if !noBrowser {
+		err = browser.OpenURL(url)
+		if err != nil {
+			pterm.Warning.Printf("Unable to open browser: %v\n", err)
+		}
+	}
+	pterm.Info.Printf("Forwarding - press ctrl-c to stop\n")
+	waitForInterrupt()
+}
@@ -8,6 +8,8 @@ import (
 	"log"
 	"os"
 
+	gltr "github.com/gltr-sh/gltr/pkg"
+	"github.com/kevinburke/ssh_config"
 	"github.com/spf13/cobra"
 )
 
@@ -41,7 +43,7 @@ func init() {
 }
 
 func gltrPowerhose(cmd *cobra.Command, args []string) {
-	// powerhoseAws, _ := cmd.Flags().GetBool("aws")
+	powerhoseAws, _ := cmd.Flags().GetBool("aws")
 	powerhoseAzure, _ := cmd.Flags().GetBool("azure")
 
 	gltrConfigDir := getGltrConfigDir()
@@ -54,23 +56,63 @@ func gltrPowerhose(cmd *cobra.Command, args []string) {
 	if powerhoseAzure {
 		log.Printf("Azure not yet supported - unable to powerhose.")
 	}
-	// if powerhoseAws {
-	// 	fmt.Printf("This will do the following:\n")
-	// 	fmt.Printf("- remove gltr ECS cluster\n")
-	// 	fmt.Printf("- remove gltr VPC, internet gateway and subnet\n")
-	// 	err = gltr.PowerhoseAws(config.Aws)
-	// 	if err != nil {
-	// 		log.Printf("Error powerhosing AWS: %v\n", err.Error())
-	// 		os.Exit(1)
-	// 	}
-	// }
+	if powerhoseAws {
+		fmt.Printf("This will do the following in AWS environment %v:\n", config.ProviderConfiguration.ActiveAWSEnvironment())
+		fmt.Printf("- remove gltr ECS cluster\n")
+		fmt.Printf("- remove AWS workspaces from the gltr ssh config\n")
+		if config.ProviderConfiguration.AWS.Bastion.InstanceID != "" {
+			fmt.Printf("- terminate gltr bastion\n")
+		}
+		if config.ProviderConfiguration.AWS.ExternallyManaged {
+			fmt.Printf("- remove gltr security groups (the externally managed VPC is not touched)\n")
+		} else {
+			fmt.Printf("- remove gltr VPC, internet gateway and subnet\n")
+		}
+		err = gltr.PowerhoseAws(config)
+		if err != nil {
+			log.Printf("Error powerhosing AWS: %v\n", err.Error())
+			os.Exit(1)
+		}
 
-	// awsConfig := config.Aws
-	// // remove the settings
-	// awsConfig.ClusterName = ""
-	// awsConfig.VpcID = ""
-	// awsConfig.SubnetID = ""
-	// awsConfig.IgwID = ""
+		if config.ProviderConfiguration.AWS.Bastion.InstanceID != "" {
+			err = unregisterBastionHost()
+			if err != nil {
+				log.Printf("Error removing bastion from ssh config: %v\n", err.Error())
+			}
+		}
+
+		// all AWS tasks are gone with the network they were running in
+		awsEnvironment := config.ProviderConfiguration.ActiveAWSEnvironment()
+		removed, err := removeHostsFromSSHConfig(func(h *ssh_config.Host) bool {
+			annotations := hostAnnotations(h)
+			hostAWSEnvironment := annotations[sshAnnotationAWSEnv]
+			if hostAWSEnvironment == "" {
+				hostAWSEnvironment = gltr.DefaultAWSEnvironment
+			}
+			platform := annotations[sshAnnotationPlatform]
+			return hostAWSEnvironment == awsEnvironment &&
+				(platform == gltr.Ec2.ToString() || platform == gltr.EcsFargate.ToString())
+		})
+		if err != nil {
+			log.Printf("Error removing AWS tasks from ssh config: %v\n", err.Error())
+		}
+		for _, h := range removed {
+			fmt.Printf("Host %v removed from ssh config\n", h)
+		}
+
+		// remove the settings; the AWS environment keeps its profile, region
+		// and role so that it can be initialized again
+		config.ProviderConfiguration.AWS = config.ProviderConfiguration.AWS.Identity()
+		if awsEnvironment == gltr.DefaultAWSEnvironment {
+			var remainingExecutionPlatforms []gltr.ExecutionPlatform
+			for _, e := range config.ExecutionPlatforms {
+				if e.Type != gltr.Ec2 && e.Type != gltr.EcsFargate {
+					remainingExecutionPlatforms = append(remainingExecutionPlatforms, e)
+				}
+			}
+			config.ExecutionPlatforms = remainingExecutionPlatforms
+		}
+	}
 
 	err = writeGltrConfig(gltrConfigDir, config)
 	if err != nil {
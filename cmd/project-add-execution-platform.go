@@ -48,12 +48,6 @@ func projectAddExecutionPlatform(cmd *cobra.Command, args []string) {
 		os.Exit(1)
 	}
 
-	var availableExecutionPlatforms []string
-	for _, e := range gltrConfig.ExecutionPlatforms {
-		platformName := e.Type.ToString()
-		availableExecutionPlatforms = append(availableExecutionPlatforms, platformName)
-	}
-
 	gltrFilename, _ := cmd.Flags().GetString("file")
 
 	gt, err := readGltrFile(gltrFilename)
@@ -62,6 +56,34 @@ func projectAddExecutionPlatform(cmd *cobra.Command, args []string) {
 		os.Exit(1)
 	}
 
+	// AWS platforms are added for the selected AWS environment; a project
+	// can have a config per environment
+	err = useProjectAWSEnvironment(&gltrConfig, &gt)
+	if err != nil {
+		fmt.Printf("Error selecting AWS environment: %s\n", err)
+		os.Exit(1)
+	}
+	awsEnvironment := gltrConfig.ProviderConfiguration.ActiveAWSEnvironment()
+	if len(gt.AWSEnvironments()) == 0 && awsEnvironment != gltr.DefaultAWSEnvironment {
+		gt.AWSEnvironment = awsEnvironment
+	}
+
+	var availableExecutionPlatforms []string
+	for _, p := range gltrConfig.ConfiguredExecutionPlatforms() {
+		availableExecutionPlatforms = append(availableExecutionPlatforms, p.ToString())
+	}
+
+	// users who have not allowed an address for the project yet, eg as
+	// someone else initialized it, default to their public address
+	if len(gltrConfig.AllowedCIDRs[gt.ProjectID]) == 0 {
+		cidrs, err := resolveAllowedCIDRs(nil)
+		if err != nil {
+			fmt.Printf("Error determining allowed CIDRs: %v\n", err)
+			os.Exit(1)
+		}
+		setAllowedCIDRs(&gltrConfig, gt.ProjectID, cidrs)
+	}
+
 	// need to add logic to determine the available but unconfigured platforms...
 	// and then simply choose one if there is only one option...
 	platformToAdd := gltr.ReadOptionInput(
@@ -94,7 +116,7 @@ func projectAddExecutionPlatform(cmd *cobra.Command, args []string) {
 		}
 		fmt.Printf("New gltr configuration written to file\n")
 	case gltr.Ec2:
-		newPlatformConfig, err = gltr.ProjectAddEc2ExecutionPlatform(gt, gltrConfig)
+		newPlatformConfig, err = gltr.ProjectAddEc2ExecutionPlatform(gt, &gltrConfig)
 		if err != nil {
 			fmt.Printf("Error adding ecs fargate execution platform: %s\n", err)
 			os.Exit(1)
@@ -116,7 +138,7 @@ func projectAddExecutionPlatform(cmd *cobra.Command, args []string) {
 
 	// new set of available execution platforms
 	// write new execution platform to
-	gt.ExecutionPlatformConfigs = append(gt.ExecutionPlatformConfigs, newPlatformConfig)
+	gt.SetExecutionPlatformProjectConfig(newPlatformConfig)
 
 	gt.DefaultExecutionPlatform = chooseDefaultExecutionPlatform(gt)
 
@@ -128,9 +150,14 @@ func projectAddExecutionPlatform(cmd *cobra.Command, args []string) {
 
 func chooseDefaultExecutionPlatform(gt gltr.Task) gltr.ExecutionPlatformType {
 	var configuredExecutionPlatforms []string
+	seen := map[gltr.ExecutionPlatformType]bool{}
 	for _, e := range gt.ExecutionPlatformConfigs {
-		platformName := e.Type.ToString()
-		configuredExecutionPlatforms = append(configuredExecutionPlatforms, platformName)
+		// AWS platforms may be configured for several AWS environments
+		if seen[e.Type] {
+			continue
+		}
+		seen[e.Type] = true
+		configuredExecutionPlatforms = append(configuredExecutionPlatforms, e.Type.ToString())
 	}
 
 	defaultExecutionPlatform := gltr.ReadOptionInput(
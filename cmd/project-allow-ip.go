@@ -0,0 +1,97 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"os"
+	"strings"
+
+	gltr "github.com/gltr-sh/gltr/pkg"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+// projectAllowIPCmd represents the project allow-ip command
+var projectAllowIPCmd = &cobra.Command{
+	Use:   "allow-ip",
+	Short: "Update the CIDRs allowed to access the project workspaces",
+	Long: `Update your CIDRs allowed to access the project ports and refresh the rules
+of the project security groups.
+
+Without --cidr, your allowed CIDRs are replaced with this machine's current
+public IPv4 and IPv6 addresses - run this when your IP address changes. Your
+CIDRs are kept in your gltr config, not in the gltr file, and the rules of
+other project users are left in place.
+
+With --shared, the CIDRs allowed for the whole team, eg an office network,
+are replaced with those given with --cidr instead; they are kept in the gltr
+file. Without --cidr the shared CIDRs are removed.
+
+Rules which no longer match the project configuration are removed. Security
+groups which were not created by gltr are not modified.`,
+	Run: projectAllowIP,
+}
+
+func init() {
+	projectCmd.AddCommand(projectAllowIPCmd)
+
+	projectAllowIPCmd.Flags().StringP("file", "f", "gltr.yaml", "gltr yaml file")
+	projectAllowIPCmd.Flags().StringSlice("cidr", nil, "CIDRs allowed to access the project (default: this machine's public IP)")
+	projectAllowIPCmd.Flags().Bool("shared", false, "Replace the CIDRs allowed for the whole team in the gltr file")
+}
+
+func projectAllowIP(cmd *cobra.Command, args []string) {
+	gltrFilename, _ := cmd.Flags().GetString("file")
+	cidrs, _ := cmd.Flags().GetStringSlice("cidr")
+	shared, _ := cmd.Flags().GetBool("shared")
+
+	gt, err := readGltrFile(gltrFilename)
+	if err != nil {
+		pterm.Error.Printf("Error reading gltr file - exiting: %v\n", err)
+		os.Exit(1)
+	}
+
+	gltrConfigDir := getGltrConfigDir()
+	config, err := readGltrConfig(gltrConfigDir)
+	if err != nil {
+		pterm.Error.Printf("Error reading gltr config - exiting: %v\n", err)
+		os.Exit(1)
+	}
+
+	if shared {
+		gt.AllowedCIDRs, err = gltr.NormalizeCIDRs(cidrs)
+		if err != nil {
+			pterm.Error.Printf("Error determining allowed CIDRs: %v\n", err)
+			os.Exit(1)
+		}
+		pterm.Info.Printf("Shared allowed CIDRs: %v\n", strings.Join(gt.AllowedCIDRs, ", "))
+		err = writeGltrFile(gltrFilename, gt)
+		if err != nil {
+			pterm.Error.Printf("Error writing gltr file: %v\n", err)
+			os.Exit(1)
+		}
+	} else {
+		cidrs, err = resolveAllowedCIDRs(cidrs)
+		if err != nil {
+			pterm.Error.Printf("Error determining allowed CIDRs: %v\n", err)
+			os.Exit(1)
+		}
+		pterm.Info.Printf("Your allowed CIDRs: %v\n", strings.Join(cidrs, ", "))
+		setAllowedCIDRs(&config, gt.ProjectID, cidrs)
+		err = writeGltrConfig(gltrConfigDir, config)
+		if err != nil {
+			pterm.Error.Printf("Error writing gltr config: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	err = forEachProjectAWSEnvironment(&config, &gt, func() error {
+		return gltr.UpdateProjectIngress(gt, config)
+	})
+	if err != nil {
+		pterm.Error.Printf("Error updating project security groups: %v\n", err)
+		os.Exit(1)
+	}
+	pterm.Success.Printf("Project %v updated\n", gt.ProjectName)
+}
@@ -0,0 +1,74 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"os"
+
+	gltr "github.com/gltr-sh/gltr/pkg"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+// projectDefaultAWSEnvironmentCmd represents the project default-aws-environment command
+var projectDefaultAWSEnvironmentCmd = &cobra.Command{
+	Use:   "default-aws-environment <name>",
+	Short: "Select the AWS environment the project runs in",
+	Long: `Selects the AWS environment used for the project when --aws-env is not
+given; "default" clears the selection so that the default AWS environment of
+the gltr config is used. The project needs an AWS execution platform for the
+environment, which is added with:
+
+  gltr project add-execution-platform --aws-env <name>`,
+	Args: cobra.ExactArgs(1),
+	Run:  projectDefaultAWSEnvironment,
+}
+
+func init() {
+	projectCmd.AddCommand(projectDefaultAWSEnvironmentCmd)
+
+	projectDefaultAWSEnvironmentCmd.Flags().StringP("file", "f", "gltr.yaml", "Gltr yaml file")
+}
+
+func projectDefaultAWSEnvironment(cmd *cobra.Command, args []string) {
+	gltrFilename, _ := cmd.Flags().GetString("file")
+	name := args[0]
+
+	gt, err := readGltrFile(gltrFilename)
+	if err != nil {
+		pterm.Error.Printf("Error reading gltr file - exiting: %v\n", err)
+		os.Exit(1)
+	}
+	config, err := readGltrConfig(getGltrConfigDir())
+	if err != nil {
+		pterm.Error.Printf("Error reading gltr config - exiting: %v\n", err)
+		os.Exit(1)
+	}
+	if err := config.ProviderConfiguration.UseAWSEnvironment(name); err != nil {
+		pterm.Error.Printf("Error selecting AWS environment: %v\n", err)
+		os.Exit(1)
+	}
+
+	configured := false
+	for _, e := range gt.AWSEnvironments() {
+		configured = configured || e == name
+	}
+	if !configured {
+		pterm.Warning.Printf(
+			"Project %v has no AWS execution platform for %v - add one with: gltr project add-execution-platform --aws-env %v\n",
+			gt.ProjectName, name, name,
+		)
+	}
+
+	gt.AWSEnvironment = name
+	if name == gltr.DefaultAWSEnvironment {
+		gt.AWSEnvironment = ""
+	}
+	err = writeGltrFile(gltrFilename, gt)
+	if err != nil {
+		pterm.Error.Printf("Error writing gltr file: %v\n", err)
+		os.Exit(1)
+	}
+	pterm.Success.Printf("Project %v runs in AWS environment %v\n", gt.ProjectName, name)
+}
@@ -0,0 +1,136 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/erikgeiser/promptkit/confirmation"
+	gltr "github.com/gltr-sh/gltr/pkg"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+// projectDestroyCmd represents the project destroy command
+var projectDestroyCmd = &cobra.Command{
+	Use:   "destroy",
+	Short: "Remove all cloud resources belonging to a project",
+	Long: `Remove all resources which gltr has created for this project.
+
+This kills all running tasks for the project, deletes the project security
+groups, deregisters the project task definitions and removes the project
+entries from the gltr ssh config and known_hosts file. Resources shared by
+all projects (VPC, subnet, ECS cluster) are not removed - use powerhose for
+this.`,
+	Run: projectDestroy,
+}
+
+func init() {
+	projectCmd.AddCommand(projectDestroyCmd)
+
+	projectDestroyCmd.Flags().StringP("file", "f", "gltr.yaml", "gltr yaml file")
+	projectDestroyCmd.Flags().Bool("remove-keys", false, "Also remove the project key pair from the key store")
+	projectDestroyCmd.Flags().BoolP("yes", "y", false, "Do not ask for confirmation")
+}
+
+// projectSSHHostEntries returns the ssh host entries which gltr run may have
+// added to the gltr ssh config for the project
+func projectSSHHostEntries(projectName string) []string {
+	return []string{
+		fmt.Sprintf("%s-docker", projectName),
+		fmt.Sprintf("%s-ec2", projectName),
+		fmt.Sprintf("%s-ecs-fargate", projectName),
+	}
+}
+
+func projectDestroy(cmd *cobra.Command, args []string) {
+	gltrFilename, _ := cmd.Flags().GetString("file")
+	removeKeys, _ := cmd.Flags().GetBool("remove-keys")
+	skipConfirmation, _ := cmd.Flags().GetBool("yes")
+
+	gt, err := readGltrFile(gltrFilename)
+	if err != nil {
+		pterm.Error.Printf("Error reading gltr file - exiting: %v\n", err)
+		os.Exit(1)
+	}
+
+	gltrConfigDir := getGltrConfigDir()
+	config, err := readGltrConfig(gltrConfigDir)
+	if err != nil {
+		pterm.Error.Printf("Error reading gltr config - exiting: %v\n", err)
+		os.Exit(1)
+	}
+
+	if !skipConfirmation {
+		prompt := fmt.Sprintf("Destroy all resources for project %v (id: %v)", gt.ProjectName, gt.ProjectID)
+		if !gltr.ReadConfirmationInput(prompt, confirmation.No) {
+			fmt.Printf("Nothing removed.\n")
+			return
+		}
+	}
+
+	// the local docker engine may not be available; this is not an error
+	// since there can then be no tasks running on it
+	dockerExecutionPlatform := gltr.DockerExecutionPlatform{}
+	killed, err := dockerExecutionPlatform.KillProjectTasks(gt.ProjectName)
+	if err != nil {
+		pterm.Warning.Printf("Unable to remove tasks from local docker engine: %v\n", err)
+	} else if killed > 0 {
+		pterm.Success.Printf("%v task(s) terminated on local docker engine\n", killed)
+	}
+
+	err = forEachProjectAWSEnvironment(&config, &gt, func() error {
+		return gltr.ProjectDestroyAws(gt, config)
+	})
+	if err != nil {
+		pterm.Error.Printf("Error removing AWS resources for project: %v\n", err)
+		os.Exit(1)
+	}
+
+	for _, h := range projectSSHHostEntries(gt.ProjectName) {
+		removed, err := removeHostFromSSHConfig(h)
+		if err != nil {
+			pterm.Error.Printf("Error removing host %v from ssh config: %v\n", h, err)
+			os.Exit(1)
+		}
+		if removed {
+			pterm.Success.Printf("Host %v removed from ssh config\n", h)
+		}
+		_, err = removeHostKey(h)
+		if err != nil {
+			pterm.Error.Printf("Error removing host key for %v: %v\n", h, err)
+			os.Exit(1)
+		}
+	}
+
+	if removeKeys {
+		// the deploy key would give access to the repository to no one
+		if gt.GitAccessMode() == gltr.GitAccessDeployKey {
+			if err := removeProjectDeployKey(gt); err != nil {
+				pterm.Warning.Printf("Error removing deploy key, remove it by hand from the repository settings: %v\n", err)
+			} else {
+				pterm.Success.Printf("Deploy key removed from %v\n", gt.GitRepo)
+			}
+		}
+		store, err := projectKeyStore()
+		if err == nil {
+			err = store.Delete(gt.ProjectID)
+		}
+		if err != nil {
+			pterm.Error.Printf("Error removing project private key: %v\n", err)
+			os.Exit(1)
+		}
+		keyDirectory := path.Join(gltrConfigDir, "secrets", gt.ProjectID)
+		err = os.RemoveAll(keyDirectory)
+		if err != nil {
+			pterm.Error.Printf("Error removing project key pair: %v\n", err)
+			os.Exit(1)
+		}
+		pterm.Success.Printf("Project key pair removed from %v\n", keyDirectory)
+	}
+
+	pterm.Success.Printf("Project %v destroyed\n", gt.ProjectName)
+}
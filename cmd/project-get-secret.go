@@ -6,15 +6,9 @@ package cmd
 import (
 	"encoding/base64"
 	"fmt"
-	"io/ioutil"
 	"os"
-	"time"
 
-	sshage "github.com/Mic92/ssh-to-age"
 	"github.com/spf13/cobra"
-	sopsaes "go.mozilla.org/sops/v3/aes"
-	sopsyaml "go.mozilla.org/sops/v3/stores/yaml"
-	"gopkg.in/yaml.v3"
 )
 
 // getSecretCmd represents the getSecret command
@@ -71,98 +65,23 @@ func projectGetSecret(cmd *cobra.Command, args []string) {
 		fmt.Printf("No output file specified...writing secret to console...\n")
 	}
 
-	// read public key for this project...
-	gltrConfigDir := getGltrConfigDir()
-
-	sshPrivateKey, err := getPrivateKey(gltrConfigDir, gt.ProjectID)
-	if err != nil {
-		fmt.Printf("%v", err)
-		os.Exit(1)
-	}
-
-	// create age key from gltr key...this should not be written to anywhere
-	// on the filesystem
-	ageRecipientPrivateKey, _, err := sshage.SSHPrivateKeyToAge(sshPrivateKey, nil)
-	fmt.Printf("Age Private Key generated\n")
-
-	// ugh - too much hardcoding...
-	agePrivateKeyFile := "/tmp/age-key.txt"
-	os.WriteFile(agePrivateKeyFile, []byte(*ageRecipientPrivateKey), 0600)
-	gltrSecretFile := "gltr-secrets.yaml"
-	os.Setenv("SOPS_AGE_KEY_FILE", agePrivateKeyFile)
-
-	secretFileContents, err := ioutil.ReadFile(gltrSecretFile)
-	if err != nil {
-		fmt.Printf("Error reading secrets file - exiting...\n")
-		os.Exit(1)
-	}
-
-	gltrSecretStore := sopsyaml.Store{}
-	tree, err := gltrSecretStore.LoadEncryptedFile(secretFileContents)
-	if err != nil {
-		fmt.Printf("Error loading encrypted file %v - exiting...\n", err)
-		os.Exit(1)
-	}
-	// fmt.Printf("tree: %v\n", tree)
-
-	key, err := tree.Metadata.GetDataKey()
-	if err != nil {
-		fmt.Printf("Error getting data key%v - exiting...\n", err)
-		os.Exit(1)
-	}
-
-	// Decrypt the tree
-	cipher := sopsaes.NewCipher()
-	mac, err := tree.Decrypt(key, cipher)
-	if err != nil {
-		fmt.Printf("Error decrypting tree %v - exiting...\n", err)
-		os.Exit(1)
-	}
-
-	// Compute the hash of the cleartext tree and compare it with
-	// the one that was stored in the document. If they match,
-	// integrity was preserved
-	originalMac, err := cipher.Decrypt(
-		tree.Metadata.MessageAuthenticationCode,
-		key,
-		tree.Metadata.LastModified.Format(time.RFC3339),
-	)
-	if originalMac != mac {
-		fmt.Printf("Failed to verify data integrity. expected mac %q, got %q", originalMac, mac)
-		os.Exit(1)
-	}
-
-	// fmt.Printf("gltrSecretStore: %v\n", gltrSecretStore)
-
-	plainTextFile, err := gltrSecretStore.EmitPlainFile(tree.Branches)
-	if err != nil {
-		fmt.Printf("Error decrypting file: %v\n", err)
-		os.Exit(1)
-	}
-	fmt.Printf("Successfully decrypted secrets\n")
-
-	decryptedMap := make(map[string]interface{})
-	err = yaml.Unmarshal(plainTextFile, &decryptedMap)
+	projectSecrets, err := openProjectSecrets(gt)
 	if err != nil {
-		fmt.Printf("Error unmarshling file: %v\n", err)
+		fmt.Printf("Error opening secrets file: %v\n", err)
 		os.Exit(1)
 	}
-	value, ok := decryptedMap[args[0]].(string)
+	value, ok := projectSecrets.Get(args[0])
 	if !ok {
 		fmt.Printf("Key not defined in secrets file - nothing to do\n")
 	} else {
 		if secretOutputFilename != "" {
-			byteArray, _ := base64.StdEncoding.DecodeString(value)
-			if err := ioutil.WriteFile(secretOutputFilename, []byte(byteArray), 0600); err != nil {
+			if err := os.WriteFile(secretOutputFilename, value, 0600); err != nil {
 				fmt.Printf("Error writing secret to file: %v\n", err)
 			} else {
 				fmt.Printf("Secret written to %v\n", secretOutputFilename)
 			}
 		} else {
-			fmt.Printf("%v (base64 encoded) = %v\n", args[0], value)
+			fmt.Printf("%v (base64 encoded) = %v\n", args[0], base64.StdEncoding.EncodeToString(value))
 		}
 	}
-
-	// this should be in a defer...
-	os.Remove(agePrivateKeyFile)
 }
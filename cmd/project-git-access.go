@@ -0,0 +1,159 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	gltr "github.com/gltr-sh/gltr/pkg"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+// projectGitAccessCmd represents the project git-access command
+var projectGitAccessCmd = &cobra.Command{
+	Use:   "git-access [public|deploy-key|agent]",
+	Short: "Show or select how the workspace reaches the git repository",
+	Long: `Shows or selects how the workspace clones the git repository of the project:
+
+  public      fetches anonymously over https and pushes over ssh with the
+              agent forwarded by gltr ssh (the default)
+  deploy-key  fetches and pushes over ssh with the project key, which is
+              registered as deploy key of the repository
+  agent       fetches and pushes over ssh with the forwarded agent; the
+              repository is cloned on the first login
+
+Selecting deploy-key registers the project key with the hosting service,
+which needs a token in the environment: GITHUB_TOKEN for GitHub, GITLAB_TOKEN
+for GitLab and BITBUCKET_TOKEN, or BITBUCKET_USERNAME and
+BITBUCKET_APP_PASSWORD, for Bitbucket. The service is recognised for
+github.com, gitlab.com and bitbucket.org; self-hosted servers are given with
+--provider and, if the API is not at the usual place, --api-url. Selecting
+another mode removes the deploy key again.`,
+	Args:      cobra.MaximumNArgs(1),
+	ValidArgs: gltr.GitAccessModes,
+	Run:       projectGitAccess,
+}
+
+func init() {
+	projectCmd.AddCommand(projectGitAccessCmd)
+
+	projectGitAccessCmd.Flags().StringP("file", "f", "gltr.yaml", "Gltr yaml file")
+	projectGitAccessCmd.Flags().String(
+		"provider", "", fmt.Sprintf("Hosting service of the repository (%v)", strings.Join(gltr.GitProviders, ", ")),
+	)
+	projectGitAccessCmd.Flags().String("api-url", "", "Base URL of the REST API of the hosting service")
+	projectGitAccessCmd.Flags().Bool("read-only", false, "Register a deploy key which cannot push")
+	projectGitAccessCmd.Flags().Bool("no-register", false, "Do not register or remove the deploy key")
+}
+
+func projectGitAccess(cmd *cobra.Command, args []string) {
+	gltrFilename, _ := cmd.Flags().GetString("file")
+	providerType, _ := cmd.Flags().GetString("provider")
+	apiURL, _ := cmd.Flags().GetString("api-url")
+	readOnly, _ := cmd.Flags().GetBool("read-only")
+	noRegister, _ := cmd.Flags().GetBool("no-register")
+
+	gt, err := readGltrFile(gltrFilename)
+	if err != nil {
+		pterm.Error.Printf("Error reading gltr file - exiting: %v\n", err)
+		os.Exit(1)
+	}
+	repo, err := gltr.ParseGitURL(gt.GitRepo)
+	if err != nil {
+		pterm.Error.Printf("Error parsing git repository of %v: %v\n", gt.ProjectName, err)
+		os.Exit(1)
+	}
+
+	if len(args) == 0 {
+		showGitAccess(gt)
+		return
+	}
+
+	mode := args[0]
+	previousMode := gt.GitAccessMode()
+	gt.GitAccess = mode
+	if err := gt.ValidateGitAccess(); err != nil {
+		pterm.Error.Printf("Error selecting git access: %v\n", err)
+		os.Exit(1)
+	}
+	if providerType != "" {
+		gt.GitProvider.Type = providerType
+	}
+	if apiURL != "" {
+		gt.GitProvider.APIURL = apiURL
+	}
+
+	if !noRegister && (mode == gltr.GitAccessDeployKey || previousMode == gltr.GitAccessDeployKey) {
+		publicKey, err := projectAuthorizedKey(gt)
+		if err != nil {
+			pterm.Error.Printf("Error reading project public key: %v\n", err)
+			os.Exit(1)
+		}
+		provider, err := gltr.NewDeployKeyProvider(gt.GitProvider, repo)
+		if err == nil && mode == gltr.GitAccessDeployKey {
+			title := fmt.Sprintf("gltr %v (%v)", gt.ProjectName, gt.ProjectID)
+			err = provider.AddDeployKey(repo, title, strings.TrimSpace(string(publicKey)), readOnly)
+			if err == nil {
+				pterm.Success.Printf("Project key registered as deploy key of %v with %v\n", repo.RepoPath(), provider)
+			}
+		} else if err == nil {
+			// the key is only removed once it is no longer used
+			if err = removeProjectDeployKey(gt); err == nil {
+				pterm.Success.Printf("Deploy key of %v removed from %v\n", repo.RepoPath(), provider)
+			}
+		}
+		switch {
+		case err != nil && mode == gltr.GitAccessDeployKey:
+			pterm.Error.Printf("Error registering deploy key: %v\n", err)
+			if errors.Is(err, gltr.ErrReadOnlyDeployKeys) {
+				pterm.Error.Printf("Register it with --read-only and push with a forwarded agent\n")
+			}
+			pterm.Error.Printf(
+				"The key can be added by hand in the settings of %v, followed by gltr project git-access deploy-key --no-register:\n%v\n",
+				repo.RepoPath(), strings.TrimSpace(string(publicKey)),
+			)
+			os.Exit(1)
+		case err != nil:
+			pterm.Warning.Printf("Error removing deploy key, remove it by hand from the settings of %v: %v\n", repo.RepoPath(), err)
+		}
+	}
+
+	if mode == gltr.GitAccessPublic {
+		gt.GitAccess = ""
+	}
+	if err := writeGltrFile(gltrFilename, gt); err != nil {
+		pterm.Error.Printf("Error writing gltr file: %v\n", err)
+		os.Exit(1)
+	}
+	pterm.Success.Printf("Workspaces of %v reach %v with git access %v\n", gt.ProjectName, repo.RepoPath(), mode)
+}
+
+func showGitAccess(gt gltr.Task) {
+	fetchURL, pushURL := gt.FetchAndPushRepos()
+	fmt.Printf("Git access: %v\n", gt.GitAccessMode())
+	fmt.Printf("Fetch URL:  %v\n", fetchURL)
+	fmt.Printf("Push URL:   %v\n", pushURL)
+}
+
+// removeProjectDeployKey removes the project key from the deploy keys of the
+// git repository
+func removeProjectDeployKey(gt gltr.Task) error {
+	repo, err := gltr.ParseGitURL(gt.GitRepo)
+	if err != nil {
+		return err
+	}
+	publicKey, err := projectAuthorizedKey(gt)
+	if err != nil {
+		return err
+	}
+	provider, err := gltr.NewDeployKeyProvider(gt.GitProvider, repo)
+	if err != nil {
+		return err
+	}
+	return provider.RemoveDeployKey(repo, string(publicKey))
+}
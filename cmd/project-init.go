@@ -132,9 +132,21 @@ func initializeProjectWithConfig(config gltr.Config, gltrConfigDir, repoName, gl
 		fmt.Printf("Error generating key pair: %v", err)
 		return err
 	}
-	keyDirectory := path.Join(gltrConfigDir, "secrets", projectID)
+	store, err := newProjectKeyStore(config.KeyStore)
+	if err != nil {
+		fmt.Printf("Error opening key store: %v\n", err)
+		return err
+	}
+	if err := writeProjectKeys(store, projectID, publicKey, privateKey); err != nil {
+		fmt.Printf("Error writing project keys: %v\n", err)
+		return err
+	}
 
-	writeKeysToDirectory(keyDirectory, projectID, publicKey, privateKey)
+	projectPublicKey, err := authorizedProjectKey(*publicKey)
+	if err != nil {
+		fmt.Printf("Error encoding project public key: %v", err)
+		return err
+	}
 
 	shortProjectName := extractProjectShortNameFromRepo(repoName)
 	// set up some defaults
@@ -153,11 +165,20 @@ func initializeProjectWithConfig(config gltr.Config, gltrConfigDir, repoName, gl
 				},
 			},
 		},
-		ProjectPublicKey: string(*publicKey),
+		ProjectPublicKey: string(projectPublicKey),
 	}
 
 	updatedProject := initializeProjectWithDefaults(project, config)
 
+	// the addresses of the user are personal, so they are not written to the
+	// gltr file which the team shares
+	setAllowedCIDRs(&config, projectID, readAllowedCIDRs())
+	err = writeGltrConfig(gltrConfigDir, config)
+	if err != nil {
+		fmt.Printf("Error writing gltr config: %v\n", err)
+		return err
+	}
+
 	err = writeGltrFile(gltrFilename, updatedProject)
 	if err != nil {
 		fmt.Printf("Error writing gltr file: %v\n", err)
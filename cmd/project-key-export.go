@@ -0,0 +1,95 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"os"
+	"strings"
+
+	"github.com/gltr-sh/gltr/pkg/secrets"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// projectKeyExportCmd represents the project key export command
+var projectKeyExportCmd = &cobra.Command{
+	Use:   "export --for <name or email>",
+	Short: "Export the project key for another project user",
+	Long: `Encrypts the project private key for the ssh ed25519 keys the user has in
+gltr.yaml; only that user can import it. The result is written to stdout
+unless --output is given and can be sent over any channel:
+
+  gltr project key export --for alice@example.com -o project-key.age`,
+	Args: cobra.NoArgs,
+	Run:  projectKeyExport,
+}
+
+func init() {
+	projectKeyCmd.AddCommand(projectKeyExportCmd)
+
+	projectKeyExportCmd.Flags().String("for", "", "Name or email of the project user")
+	projectKeyExportCmd.Flags().StringP("output", "o", "", "File to write the exported key to")
+	projectKeyExportCmd.MarkFlagRequired("for")
+}
+
+func projectKeyExport(cmd *cobra.Command, args []string) {
+	gltrFilename, _ := cmd.Flags().GetString("file")
+	userName, _ := cmd.Flags().GetString("for")
+	output, _ := cmd.Flags().GetString("output")
+
+	gt, err := readGltrFile(gltrFilename)
+	if err != nil {
+		pterm.Error.Printf("Error reading gltr file - exiting: %v\n", err)
+		os.Exit(1)
+	}
+
+	i := gt.FindUser(userName)
+	if i < 0 {
+		pterm.Error.Printf("No user %v in project %v - add them with gltr project users add\n", userName, gt.ProjectName)
+		os.Exit(1)
+	}
+	// the key is encrypted for all ed25519 keys of the user
+	var userKeys [][]byte
+	for _, k := range gt.Users[i].Keys() {
+		if strings.HasPrefix(k, "ssh-ed25519 ") {
+			userKeys = append(userKeys, []byte(k))
+		}
+	}
+	if len(userKeys) == 0 {
+		pterm.Error.Printf("User %v has no ssh ed25519 key in %v\n", userName, gltrFilename)
+		os.Exit(1)
+	}
+
+	privateKey, err := readPrivateKey(gt.ProjectID)
+	if err != nil {
+		pterm.Error.Printf("Error reading project key: %v\n", err)
+		os.Exit(1)
+	}
+	plaintext, err := yaml.Marshal(exportedProjectKey{
+		ProjectID:   gt.ProjectID,
+		ProjectName: gt.ProjectName,
+		PrivateKey:  string(privateKey),
+	})
+	if err != nil {
+		pterm.Error.Printf("Error encoding project key: %v\n", err)
+		os.Exit(1)
+	}
+	sealed, err := secrets.Seal(plaintext, userKeys...)
+	if err != nil {
+		pterm.Error.Printf("Error encrypting project key for %v: %v\n", userName, err)
+		os.Exit(1)
+	}
+
+	if output == "" {
+		os.Stdout.Write(sealed)
+		return
+	}
+	if err := os.WriteFile(output, sealed, 0600); err != nil {
+		pterm.Error.Printf("Error writing %v: %v\n", output, err)
+		os.Exit(1)
+	}
+	pterm.Success.Printf("Project key exported for %v to %v\n", userName, output)
+	pterm.Info.Printf("They can import it with: gltr project key import %v\n", output)
+}
@@ -0,0 +1,139 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"errors"
+	"io"
+	"os"
+	"path"
+
+	"github.com/gltr-sh/gltr/pkg/keystore"
+	"github.com/gltr-sh/gltr/pkg/secrets"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+	"gopkg.in/yaml.v3"
+)
+
+// projectKeyImportCmd represents the project key import command
+var projectKeyImportCmd = &cobra.Command{
+	Use:   "import [file]",
+	Short: "Import a project key exported for you",
+	Long: `Decrypts a project key exported with gltr project key export using your ssh
+key and adds it to the key store, after which the project
+can be run. The exported key is read from stdin if no file is given. The key
+has to match the project public key in gltr.yaml.`,
+	Args: cobra.MaximumNArgs(1),
+	Run:  projectKeyImport,
+}
+
+func init() {
+	projectKeyCmd.AddCommand(projectKeyImportCmd)
+
+	projectKeyImportCmd.Flags().Bool("force", false, "Replace a different project key which is already installed")
+}
+
+func projectKeyImport(cmd *cobra.Command, args []string) {
+	gltrFilename, _ := cmd.Flags().GetString("file")
+	force, _ := cmd.Flags().GetBool("force")
+
+	gt, err := readGltrFile(gltrFilename)
+	if err != nil {
+		pterm.Error.Printf("Error reading gltr file - exiting: %v\n", err)
+		os.Exit(1)
+	}
+
+	var sealed []byte
+	if len(args) == 0 || args[0] == "-" {
+		sealed, err = io.ReadAll(os.Stdin)
+	} else {
+		sealed, err = os.ReadFile(args[0])
+	}
+	if err != nil {
+		pterm.Error.Printf("Error reading exported key: %v\n", err)
+		os.Exit(1)
+	}
+
+	plaintext, err := unsealWithSecretKeys(gt, sealed)
+	if errors.Is(err, secrets.ErrNoMatchingKey) {
+		pterm.Error.Printf("The project key was not exported for any of your ssh keys\n")
+		os.Exit(1)
+	}
+	if err != nil {
+		pterm.Error.Printf("Error decrypting exported key: %v\n", err)
+		os.Exit(1)
+	}
+	var exported exportedProjectKey
+	if err := yaml.Unmarshal(plaintext, &exported); err != nil {
+		pterm.Error.Printf("Error decoding exported key: %v\n", err)
+		os.Exit(1)
+	}
+	if exported.ProjectID != gt.ProjectID {
+		pterm.Error.Printf(
+			"The key was exported for project %v (id: %v), not %v (id: %v)\n",
+			exported.ProjectName, exported.ProjectID, gt.ProjectName, gt.ProjectID,
+		)
+		os.Exit(1)
+	}
+
+	// the key has to be the one the project secrets are encrypted for
+	rawKey, err := ssh.ParseRawPrivateKey([]byte(exported.PrivateKey))
+	if err != nil {
+		pterm.Error.Printf("Error parsing exported key: %v\n", err)
+		os.Exit(1)
+	}
+	privateKey, ok := rawKey.(*ed25519.PrivateKey)
+	if !ok {
+		pterm.Error.Printf("The exported key is not an ed25519 key\n")
+		os.Exit(1)
+	}
+	publicKey, err := authorizedProjectKey(privateKey.Public().(ed25519.PublicKey))
+	if err != nil {
+		pterm.Error.Printf("Error encoding project public key: %v\n", err)
+		os.Exit(1)
+	}
+	if projectKey, err := projectAuthorizedKey(gt); err == nil {
+		if !bytes.Equal(bytes.TrimSpace(projectKey), publicKey) {
+			pterm.Error.Printf("The exported key does not match the project public key in %v\n", gltrFilename)
+			os.Exit(1)
+		}
+	}
+
+	store, err := projectKeyStore()
+	if err != nil {
+		pterm.Error.Printf("Error opening key store: %v\n", err)
+		os.Exit(1)
+	}
+	current, err := store.Get(gt.ProjectID)
+	switch {
+	case err == nil && bytes.Equal(current, []byte(exported.PrivateKey)):
+		pterm.Info.Printf("Project key of %v already installed\n", gt.ProjectName)
+		return
+	case err == nil && !force:
+		pterm.Error.Printf("A different key for %v is in %v - use --force to replace it\n", gt.ProjectName, store)
+		os.Exit(1)
+	case err != nil && !errors.Is(err, keystore.ErrNotFound) && !force:
+		pterm.Error.Printf("Error reading installed project key: %v\n", err)
+		os.Exit(1)
+	}
+
+	keyDirectory := path.Join(getGltrConfigDir(), "secrets", gt.ProjectID)
+	if err := os.MkdirAll(keyDirectory, 0700); err != nil {
+		pterm.Error.Printf("Error creating %v: %v\n", keyDirectory, err)
+		os.Exit(1)
+	}
+	if err := store.Put(gt.ProjectID, []byte(exported.PrivateKey)); err != nil {
+		pterm.Error.Printf("Error storing project key: %v\n", err)
+		os.Exit(1)
+	}
+	publicKeyFilename := path.Join(keyDirectory, gt.ProjectID+".pub")
+	if err := os.WriteFile(publicKeyFilename, append(publicKey, '\n'), 0644); err != nil {
+		pterm.Error.Printf("Error writing project public key: %v\n", err)
+		os.Exit(1)
+	}
+	pterm.Success.Printf("Project key of %v installed in %v\n", gt.ProjectName, store)
+}
@@ -0,0 +1,37 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+// projectKeyCmd represents the project key command
+var projectKeyCmd = &cobra.Command{
+	Use:   "key",
+	Short: "Share the project key pair",
+	Long: `The project private key is kept in ~/.gltr/secrets/<project-id> on the
+machine which initialized the project and is needed to run the project. The
+key can be exported encrypted for the ssh key of another project user, who
+imports it on their machine.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Println("Please specify subcommand for project key")
+	},
+}
+
+func init() {
+	projectCmd.AddCommand(projectKeyCmd)
+
+	projectKeyCmd.PersistentFlags().StringP("file", "f", "gltr.yaml", "Gltr yaml file")
+}
+
+// exportedProjectKey is the contents of an exported project key before it is
+// encrypted
+type exportedProjectKey struct {
+	ProjectID   string `yaml:"project_id"`
+	ProjectName string `yaml:"project_name"`
+	PrivateKey  string `yaml:"private_key"`
+}
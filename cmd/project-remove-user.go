@@ -0,0 +1,24 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// projectRemoveUserCmd represents the project remove-user command, which is
+// kept for scripts written for older versions of gltr
+var projectRemoveUserCmd = &cobra.Command{
+	Use:        "remove-user <name or email>",
+	Short:      "Remove a user from the project",
+	Deprecated: `use "gltr project users remove" instead`,
+	Args:       cobra.ExactArgs(1),
+	Run:        projectUsersRemove,
+}
+
+func init() {
+	projectCmd.AddCommand(projectRemoveUserCmd)
+
+	projectRemoveUserCmd.Flags().StringP("file", "f", "gltr.yaml", "Gltr yaml file")
+}
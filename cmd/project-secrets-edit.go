@@ -0,0 +1,125 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/erikgeiser/promptkit/confirmation"
+	gltr "github.com/gltr-sh/gltr/pkg"
+	"github.com/gltr-sh/gltr/pkg/secrets"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// projectSecretsEditCmd represents the project secrets edit command
+var projectSecretsEditCmd = &cobra.Command{
+	Use:   "edit",
+	Short: "Edit the secrets of the project in $EDITOR",
+	Long: `Decrypts the secrets of the project to a temporary yaml file readable only
+by you, opens it in $EDITOR (vi if unset) and encrypts the edited secrets
+again. Secrets which are removed from the file are removed from the project.
+The temporary file is deleted when the editor exits.`,
+	Args: cobra.NoArgs,
+	Run:  projectSecretsEdit,
+}
+
+const secretsEditHeader = `# Secrets of project %v - one "name: value" entry per secret.
+# Binary values are shown as !!binary. Save and exit to encrypt the secrets.
+`
+
+func init() {
+	projectSecretsCmd.AddCommand(projectSecretsEditCmd)
+}
+
+func projectSecretsEdit(cmd *cobra.Command, args []string) {
+	gt, projectSecrets := mustOpenProjectSecrets(cmd)
+
+	values := map[string]string{}
+	for _, name := range projectSecrets.List() {
+		value, _ := projectSecrets.Get(name)
+		values[name] = string(value)
+	}
+	plain, err := yaml.Marshal(values)
+	if err != nil {
+		pterm.Error.Printf("Error encoding secrets: %v\n", err)
+		os.Exit(1)
+	}
+	if len(values) == 0 {
+		plain = nil
+	}
+	plain = append([]byte(fmt.Sprintf(secretsEditHeader, gt.ProjectName)), plain...)
+
+	dir, err := os.MkdirTemp("", "gltr-secrets-")
+	if err != nil {
+		pterm.Error.Printf("Error creating temporary directory: %v\n", err)
+		os.Exit(1)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, secrets.DefaultFileName)
+	if err := os.WriteFile(filename, plain, 0600); err != nil {
+		pterm.Error.Printf("Error writing temporary file: %v\n", err)
+		os.RemoveAll(dir)
+		os.Exit(1)
+	}
+
+	edited, changed := editSecrets(filename, plain)
+	if !changed {
+		pterm.Info.Printf("No changes to the secrets\n")
+		return
+	}
+	newValues := map[string][]byte{}
+	for k, v := range edited {
+		newValues[k] = []byte(v)
+	}
+	if err := projectSecrets.Replace(newValues); err != nil {
+		pterm.Error.Printf("Error encrypting secrets: %v\n", err)
+		os.RemoveAll(dir)
+		os.Exit(1)
+	}
+	pterm.Success.Printf("Secrets of %v updated\n", gt.ProjectName)
+}
+
+// editSecrets opens the file in the editor until it holds valid yaml or the
+// user gives up; it returns the edited secrets and whether they changed
+func editSecrets(filename string, original []byte) (map[string]string, bool) {
+	editor := strings.Fields(os.Getenv("EDITOR"))
+	if len(editor) == 0 {
+		editor = []string{"vi"}
+	}
+	for {
+		editorCommand := exec.Command(editor[0], append(editor[1:], filename)...)
+		editorCommand.Stdin = os.Stdin
+		editorCommand.Stdout = os.Stdout
+		editorCommand.Stderr = os.Stderr
+		if err := editorCommand.Run(); err != nil {
+			pterm.Error.Printf("Error running editor %v: %v\n", editor[0], err)
+			return nil, false
+		}
+
+		contents, err := os.ReadFile(filename)
+		if err != nil {
+			pterm.Error.Printf("Error reading edited secrets: %v\n", err)
+			return nil, false
+		}
+		if bytes.Equal(contents, original) {
+			return nil, false
+		}
+		edited := map[string]string{}
+		err = yaml.Unmarshal(contents, &edited)
+		if err == nil {
+			return edited, true
+		}
+		pterm.Error.Printf("The edited secrets are not valid: %v\n", err)
+		if !gltr.ReadConfirmationInput("Edit the secrets again?", confirmation.Yes) {
+			return nil, false
+		}
+	}
+}
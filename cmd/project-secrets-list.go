@@ -0,0 +1,41 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+// projectSecretsListCmd represents the project secrets list command
+var projectSecretsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the secrets of the project",
+	Args:  cobra.NoArgs,
+	Run:   projectSecretsList,
+}
+
+func init() {
+	projectSecretsCmd.AddCommand(projectSecretsListCmd)
+}
+
+func projectSecretsList(cmd *cobra.Command, args []string) {
+	gt, projectSecrets := mustOpenProjectSecrets(cmd)
+
+	names := projectSecrets.List()
+	if len(names) == 0 {
+		pterm.Info.Printf("Project %v has no secrets\n", gt.ProjectName)
+		return
+	}
+	tableData := pterm.TableData{
+		[]string{"Name", "Size"},
+	}
+	for _, name := range names {
+		value, _ := projectSecrets.Get(name)
+		tableData = append(tableData, []string{name, fmt.Sprintf("%v bytes", len(value))})
+	}
+	pterm.DefaultTable.WithHasHeader().WithData(tableData).Render()
+}
@@ -0,0 +1,40 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"os"
+
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+// projectSecretsRemoveCmd represents the project secrets remove command
+var projectSecretsRemoveCmd = &cobra.Command{
+	Use:   "remove <name>...",
+	Short: "Remove secrets from the project",
+	Args:  cobra.MinimumNArgs(1),
+	Run:   projectSecretsRemove,
+}
+
+func init() {
+	projectSecretsCmd.AddCommand(projectSecretsRemoveCmd)
+}
+
+func projectSecretsRemove(cmd *cobra.Command, args []string) {
+	_, projectSecrets := mustOpenProjectSecrets(cmd)
+
+	for _, name := range args {
+		removed, err := projectSecrets.Delete(name)
+		if err != nil {
+			pterm.Error.Printf("Error removing secret %v: %v\n", name, err)
+			os.Exit(1)
+		}
+		if !removed {
+			pterm.Warning.Printf("Secret %v not defined - nothing to do\n", name)
+			continue
+		}
+		pterm.Success.Printf("Secret %v removed\n", name)
+	}
+}
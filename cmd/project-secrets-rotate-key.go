@@ -0,0 +1,99 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"os"
+	"path"
+
+	gltr "github.com/gltr-sh/gltr/pkg"
+	"github.com/gltr-sh/gltr/pkg/secrets"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+// projectSecretsRotateKeyCmd represents the project secrets rotate-key command
+var projectSecretsRotateKeyCmd = &cobra.Command{
+	Use:   "rotate-key",
+	Short: "Replace the project key pair and re-encrypt the secrets",
+	Long: `Generates a new key pair for the project in the key store and
+re-encrypts gltr-secrets.yaml for it and for the ssh keys of the project users;
+the old project key cannot decrypt the secrets afterwards. The new public key
+is recorded in gltr.yaml. Running workspaces
+keep the old key until they are relaunched.`,
+	Args: cobra.NoArgs,
+	Run:  projectSecretsRotateKey,
+}
+
+func init() {
+	projectSecretsCmd.AddCommand(projectSecretsRotateKeyCmd)
+}
+
+func projectSecretsRotateKey(cmd *cobra.Command, args []string) {
+	gt, projectSecrets := mustOpenProjectSecrets(cmd)
+
+	store, err := projectKeyStore()
+	if err != nil {
+		pterm.Error.Printf("Error opening key store: %v\n", err)
+		os.Exit(1)
+	}
+
+	// the new key pair is staged under a separate ID next to the current one
+	// and only replaces it once the secrets have been encrypted for it
+	stagingID := gt.ProjectID + ".new"
+	stagingDirectory := path.Join(getGltrConfigDir(), "secrets", stagingID)
+	removeStaging := func() {
+		store.Delete(stagingID)
+		os.RemoveAll(stagingDirectory)
+	}
+	publicKey, privateKey, err := generateKeyPair()
+	if err != nil {
+		pterm.Error.Printf("Error generating key pair: %v\n", err)
+		os.Exit(1)
+	}
+	if err := writeProjectKeys(store, stagingID, publicKey, privateKey); err != nil {
+		pterm.Error.Printf("Error storing new project key: %v\n", err)
+		removeStaging()
+		os.Exit(1)
+	}
+	newPublicKey, err := authorizedProjectKey(*publicKey)
+	if err != nil {
+		pterm.Error.Printf("Error encoding new project key: %v\n", err)
+		removeStaging()
+		os.Exit(1)
+	}
+	gt.ProjectPublicKey = string(newPublicKey)
+
+	if _, err := os.Stat(secrets.DefaultFileName); err == nil {
+		recipients, err := projectSecretRecipients(gt)
+		if err == nil {
+			err = projectSecrets.Rekey(recipients)
+		}
+		if err != nil {
+			pterm.Error.Printf("Error re-encrypting %v: %v\n", secrets.DefaultFileName, err)
+			removeStaging()
+			os.Exit(1)
+		}
+		pterm.Success.Printf("%v re-encrypted for %v recipients\n", secrets.DefaultFileName, len(recipients))
+	}
+
+	if err := writeProjectKeys(store, gt.ProjectID, publicKey, privateKey); err != nil {
+		pterm.Error.Printf("Error installing new project key: %v\n", err)
+		pterm.Error.Printf("The secrets are encrypted for the key stored as %v in %v\n", stagingID, store)
+		os.Exit(1)
+	}
+	removeStaging()
+	gltrFilename, _ := cmd.Flags().GetString("file")
+	if err := writeGltrFile(gltrFilename, gt); err != nil {
+		pterm.Error.Printf("Error writing the new project public key to %v: %v\n", gltrFilename, err)
+		os.Exit(1)
+	}
+	pterm.Success.Printf("Project key of %v rotated\n", gt.ProjectName)
+	pterm.Info.Printf("Running workspaces still hold the old key - relaunch them with gltr run\n")
+	if gt.GitAccessMode() == gltr.GitAccessDeployKey {
+		pterm.Warning.Printf(
+			"The deploy key of the git repository is the old key - register the new one with gltr project git-access deploy-key and remove the old one by hand\n",
+		)
+	}
+}
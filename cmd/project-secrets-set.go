@@ -0,0 +1,71 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"io"
+	"os"
+	"strings"
+
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+// projectSecretsSetCmd represents the project secrets set command
+var projectSecretsSetCmd = &cobra.Command{
+	Use:   "set KEY=VALUE | KEY --from-stdin",
+	Short: "Set a key/value secret",
+	Long: `Sets a secret to a string value. As values given on the command line end
+up in the shell history, the value can also be read from stdin:
+
+  gltr project secrets set API_TOKEN --from-stdin < token.txt`,
+	Args: cobra.ExactArgs(1),
+	Run:  projectSecretsSet,
+}
+
+func init() {
+	projectSecretsCmd.AddCommand(projectSecretsSetCmd)
+
+	projectSecretsSetCmd.Flags().Bool("from-stdin", false, "Read the value from stdin")
+}
+
+func projectSecretsSet(cmd *cobra.Command, args []string) {
+	fromStdin, _ := cmd.Flags().GetBool("from-stdin")
+
+	var name string
+	var value []byte
+	if fromStdin {
+		if strings.Contains(args[0], "=") {
+			pterm.Error.Printf("Give only the key with --from-stdin\n")
+			os.Exit(1)
+		}
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			pterm.Error.Printf("Error reading value from stdin: %v\n", err)
+			os.Exit(1)
+		}
+		name, value = args[0], data
+	} else {
+		key, v, ok := strings.Cut(args[0], "=")
+		if !ok {
+			pterm.Error.Printf("Expected KEY=VALUE or KEY --from-stdin\n")
+			os.Exit(1)
+		}
+		name, value = key, []byte(v)
+	}
+	if name == "" {
+		pterm.Error.Printf("The key of the secret is empty\n")
+		os.Exit(1)
+	}
+
+	_, projectSecrets := mustOpenProjectSecrets(cmd)
+	if _, ok := projectSecrets.Get(name); ok {
+		pterm.Info.Printf("Secret %v already defined - overwriting\n", name)
+	}
+	if err := projectSecrets.Set(name, value); err != nil {
+		pterm.Error.Printf("Error setting secret %v: %v\n", name, err)
+		os.Exit(1)
+	}
+	pterm.Success.Printf("Secret %v set\n", name)
+}
@@ -0,0 +1,49 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	gltr "github.com/gltr-sh/gltr/pkg"
+	"github.com/gltr-sh/gltr/pkg/secrets"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+// projectSecretsCmd represents the project secrets command
+var projectSecretsCmd = &cobra.Command{
+	Use:   "secrets",
+	Short: "Manage the secrets of a project",
+	Long: `The secrets of a project are kept in gltr-secrets.yaml next to gltr.yaml,
+encrypted with sops for the project key. Secrets can be files added with
+add-secret or key/value secrets added with set.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Println("Please specify subcommand for project secrets")
+	},
+}
+
+func init() {
+	projectCmd.AddCommand(projectSecretsCmd)
+
+	projectSecretsCmd.PersistentFlags().StringP("file", "f", "gltr.yaml", "Gltr yaml file")
+}
+
+// mustOpenProjectSecrets reads the gltr file given by the file flag and opens
+// the secrets file of the project; it exits on errors
+func mustOpenProjectSecrets(cmd *cobra.Command) (gltr.Task, *secrets.File) {
+	gltrFilename, _ := cmd.Flags().GetString("file")
+	gt, err := readGltrFile(gltrFilename)
+	if err != nil {
+		pterm.Error.Printf("Error reading gltr file - exiting: %v\n", err)
+		os.Exit(1)
+	}
+	projectSecrets, err := openProjectSecrets(gt)
+	if err != nil {
+		pterm.Error.Printf("Error opening %v: %v\n", secrets.DefaultFileName, err)
+		os.Exit(1)
+	}
+	return gt, projectSecrets
+}
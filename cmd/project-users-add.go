@@ -0,0 +1,122 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"os"
+
+	gltr "github.com/gltr-sh/gltr/pkg"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+// projectUsersAddCmd represents the project users add command
+var projectUsersAddCmd = &cobra.Command{
+	Use:   "add [name]",
+	Short: "Add a user to the project",
+	Long: `Adds a user with their ssh keys to gltr.yaml and re-encrypts the project
+secrets for them. The keys are looked up by username on GitHub, or given
+directly as a key or a file holding keys:
+
+  gltr project users add --github alice
+  gltr project users add bob --email bob@example.com --ssh-key ~/bob.pub
+
+The lookup fetches <source>/<username>.keys; --keys-source (or
+GLTR_KEYS_SOURCE) selects another server with the same API, such as GitLab,
+or a directory of <username>.keys files. Without a name or keys the user is
+asked for them.`,
+	Args: cobra.MaximumNArgs(1),
+	Run:  projectUsersAdd,
+}
+
+func init() {
+	projectUsersCmd.AddCommand(projectUsersAddCmd)
+
+	addUserFlags(projectUsersAddCmd)
+}
+
+// addUserFlags adds the flags describing a new user to cmd
+func addUserFlags(cmd *cobra.Command) {
+	cmd.Flags().String("email", "", "Email address of the user")
+	cmd.Flags().String("github", "", "Username to look up the ssh keys of")
+	cmd.Flags().String("ssh-key", "", "SSH public key of the user or a file holding keys")
+	cmd.Flags().String("keys-source", "", "Server or directory to look up keys in (default "+gltr.DefaultKeySource+")")
+	cmd.Flags().String("account", "", "Unix account of the user in projects with user accounts (default derived from the name)")
+}
+
+func projectUsersAdd(cmd *cobra.Command, args []string) {
+	gltrFilename, _ := cmd.Flags().GetString("file")
+	email, _ := cmd.Flags().GetString("email")
+	username, _ := cmd.Flags().GetString("github")
+	sshKey, _ := cmd.Flags().GetString("ssh-key")
+	account, _ := cmd.Flags().GetString("account")
+
+	gt, err := readGltrFile(gltrFilename)
+	if err != nil {
+		pterm.Error.Printf("Error reading gltr file - exiting: %v\n", err)
+		os.Exit(1)
+	}
+
+	u := gltr.User{Email: email, Account: account}
+	switch {
+	case len(args) == 1:
+		u.Name = args[0]
+	case username != "":
+		u.Name = username
+	default:
+		u.Name = gltr.ReadTextInput("Enter user name", "", "User name cannot be empty")
+		if u.Email == "" {
+			u.Email = gltr.ReadTextInput("Enter email address", "", "")
+		}
+	}
+	if gt.FindUser(u.Name) >= 0 || (u.Email != "" && gt.FindUser(u.Email) >= 0) {
+		pterm.Error.Printf("User %v is already a user of %v - remove them first to change their keys\n", u.Name, gt.ProjectName)
+		os.Exit(1)
+	}
+
+	var keys []string
+	switch {
+	case username != "" && sshKey != "":
+		pterm.Error.Printf("Give either --github or --ssh-key\n")
+		os.Exit(1)
+	case username != "":
+		keySource, _ := cmd.Flags().GetString("keys-source")
+		if keySource == "" {
+			keySource = os.Getenv("GLTR_KEYS_SOURCE")
+		}
+		if keySource == "" {
+			keySource = gltr.DefaultKeySource
+		}
+		lookup := gltr.NewKeyLookup(keySource)
+		keys, err = lookup.LookupKeys(username)
+		u.KeysFrom = lookup.Location(username)
+	default:
+		if sshKey == "" {
+			sshKey = gltr.ReadTextInput("Enter SSH public key or key file", "", "SSH key cannot be empty")
+		}
+		keys, err = readSSHKeys(sshKey)
+	}
+	if err != nil {
+		pterm.Error.Printf("Error reading ssh keys of %v: %v\n", u.Name, err)
+		os.Exit(1)
+	}
+	if len(keys) == 0 {
+		pterm.Error.Printf("No ssh keys given for %v\n", u.Name)
+		os.Exit(1)
+	}
+	u.SshKey, u.SshKeys = keys[0], keys[1:]
+
+	gt.Users = append(gt.Users, u)
+	writeProjectUsers(gltrFilename, gt)
+	pterm.Success.Printf("User %v added to project %v with %v ssh keys\n", u.Name, gt.ProjectName, len(keys))
+}
+
+// readSSHKeys returns the keys in the file keyOrFile names, or keyOrFile
+// itself if it is a key
+func readSSHKeys(keyOrFile string) ([]string, error) {
+	if data, err := os.ReadFile(expandHome(keyOrFile)); err == nil {
+		return gltr.ParseAuthorizedKeys(string(data))
+	}
+	return gltr.ParseAuthorizedKeys(keyOrFile)
+}
@@ -0,0 +1,65 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"os"
+	"strings"
+
+	gltr "github.com/gltr-sh/gltr/pkg"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+)
+
+// projectUsersListCmd represents the project users list command
+var projectUsersListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the users of the project and their ssh keys",
+	Args:  cobra.NoArgs,
+	Run:   projectUsersList,
+}
+
+func init() {
+	projectUsersCmd.AddCommand(projectUsersListCmd)
+}
+
+func projectUsersList(cmd *cobra.Command, args []string) {
+	gltrFilename, _ := cmd.Flags().GetString("file")
+	gt, err := readGltrFile(gltrFilename)
+	if err != nil {
+		pterm.Error.Printf("Error reading gltr file - exiting: %v\n", err)
+		os.Exit(1)
+	}
+	if len(gt.Users) == 0 {
+		pterm.Info.Printf("Project %v has no users\n", gt.ProjectName)
+		return
+	}
+
+	tableData := pterm.TableData{
+		[]string{"Name", "Email", "Account", "SSH keys", "Keys from"},
+	}
+	accounts := gt.Accounts()
+	for i, u := range gt.Users {
+		account := gltr.SharedAccount
+		if gt.UserAccounts {
+			account = accounts[i]
+		}
+		var keys []string
+		for _, k := range u.Keys() {
+			keys = append(keys, sshKeyFingerprint(k))
+		}
+		tableData = append(tableData, []string{u.Name, u.Email, account, strings.Join(keys, ", "), u.KeysFrom})
+	}
+	pterm.DefaultTable.WithHasHeader().WithData(tableData).Render()
+}
+
+// sshKeyFingerprint returns the type and SHA256 fingerprint of the key
+func sshKeyFingerprint(key string) string {
+	publicKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(key))
+	if err != nil {
+		return "invalid key"
+	}
+	return publicKey.Type() + " " + ssh.FingerprintSHA256(publicKey)
+}
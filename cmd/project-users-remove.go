@@ -0,0 +1,47 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"os"
+
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+// projectUsersRemoveCmd represents the project users remove command
+var projectUsersRemoveCmd = &cobra.Command{
+	Use:   "remove <name or email>",
+	Short: "Remove a user from the project",
+	Long: `Removes the user from gltr.yaml and re-encrypts gltr-secrets.yaml for the
+remaining users, so that the ssh key of the removed user no longer decrypts
+the secrets. Secrets the user has seen before should be rotated, and running
+workspaces keep the keys of the user in authorized_keys until they are
+relaunched.`,
+	Args: cobra.ExactArgs(1),
+	Run:  projectUsersRemove,
+}
+
+func init() {
+	projectUsersCmd.AddCommand(projectUsersRemoveCmd)
+}
+
+func projectUsersRemove(cmd *cobra.Command, args []string) {
+	gltrFilename, _ := cmd.Flags().GetString("file")
+	gt, err := readGltrFile(gltrFilename)
+	if err != nil {
+		pterm.Error.Printf("Error reading gltr file - exiting: %v\n", err)
+		os.Exit(1)
+	}
+
+	i := gt.FindUser(args[0])
+	if i < 0 {
+		pterm.Error.Printf("No user %v in project %v\n", args[0], gt.ProjectName)
+		os.Exit(1)
+	}
+	gt.Users = append(gt.Users[:i], gt.Users[i+1:]...)
+
+	writeProjectUsers(gltrFilename, gt)
+	pterm.Success.Printf("User %v removed from project %v\n", args[0], gt.ProjectName)
+}
@@ -0,0 +1,45 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	gltr "github.com/gltr-sh/gltr/pkg"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+// projectUsersCmd represents the project users command
+var projectUsersCmd = &cobra.Command{
+	Use:   "users",
+	Short: "Manage the users of a project",
+	Long: `The users of a project are listed in gltr.yaml. The ssh keys of all users are
+added to authorized_keys in the workspace, and the project secrets are
+encrypted for their ed25519 keys.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Println("Please specify subcommand for project users")
+	},
+}
+
+func init() {
+	projectCmd.AddCommand(projectUsersCmd)
+
+	projectUsersCmd.PersistentFlags().StringP("file", "f", "gltr.yaml", "Gltr yaml file")
+}
+
+// writeProjectUsers re-encrypts the project secrets for the users of gt and
+// writes gltr.yaml; the secrets are re-encrypted first, so a failure leaves
+// both unchanged. It exits on errors.
+func writeProjectUsers(gltrFilename string, gt gltr.Task) {
+	if err := rekeyProjectSecrets(gt); err != nil {
+		pterm.Error.Printf("Error re-encrypting project secrets: %v\n", err)
+		os.Exit(1)
+	}
+	if err := writeGltrFile(gltrFilename, gt); err != nil {
+		pterm.Error.Printf("Error writing gltr file: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -21,6 +21,14 @@ interacting with the data and the workflow. gltr combines git, container
 technologies, jupyter, ssh and vscode to deliver this experience. `,
 }
 
+// awsEnvironmentFlag is the AWS environment given with --aws-env
+var awsEnvironmentFlag string
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&awsEnvironmentFlag, "aws-env", "",
+		"AWS environment to use instead of the project or config default")
+}
+
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
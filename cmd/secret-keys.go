@@ -0,0 +1,284 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	gltr "github.com/gltr-sh/gltr/pkg"
+	"github.com/gltr-sh/gltr/pkg/keystore"
+	"github.com/gltr-sh/gltr/pkg/secrets"
+	"github.com/mikesmitty/edkey"
+	"github.com/pterm/pterm"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/term"
+)
+
+// secretKeyFile is a private key which may be able to open the secrets file
+type secretKeyFile struct {
+	path string
+	data []byte
+}
+
+// openProjectSecrets opens the secrets file of the project in the current
+// directory with the ssh key of the caller or the project key; a new file is
+// encrypted for the project key and the keys of all project users
+func openProjectSecrets(gt gltr.Task) (*secrets.File, error) {
+	var projectSecrets *secrets.File
+	err := withSecretKeys(gt, func(keys [][]byte) (err error) {
+		projectSecrets, err = secrets.Open(secrets.DefaultFileName, keys...)
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := os.Stat(secrets.DefaultFileName); os.IsNotExist(err) {
+		recipients, err := projectSecretRecipients(gt)
+		if err != nil {
+			return nil, err
+		}
+		if err := projectSecrets.SetRecipients(recipients); err != nil {
+			return nil, err
+		}
+	}
+	return projectSecrets, nil
+}
+
+// unsealWithSecretKeys decrypts data sealed for the ssh key of the caller
+func unsealWithSecretKeys(gt gltr.Task, sealed []byte) ([]byte, error) {
+	var data []byte
+	err := withSecretKeys(gt, func(keys [][]byte) (err error) {
+		data, err = secrets.Unseal(sealed, keys...)
+		return
+	})
+	return data, err
+}
+
+// withSecretKeys calls decrypt with the ssh keys of the caller; the project
+// key, which may have to be unlocked in the key store, and ssh keys with a
+// passphrase are only added if none of the others fit
+func withSecretKeys(gt gltr.Task, decrypt func(keys [][]byte) error) error {
+	keys, encryptedKeys := secretKeyFiles()
+
+	var err error
+	if len(keys) > 0 {
+		err = decrypt(keys)
+	}
+	if len(keys) == 0 || errors.Is(err, secrets.ErrNoMatchingKey) {
+		if projectKey, ok := storedProjectKey(gt); ok {
+			keys = append(keys, projectKey)
+			err = decrypt(keys)
+		}
+	}
+	if (len(keys) == 0 || errors.Is(err, secrets.ErrNoMatchingKey)) && len(encryptedKeys) > 0 {
+		keys = append(keys, unlockSecretKeys(encryptedKeys)...)
+		if len(keys) > 0 {
+			err = decrypt(keys)
+		}
+	}
+	if len(keys) == 0 {
+		return errors.New("no ed25519 ssh key found to decrypt with")
+	}
+	return err
+}
+
+// rekeyProjectSecrets encrypts the secrets file of the project for the
+// current project key and users; there is nothing to do if the project has
+// no secrets file
+func rekeyProjectSecrets(gt gltr.Task) error {
+	if _, err := os.Stat(secrets.DefaultFileName); os.IsNotExist(err) {
+		return nil
+	}
+	projectSecrets, err := openProjectSecrets(gt)
+	if err != nil {
+		return err
+	}
+	recipients, err := projectSecretRecipients(gt)
+	if err != nil {
+		return err
+	}
+	if err := projectSecrets.Rekey(recipients); err != nil {
+		return err
+	}
+	pterm.Info.Printf("%v re-encrypted for %v recipients\n", secrets.DefaultFileName, len(recipients))
+	return nil
+}
+
+// projectSecretRecipients returns the age recipients the secrets of the
+// project are encrypted for: the project key and the ssh keys of the users.
+// Only ed25519 keys can be converted to age; users with other keys are
+// skipped with a warning.
+func projectSecretRecipients(gt gltr.Task) ([]string, error) {
+	projectKey, err := projectAuthorizedKey(gt)
+	if err != nil {
+		return nil, err
+	}
+	projectRecipient, err := secrets.Recipient(projectKey)
+	if err != nil {
+		return nil, fmt.Errorf("error converting project key: %w", err)
+	}
+
+	recipients := []string{projectRecipient}
+	seen := map[string]bool{projectRecipient: true}
+	for _, u := range gt.Users {
+		userRecipients := 0
+		for _, k := range u.Keys() {
+			r, err := secrets.Recipient([]byte(k))
+			if err != nil {
+				continue
+			}
+			userRecipients++
+			if !seen[r] {
+				seen[r] = true
+				recipients = append(recipients, r)
+			}
+		}
+		if userRecipients == 0 {
+			pterm.Warning.Printf("User %v has no ed25519 ssh key and cannot decrypt the project secrets\n", u.Name)
+		}
+	}
+	return recipients, nil
+}
+
+// projectAuthorizedKey returns the public project key in authorized keys
+// format; projects created by older versions of gltr hold the raw ed25519
+// key in gltr.yaml, or only have it in the local key directory
+func projectAuthorizedKey(gt gltr.Task) ([]byte, error) {
+	switch {
+	case strings.HasPrefix(gt.ProjectPublicKey, "ssh-"):
+		return []byte(gt.ProjectPublicKey), nil
+	case len(gt.ProjectPublicKey) == ed25519.PublicKeySize:
+		return authorizedProjectKey(ed25519.PublicKey(gt.ProjectPublicKey))
+	}
+	publicKeyFilename := path.Join(getGltrConfigDir(), "secrets", gt.ProjectID, gt.ProjectID+".pub")
+	key, err := os.ReadFile(publicKeyFilename)
+	if err != nil {
+		return nil, fmt.Errorf("project public key not found in gltr.yaml or %v", publicKeyFilename)
+	}
+	return key, nil
+}
+
+// authorizedProjectKey returns the public key in authorized keys format
+func authorizedProjectKey(publicKey ed25519.PublicKey) ([]byte, error) {
+	sshPublicKey, err := ssh.NewPublicKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimSpace(ssh.MarshalAuthorizedKey(sshPublicKey)), nil
+}
+
+// storedProjectKey returns the project key from the key store if it holds
+// an ed25519 key for the project
+func storedProjectKey(gt gltr.Task) ([]byte, bool) {
+	store, err := projectKeyStore()
+	if err != nil {
+		pterm.Warning.Printf("Project key not available: %v\n", err)
+		return nil, false
+	}
+	data, err := store.Get(gt.ProjectID)
+	if err != nil {
+		if !errors.Is(err, keystore.ErrNotFound) {
+			pterm.Warning.Printf("Project key not available: %v\n", err)
+		}
+		return nil, false
+	}
+	rawKey, err := ssh.ParseRawPrivateKey(data)
+	if err != nil {
+		return nil, false
+	}
+	return ed25519PEM(rawKey)
+}
+
+// secretKeyFiles returns the ssh ed25519 private keys of the caller which
+// may open the secrets of the project: the identity file of the gltr config
+// and ~/.ssh/id_ed25519. Keys protected by a passphrase are returned
+// separately.
+func secretKeyFiles() (keys [][]byte, encryptedKeys []secretKeyFile) {
+	var candidates []string
+	if config, err := readGltrConfig(getGltrConfigDir()); err == nil && config.SSH.IdentityFile != "" {
+		candidates = append(candidates, expandHome(config.SSH.IdentityFile))
+	}
+	candidates = append(candidates, filepath.Join(os.Getenv("HOME"), ".ssh", "id_ed25519"))
+
+	seen := map[string]bool{}
+	for _, c := range candidates {
+		if seen[c] {
+			continue
+		}
+		seen[c] = true
+		data, err := os.ReadFile(c)
+		if err != nil {
+			continue
+		}
+		rawKey, err := ssh.ParseRawPrivateKey(data)
+		var passphraseMissing *ssh.PassphraseMissingError
+		switch {
+		case errors.As(err, &passphraseMissing):
+			encryptedKeys = append(encryptedKeys, secretKeyFile{path: c, data: data})
+		case err == nil:
+			if key, ok := ed25519PEM(rawKey); ok {
+				keys = append(keys, key)
+			}
+		}
+	}
+	return
+}
+
+// unlockSecretKeys asks for the passphrases of the keys and returns the ones
+// which could be unlocked
+func unlockSecretKeys(keyFiles []secretKeyFile) (keys [][]byte) {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return nil
+	}
+	for _, k := range keyFiles {
+		fmt.Printf("Enter passphrase for %v: ", k.path)
+		passphrase, err := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Println()
+		if err != nil {
+			continue
+		}
+		rawKey, err := ssh.ParseRawPrivateKeyWithPassphrase(k.data, passphrase)
+		if err != nil {
+			pterm.Warning.Printf("Unable to unlock %v: %v\n", k.path, err)
+			continue
+		}
+		if key, ok := ed25519PEM(rawKey); ok {
+			keys = append(keys, key)
+		}
+	}
+	return
+}
+
+// ed25519PEM returns an unencrypted OpenSSH PEM encoding of the key, which
+// is only kept in memory; false is returned for keys other than ed25519
+func ed25519PEM(rawKey interface{}) ([]byte, bool) {
+	var key ed25519.PrivateKey
+	switch k := rawKey.(type) {
+	case *ed25519.PrivateKey:
+		key = *k
+	case ed25519.PrivateKey:
+		key = k
+	default:
+		return nil, false
+	}
+	return pem.EncodeToMemory(&pem.Block{
+		Type:  "OPENSSH PRIVATE KEY",
+		Bytes: edkey.MarshalED25519PrivateKey(key),
+	}), true
+}
+
+// expandHome replaces a leading ~ with the home directory, as in the ssh
+// config
+func expandHome(filename string) string {
+	if strings.HasPrefix(filename, "~/") {
+		return filepath.Join(os.Getenv("HOME"), filename[2:])
+	}
+	return filename
+}
@@ -40,6 +40,12 @@ func showTask(cmd *cobra.Command, args []string) {
 		os.Exit(1)
 	}
 
+	err = loadProjectAWSEnvironment(&gt, gt.DefaultExecutionPlatform)
+	if err != nil {
+		log.Printf("Error selecting AWS environment: %v", err)
+		os.Exit(1)
+	}
+
 	switch gt.DefaultExecutionPlatform {
 	case gltr.Ec2:
 		gltr.ShowTaskEc2(taskID)
@@ -0,0 +1,539 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/erikgeiser/promptkit/confirmation"
+	gltr "github.com/gltr-sh/gltr/pkg"
+	"github.com/kevinburke/ssh_config"
+	"github.com/pterm/pterm"
+)
+
+var (
+	gltrSSHConfigFile = "config.gltr"
+	userSSHConfigFile = "config"
+	// the bastion gets its own ssh host entry so that its host key is
+	// verified when it is used as a ProxyJump
+	bastionSSHHostEntry = "gltr-bastion"
+	// bastion entries are annotated with this platform so that prune leaves
+	// them alone
+	bastionSSHPlatform = "bastion"
+)
+
+// gltr annotates the host entries it writes with comments of the form
+// "# gltr-task-id=<id>" so that entries can be matched to their tasks
+const (
+	sshAnnotationPlatform = "gltr-platform"
+	sshAnnotationTaskID   = "gltr-task-id"
+	sshAnnotationCluster  = "gltr-cluster"
+	sshAnnotationAWSEnv   = "gltr-aws-env"
+)
+
+func getSSHDir() string {
+	return filepath.Join(os.Getenv("HOME"), ".ssh")
+}
+
+// writeFileAtomic writes the data to a temporary file next to the target
+// and renames it into place, so that ssh never sees a partially written file
+func writeFileAtomic(filename string, data []byte, perm os.FileMode) error {
+	f, err := os.CreateTemp(filepath.Dir(filename), "."+filepath.Base(filename)+".*")
+	if err != nil {
+		return err
+	}
+	// this is a no-op once the file has been renamed
+	defer os.Remove(f.Name())
+
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Chmod(perm)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), filename)
+}
+
+func writeSSHConfig(filename string, cfg *ssh_config.Config) error {
+	err := os.MkdirAll(getSSHDir(), 0700)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(getSSHDir(), filename), []byte(cfg.String()), 0600)
+}
+
+func readSSHConfig(filename string) (cfg *ssh_config.Config, err error) {
+
+	f, err := os.Open(filepath.Join(getSSHDir(), filename))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if cfg, err = ssh_config.Decode(f); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// readOrCreateSSHConfig returns the parsed ssh config file or an empty
+// config if the file does not exist yet
+func readOrCreateSSHConfig(filename string) (*ssh_config.Config, error) {
+	cfg, err := readSSHConfig(filename)
+	if err != nil && os.IsNotExist(err) {
+		pterm.Info.Printf("No ssh config file exists - creating...\n")
+		// decoding an empty file sets up the implicit Host * entry
+		return ssh_config.Decode(strings.NewReader(""))
+	}
+	return cfg, err
+}
+
+// taskHosts returns the host entries of the config; the first element
+// matches everything and provides defaults, so it is skipped
+func taskHosts(cfg *ssh_config.Config) []*ssh_config.Host {
+	if len(cfg.Hosts) == 0 {
+		return nil
+	}
+	return cfg.Hosts[1:]
+}
+
+func findHost(cfg *ssh_config.Config, hostname string) *ssh_config.Host {
+	for _, h := range taskHosts(cfg) {
+		if h.Matches(hostname) {
+			return h
+		}
+	}
+	return nil
+}
+
+// hostAlias returns the name of a host entry
+func hostAlias(h *ssh_config.Host) string {
+	var patterns []string
+	for _, p := range h.Patterns {
+		patterns = append(patterns, p.String())
+	}
+	return strings.Join(patterns, " ")
+}
+
+// hostSetting returns the value of a setting of a host entry
+func hostSetting(h *ssh_config.Host, key string) string {
+	for _, n := range h.Nodes {
+		if kv, ok := n.(*ssh_config.KV); ok && strings.EqualFold(kv.Key, key) {
+			return kv.Value
+		}
+	}
+	return ""
+}
+
+// parseAnnotation returns the key and value of a gltr annotation comment
+func parseAnnotation(n ssh_config.Node) (key, value string, ok bool) {
+	empty, isEmpty := n.(*ssh_config.Empty)
+	if !isEmpty {
+		return "", "", false
+	}
+	key, value, found := strings.Cut(strings.TrimSpace(empty.Comment), "=")
+	if !found || !strings.HasPrefix(key, "gltr-") {
+		return "", "", false
+	}
+	return key, value, true
+}
+
+// hostAnnotations returns the gltr annotations of a host entry
+func hostAnnotations(h *ssh_config.Host) map[string]string {
+	annotations := map[string]string{}
+	for _, n := range h.Nodes {
+		if key, value, ok := parseAnnotation(n); ok {
+			annotations[key] = value
+		}
+	}
+	return annotations
+}
+
+// sshHost contains the settings written to the ssh config for a task
+type sshHost struct {
+	Hostname string
+	Port     int
+	// defaults to gltr, the shared account of the gltr container
+	User         string
+	ForwardAgent bool
+	IdentityFile string
+	// eg "8888 localhost:8888"
+	LocalForward string
+	// keepalives are not sent if this is 0
+	ServerAliveInterval int
+	// only one of these is set when the task is not reachable directly
+	ProxyCommand string
+	ProxyJump    string
+	// the host key is looked up under the alias in the known hosts file
+	HostKeyAlias   string
+	KnownHostsFile string
+
+	// written as annotations which identify the task behind the entry
+	Platform    string
+	TaskID      string
+	ClusterName string
+	// the named AWS environment of the task; empty for the default one
+	AWSEnvironment string
+}
+
+// sshHostForEndpoint returns the ssh settings which reach a task at the
+// given endpoint on the given port
+func sshHostForEndpoint(endpoint gltr.TaskEndpoint, providerConfig gltr.ProviderConfiguration, port int) sshHost {
+	awsConfig := providerConfig.AWS
+	var host sshHost
+	switch endpoint.ConnectionMode {
+	case gltr.ConnectionSSM:
+		// ssh passes the SSM target to the proxy command as %h
+		host = sshHost{
+			Hostname:     endpoint.SSMTarget,
+			Port:         port,
+			ProxyCommand: gltr.SSMProxyCommand(awsConfig),
+		}
+	case gltr.ConnectionBastion:
+		host = sshHost{
+			Hostname:  endpoint.Address,
+			Port:      port,
+			ProxyJump: bastionSSHHostEntry,
+		}
+	default:
+		host = sshHost{Hostname: endpoint.Address, Port: port}
+	}
+	host.TaskID = endpoint.TaskID
+	if awsEnvironment := providerConfig.ActiveAWSEnvironment(); awsEnvironment != gltr.DefaultAWSEnvironment {
+		host.AWSEnvironment = awsEnvironment
+	}
+	return host
+}
+
+// withSettings applies the user's ssh settings to the host
+func (h sshHost) withSettings(settings gltr.SSHSettings) sshHost {
+	h.IdentityFile = settings.IdentityFile
+	h.ServerAliveInterval = settings.GetServerAliveInterval()
+	if port := settings.GetJupyterLocalPort(); port > 0 {
+		h.LocalForward = fmt.Sprintf("%v localhost:%v", port, gltr.JupyterPort)
+	}
+	return h
+}
+
+// settings returns the ssh config settings which gltr manages, in the order
+// in which they are written; settings with empty values are not written
+func (h sshHost) settings() []ssh_config.KV {
+	user := h.User
+	if user == "" {
+		user = gltr.SharedAccount
+	}
+	forwardAgent := "no"
+	if h.ForwardAgent {
+		forwardAgent = "yes"
+	}
+	serverAliveInterval := ""
+	if h.ServerAliveInterval > 0 {
+		serverAliveInterval = fmt.Sprintf("%v", h.ServerAliveInterval)
+	}
+	identitiesOnly := ""
+	if h.IdentityFile != "" {
+		identitiesOnly = "yes"
+	}
+	strictHostKeyChecking := ""
+	if h.KnownHostsFile != "" {
+		strictHostKeyChecking = "yes"
+	}
+	return []ssh_config.KV{
+		{Key: "hostname", Value: h.Hostname},
+		{Key: "user", Value: user},
+		{Key: "port", Value: fmt.Sprintf("%v", h.Port)},
+		{Key: "ForwardAgent", Value: forwardAgent},
+		{Key: "IdentityFile", Value: h.IdentityFile},
+		{Key: "IdentitiesOnly", Value: identitiesOnly},
+		{Key: "LocalForward", Value: h.LocalForward},
+		{Key: "ServerAliveInterval", Value: serverAliveInterval},
+		{Key: "ProxyCommand", Value: h.ProxyCommand},
+		{Key: "ProxyJump", Value: h.ProxyJump},
+		{Key: "HostKeyAlias", Value: h.HostKeyAlias},
+		{Key: "UserKnownHostsFile", Value: h.KnownHostsFile},
+		{Key: "StrictHostKeyChecking", Value: strictHostKeyChecking},
+	}
+}
+
+// annotations returns the comment lines which identify the task
+func (h sshHost) annotations() []ssh_config.Node {
+	var nodes []ssh_config.Node
+	for _, a := range [][2]string{
+		{sshAnnotationPlatform, h.Platform},
+		{sshAnnotationTaskID, h.TaskID},
+		{sshAnnotationCluster, h.ClusterName},
+		{sshAnnotationAWSEnv, h.AWSEnvironment},
+	} {
+		if a[1] != "" {
+			nodes = append(nodes, &ssh_config.Empty{Comment: fmt.Sprintf(" %v=%v", a[0], a[1])})
+		}
+	}
+	return nodes
+}
+
+// nodes returns the ssh config entries for a new host
+func (h sshHost) nodes() []ssh_config.Node {
+	nodes := h.annotations()
+	for _, kv := range h.settings() {
+		if kv.Value != "" {
+			nodes = append(nodes, &ssh_config.KV{Key: kv.Key, Value: kv.Value})
+		}
+	}
+	// this adds an empty line after the defined kv pairs as a separator
+	return append(nodes, &ssh_config.Empty{})
+}
+
+// update sets the managed settings of an existing host entry; settings left
+// over from a different connection mode are removed and any other settings
+// the user added are kept
+func (h sshHost) update(definedHost *ssh_config.Host) {
+	settings := h.settings()
+	values := map[string]string{}
+	for _, kv := range settings {
+		values[strings.ToLower(kv.Key)] = kv.Value
+	}
+	found := map[string]bool{}
+	// the annotations are replaced with those of the new task
+	nodes := h.annotations()
+	for _, n := range definedHost.Nodes {
+		if _, _, ok := parseAnnotation(n); ok {
+			continue
+		}
+		if nodeKV, ok := n.(*ssh_config.KV); ok {
+			key := strings.ToLower(nodeKV.Key)
+			if value, managed := values[key]; managed {
+				if value == "" || found[key] {
+					continue
+				}
+				nodeKV.Value = value
+				found[key] = true
+			}
+		}
+		nodes = append(nodes, n)
+	}
+	var added []ssh_config.Node
+	for _, kv := range settings {
+		if kv.Value != "" && !found[strings.ToLower(kv.Key)] {
+			added = append(added, &ssh_config.KV{Key: kv.Key, Value: kv.Value})
+		}
+	}
+	// new settings go before the trailing empty line which separates hosts
+	last := len(nodes)
+	for last > 0 {
+		if empty, ok := nodes[last-1].(*ssh_config.Empty); !ok || empty.Comment != "" {
+			break
+		}
+		last--
+	}
+	nodes = append(nodes[:last:last], append(added, nodes[last:]...)...)
+	definedHost.Nodes = nodes
+}
+
+// registerTaskHost records the task host key in the gltr known_hosts file
+// and adds the task to the gltr ssh config with its host key pinned
+func registerTaskHost(sshHostEntry string, host sshHost, hostKey gltr.HostKey, settings gltr.SSHSettings) error {
+	err := recordHostKey(sshHostEntry, hostKey.PublicKey)
+	if err == nil && host.TaskID != "" {
+		err = recordHostKey(taskHostKeyAlias(host.TaskID), hostKey.PublicKey)
+	}
+	if err != nil {
+		return fmt.Errorf("error recording host key: %w", err)
+	}
+	host = host.withSettings(settings)
+	host.ForwardAgent = true
+	host.HostKeyAlias = sshHostEntry
+	host.KnownHostsFile = getKnownHostsPath()
+	return addHostToSSHConfig(sshHostEntry, host)
+}
+
+func addHostToSSHConfig(sshHostEntry string, host sshHost) error {
+
+	pterm.Info.Printf("Adding host to ssh config\n")
+
+	config, err := readOrCreateSSHConfig(gltrSSHConfigFile)
+	if err != nil {
+		return err
+	}
+
+	// check if the host is already defined
+	definedHost := findHost(config, sshHostEntry)
+	if definedHost != nil {
+		// then the record exists, but we want to update it...
+		host.update(definedHost)
+	} else {
+		// there is no entry for this host, so we need to create one...
+		newHostPattern, err := ssh_config.NewPattern(sshHostEntry)
+		if err != nil {
+			return err
+		}
+		newHost := ssh_config.Host{
+			Patterns: []*ssh_config.Pattern{newHostPattern},
+			Nodes:    host.nodes(),
+		}
+		// add the new host to the existing ssh config...
+		config.Hosts = append(config.Hosts, &newHost)
+	}
+
+	err = writeSSHConfig(gltrSSHConfigFile, config)
+	if err == nil {
+		pterm.Success.Printf("Ssh config updated with new host configuration\n")
+	}
+	return err
+}
+
+// removeHostsFromSSHConfig removes the host entries for which remove returns
+// true from the gltr ssh config file, together with their host keys; it
+// returns the names of the removed entries
+func removeHostsFromSSHConfig(remove func(h *ssh_config.Host) bool) ([]string, error) {
+	config, err := readSSHConfig(gltrSSHConfigFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var removed []string
+	var removedKeys []string
+	remainingHosts := config.Hosts[:1]
+	for _, h := range taskHosts(config) {
+		if remove(h) {
+			removed = append(removed, hostAlias(h))
+			removedKeys = append(removedKeys, hostAlias(h))
+			if taskID := hostAnnotations(h)[sshAnnotationTaskID]; taskID != "" {
+				removedKeys = append(removedKeys, taskHostKeyAlias(taskID))
+			}
+			continue
+		}
+		remainingHosts = append(remainingHosts, h)
+	}
+	if len(removed) == 0 {
+		return nil, nil
+	}
+	config.Hosts = remainingHosts
+
+	err = writeSSHConfig(gltrSSHConfigFile, config)
+	if err != nil {
+		return nil, err
+	}
+	for _, alias := range removedKeys {
+		_, err = removeHostKey(alias)
+		if err != nil {
+			return removed, fmt.Errorf("error removing host key for %v: %w", alias, err)
+		}
+	}
+	return removed, nil
+}
+
+// removeHostFromSSHConfig removes the entry for the given host from the gltr
+// ssh config file; it returns true if an entry was removed
+func removeHostFromSSHConfig(sshHostEntry string) (bool, error) {
+	removed, err := removeHostsFromSSHConfig(func(h *ssh_config.Host) bool {
+		return h.Matches(sshHostEntry)
+	})
+	return len(removed) > 0, err
+}
+
+// removeTaskFromSSHConfig removes the entries which belong to the task
+func removeTaskFromSSHConfig(taskID string) ([]string, error) {
+	return removeHostsFromSSHConfig(func(h *ssh_config.Host) bool {
+		return hostAnnotations(h)[sshAnnotationTaskID] == taskID
+	})
+}
+
+// sshConfigIncludesGltr checks whether ~/.ssh/config already includes the
+// gltr ssh config file
+func sshConfigIncludesGltr() (bool, error) {
+	dat, err := os.ReadFile(filepath.Join(getSSHDir(), userSSHConfigFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(dat))
+	for scanner.Scan() {
+		fields := strings.Fields(strings.ReplaceAll(scanner.Text(), "=", " "))
+		if len(fields) < 2 || !strings.EqualFold(fields[0], "Include") {
+			continue
+		}
+		for _, f := range fields[1:] {
+			if filepath.Base(f) == gltrSSHConfigFile {
+				return true, nil
+			}
+		}
+	}
+	return false, scanner.Err()
+}
+
+// addSSHConfigInclude adds an Include for the gltr ssh config file at the
+// top of ~/.ssh/config; Include is only global when it comes before the
+// first Host block
+func addSSHConfigInclude() error {
+	filename := filepath.Join(getSSHDir(), userSSHConfigFile)
+	err := os.MkdirAll(getSSHDir(), 0700)
+	if err != nil {
+		return err
+	}
+	perm := os.FileMode(0600)
+	dat, err := os.ReadFile(filename)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if info, statErr := os.Stat(filename); statErr == nil {
+		perm = info.Mode().Perm()
+	}
+	include := fmt.Sprintf("# added by gltr\nInclude %v\n\n", gltrSSHConfigFile)
+	return writeFileAtomic(filename, append([]byte(include), dat...), perm)
+}
+
+// ensureSSHConfigInclude makes sure that ssh finds the gltr hosts. The user
+// is asked once before ~/.ssh/config is changed and the answer is stored in
+// the gltr config.
+func ensureSSHConfigInclude(gltrConfigDir string, config gltr.Config) {
+	included, err := sshConfigIncludesGltr()
+	if err != nil {
+		pterm.Warning.Printf("Unable to read ~/.ssh/config: %v\n", err)
+		return
+	}
+	if included {
+		return
+	}
+
+	if config.SSH.ManageInclude == nil {
+		consent := gltr.ReadConfirmationInput(
+			fmt.Sprintf("Add 'Include %v' to ~/.ssh/config so that ssh finds gltr workspaces", gltrSSHConfigFile),
+			confirmation.Yes,
+		)
+		config.SSH.ManageInclude = &consent
+		err = writeGltrConfig(gltrConfigDir, config)
+		if err != nil {
+			pterm.Warning.Printf("Unable to store answer in gltr configuration: %v\n", err)
+		}
+	}
+	if !*config.SSH.ManageInclude {
+		pterm.Info.Printf(
+			"~/.ssh/config does not include %v - connect using: ssh -F ~/.ssh/%v <host>\n",
+			gltrSSHConfigFile, gltrSSHConfigFile,
+		)
+		return
+	}
+
+	err = addSSHConfigInclude()
+	if err != nil {
+		pterm.Warning.Printf("Unable to add Include to ~/.ssh/config: %v\n", err)
+		return
+	}
+	pterm.Success.Printf("Added 'Include %v' to ~/.ssh/config\n", gltrSSHConfigFile)
+}
@@ -0,0 +1,58 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"os"
+
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+// sshConfigIncludeCmd represents the ssh-config include command
+var sshConfigIncludeCmd = &cobra.Command{
+	Use:   "include",
+	Short: "Include the gltr ssh config in ~/.ssh/config",
+	Long: `Adds 'Include config.gltr' to the top of ~/.ssh/config so that ssh, scp and
+editors find gltr workspaces by name. gltr offers to do this the first time
+a task is run; this command can be used if that offer was declined.`,
+	Run: sshConfigInclude,
+}
+
+func init() {
+	sshConfigCmd.AddCommand(sshConfigIncludeCmd)
+}
+
+func sshConfigInclude(cmd *cobra.Command, args []string) {
+	gltrConfigDir := getGltrConfigDir()
+	config, err := readGltrConfig(gltrConfigDir)
+	if err != nil {
+		pterm.Error.Printf("Error reading gltr config: %v\n", err)
+		os.Exit(1)
+	}
+
+	included, err := sshConfigIncludesGltr()
+	if err != nil {
+		pterm.Error.Printf("Error reading ~/.ssh/config: %v\n", err)
+		os.Exit(1)
+	}
+	if included {
+		pterm.Info.Printf("~/.ssh/config already includes %v\n", gltrSSHConfigFile)
+	} else {
+		err = addSSHConfigInclude()
+		if err != nil {
+			pterm.Error.Printf("Error updating ~/.ssh/config: %v\n", err)
+			os.Exit(1)
+		}
+		pterm.Success.Printf("Added 'Include %v' to ~/.ssh/config\n", gltrSSHConfigFile)
+	}
+
+	manageInclude := true
+	config.SSH.ManageInclude = &manageInclude
+	err = writeGltrConfig(gltrConfigDir, config)
+	if err != nil {
+		pterm.Error.Printf("Error writing gltr config: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,54 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"os"
+
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+// sshConfigListCmd represents the ssh-config list command
+var sshConfigListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the hosts in the gltr ssh config",
+	Run:   sshConfigList,
+}
+
+func init() {
+	sshConfigCmd.AddCommand(sshConfigListCmd)
+}
+
+func sshConfigList(cmd *cobra.Command, args []string) {
+	config, err := readSSHConfig(gltrSSHConfigFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			pterm.Info.Printf("No gltr ssh config - no hosts defined\n")
+			return
+		}
+		pterm.Error.Printf("Error reading gltr ssh config: %v\n", err)
+		os.Exit(1)
+	}
+
+	tableData := pterm.TableData{
+		[]string{"Host", "Hostname", "Port", "Platform", "Task ID"},
+	}
+	for _, h := range taskHosts(config) {
+		annotations := hostAnnotations(h)
+		tableData = append(tableData, []string{
+			hostAlias(h),
+			hostSetting(h, "hostname"),
+			hostSetting(h, "port"),
+			annotations[sshAnnotationPlatform],
+			annotations[sshAnnotationTaskID],
+		})
+	}
+	pterm.DefaultTable.WithHasHeader().WithData(tableData).Render()
+
+	included, err := sshConfigIncludesGltr()
+	if err == nil && !included {
+		pterm.Warning.Printf("~/.ssh/config does not include %v - run gltr ssh-config include\n", gltrSSHConfigFile)
+	}
+}
@@ -0,0 +1,120 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"os"
+
+	gltr "github.com/gltr-sh/gltr/pkg"
+	"github.com/kevinburke/ssh_config"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+// sshConfigPruneCmd represents the ssh-config prune command
+var sshConfigPruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove hosts for tasks which are no longer running",
+	Long: `Checks the execution platform of every host in the gltr ssh config and
+removes the hosts whose tasks are no longer running, together with their
+host keys. Hosts which were not created for a task (such as the bastion)
+are kept.`,
+	Run: sshConfigPrune,
+}
+
+func init() {
+	sshConfigCmd.AddCommand(sshConfigPruneCmd)
+
+	sshConfigPruneCmd.Flags().Bool("dry-run", false, "Only show the hosts which would be removed")
+}
+
+// taskRunning checks whether the task behind an annotated host entry is still
+// running; ok is false if the entry does not identify a task. AWS tasks are
+// looked up in the AWS environment they were started in.
+func taskRunning(gltrConfig *gltr.Config, annotations map[string]string) (running bool, ok bool, err error) {
+	taskID := annotations[sshAnnotationTaskID]
+	if taskID == "" {
+		return false, false, nil
+	}
+	platform, err := gltr.ParseExecutionPlatformType(annotations[sshAnnotationPlatform])
+	if err != nil {
+		return false, false, nil
+	}
+	if platform == gltr.Ec2 || platform == gltr.EcsFargate {
+		err = gltrConfig.ProviderConfiguration.UseAWSEnvironment(annotations[sshAnnotationAWSEnv])
+		if err != nil {
+			return false, false, err
+		}
+	}
+	switch platform {
+	case gltr.Docker:
+		running, err = gltr.DockerExecutionPlatform{}.TaskRunning(taskID)
+	case gltr.Ec2:
+		running, err = gltr.TaskRunningEc2(taskID)
+	case gltr.EcsFargate:
+		if annotations[sshAnnotationCluster] == "" {
+			return false, false, nil
+		}
+		running, err = gltr.TaskRunningEcs(annotations[sshAnnotationCluster], taskID)
+	default:
+		return false, false, nil
+	}
+	return running, true, err
+}
+
+func sshConfigPrune(cmd *cobra.Command, args []string) {
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+	config, err := readSSHConfig(gltrSSHConfigFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			pterm.Info.Printf("No gltr ssh config - nothing to prune\n")
+			return
+		}
+		pterm.Error.Printf("Error reading gltr ssh config: %v\n", err)
+		os.Exit(1)
+	}
+
+	// without a gltr config, AWS tasks are looked up with the shared AWS
+	// config
+	gltrConfig, _ := readGltrConfig(getGltrConfigDir())
+
+	var staleHosts []string
+	stale := map[string]bool{}
+	for _, h := range taskHosts(config) {
+		alias := hostAlias(h)
+		running, ok, err := taskRunning(&gltrConfig, hostAnnotations(h))
+		switch {
+		case err != nil:
+			pterm.Warning.Printf("Unable to check task for %v - keeping: %v\n", alias, err)
+		case !ok:
+			pterm.Info.Printf("Host %v is not associated with a task - keeping\n", alias)
+		case !running:
+			staleHosts = append(staleHosts, alias)
+			stale[alias] = true
+		}
+	}
+
+	if len(staleHosts) == 0 {
+		pterm.Success.Printf("No hosts to prune\n")
+		return
+	}
+	if dryRun {
+		for _, alias := range staleHosts {
+			pterm.Info.Printf("Would remove %v\n", alias)
+		}
+		return
+	}
+
+	removed, err := removeHostsFromSSHConfig(func(h *ssh_config.Host) bool {
+		return stale[hostAlias(h)]
+	})
+	if err != nil {
+		pterm.Error.Printf("Error updating gltr ssh config: %v\n", err)
+		os.Exit(1)
+	}
+	for _, h := range removed {
+		pterm.Success.Printf("Host %v removed from ssh config\n", h)
+	}
+}
@@ -0,0 +1,62 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"os"
+
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+// sshConfigSetCmd represents the ssh-config set command
+var sshConfigSetCmd = &cobra.Command{
+	Use:   "set",
+	Short: "Change the settings written to the gltr ssh config",
+	Long: `Changes the settings gltr writes to the ssh config entries of new
+workspaces. Existing entries keep their settings until the workspace is run
+again.
+
+The jupyter local port is forwarded to jupyter in the workspace whenever an
+ssh connection is open; use -1 to disable the forward. A server alive
+interval of -1 disables keepalives.`,
+	Run: sshConfigSet,
+}
+
+func init() {
+	sshConfigCmd.AddCommand(sshConfigSetCmd)
+
+	sshConfigSetCmd.Flags().String("identity-file", "", "Private key used to log in to workspaces")
+	sshConfigSetCmd.Flags().Int("server-alive-interval", 0, "Seconds between keepalive messages (default 60)")
+	sshConfigSetCmd.Flags().Int("jupyter-local-port", 0, "Local port forwarded to jupyter (default 8888)")
+}
+
+func sshConfigSet(cmd *cobra.Command, args []string) {
+	gltrConfigDir := getGltrConfigDir()
+	config, err := readGltrConfig(gltrConfigDir)
+	if err != nil {
+		pterm.Error.Printf("Error reading gltr config: %v\n", err)
+		os.Exit(1)
+	}
+
+	if cmd.Flags().Changed("identity-file") {
+		config.SSH.IdentityFile, _ = cmd.Flags().GetString("identity-file")
+	}
+	if cmd.Flags().Changed("server-alive-interval") {
+		config.SSH.ServerAliveInterval, _ = cmd.Flags().GetInt("server-alive-interval")
+	}
+	if cmd.Flags().Changed("jupyter-local-port") {
+		config.SSH.JupyterLocalPort, _ = cmd.Flags().GetInt("jupyter-local-port")
+	}
+
+	err = writeGltrConfig(gltrConfigDir, config)
+	if err != nil {
+		pterm.Error.Printf("Error writing gltr config: %v\n", err)
+		os.Exit(1)
+	}
+	pterm.Success.Printf("ssh settings updated\n")
+	pterm.Info.Printf("Identity file: %v\n", config.SSH.IdentityFile)
+	pterm.Info.Printf("Server alive interval: %v\n", config.SSH.GetServerAliveInterval())
+	pterm.Info.Printf("Jupyter local port: %v\n", config.SSH.GetJupyterLocalPort())
+}
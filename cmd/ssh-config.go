@@ -0,0 +1,26 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+// sshConfigCmd represents the ssh-config command
+var sshConfigCmd = &cobra.Command{
+	Use:   "ssh-config",
+	Short: "Manage the ssh config entries gltr creates for workspaces",
+	Long: `gltr adds an entry to ~/.ssh/config.gltr for every workspace it launches.
+The entries can be listed and entries for tasks which are no longer running
+can be pruned.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Println("Please specify subcommand for ssh-config")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(sshConfigCmd)
+}
@@ -0,0 +1,143 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	gltr "github.com/gltr-sh/gltr/pkg"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+)
+
+// sshCmd represents the ssh command
+var sshCmd = &cobra.Command{
+	Use:   "ssh",
+	Short: "Open an interactive shell in a running task",
+	Long: `Connects to a running task of the project and opens an interactive shell.
+The address of the task is looked up on the execution platform, so this does
+not depend on the ssh config. The ssh agent is forwarded so that git push
+works inside the workspace. Without --task-id the most recently started task
+is used.`,
+	Args: cobra.NoArgs,
+	Run:  sshCommand,
+}
+
+func init() {
+	rootCmd.AddCommand(sshCmd)
+	addTaskSelectionFlags(sshCmd)
+	sshCmd.Flags().Bool("forward-agent", true, "Forward the ssh agent to the task")
+}
+
+// addTaskSelectionFlags adds the flags which select the task to connect to
+func addTaskSelectionFlags(cmd *cobra.Command) {
+	cmd.Flags().StringP("file", "f", "gltr.yaml", "gltr yaml file")
+	cmd.Flags().String("task-id", "", "ID of task to connect to (default: most recently started task)")
+	cmd.Flags().Bool("docker", false, "Connect to task on local docker engine")
+	cmd.Flags().Bool("ecs-fargate", false, "Connect to task on AWS ECS Fargate")
+	cmd.Flags().Bool("ec2", false, "Connect to task on AWS EC2")
+}
+
+// selectedTask is the running task chosen by the task selection flags
+type selectedTask struct {
+	gt       gltr.Task
+	config   gltr.Config
+	platform gltr.ExecutionPlatformType
+	endpoint gltr.TaskEndpoint
+	port     int
+	hostKey  ssh.PublicKey
+}
+
+// sshHostEntry returns the name of the project host entry in the gltr ssh
+// config
+func (t selectedTask) sshHostEntry() string {
+	return fmt.Sprintf("%s-%s", t.gt.ProjectName, t.platform.ToString())
+}
+
+// sshUser returns the account to log in to the task as: the user of the ssh
+// login on EC2, else the account of the caller
+func (t selectedTask) sshUser() string {
+	if t.platform == gltr.Ec2 {
+		return t.gt.Ec2SSHLogin(t.config).User
+	}
+	return t.gt.SSHUser(t.config.User)
+}
+
+// selectTask finds the task selected by the task selection flags and the
+// host key recorded for it
+func selectTask(cmd *cobra.Command) (selectedTask, error) {
+	gltrFilename, _ := cmd.Flags().GetString("file")
+	taskID, _ := cmd.Flags().GetString("task-id")
+	useDocker, _ := cmd.Flags().GetBool("docker")
+	useEcsFargate, _ := cmd.Flags().GetBool("ecs-fargate")
+	useEc2, _ := cmd.Flags().GetBool("ec2")
+
+	var t selectedTask
+	var err error
+	t.config, err = readGltrConfig(getGltrConfigDir())
+	if err != nil {
+		return t, fmt.Errorf("error reading gltr config: %w", err)
+	}
+	t.gt, err = readGltrFile(gltrFilename)
+	if err != nil {
+		return t, fmt.Errorf("error reading gltr file: %w", err)
+	}
+
+	t.platform = getExecutionPlatform(t.gt, useDocker, useEcsFargate, useEc2, false)
+	err = useProjectAWSEnvironment(&t.config, &t.gt)
+	if err == nil {
+		err = checkProjectPlatformConfig(t.config, t.gt, t.platform)
+	}
+	if err != nil {
+		return t, err
+	}
+	t.endpoint, t.port, err = gltr.FindTaskEndpoint(t.gt, t.platform, taskID)
+	if err != nil {
+		return t, err
+	}
+
+	// prefer the key of the task itself; tasks started before per-task keys
+	// were recorded only have the key of the project host entry
+	t.hostKey, err = lookupHostKey(taskHostKeyAlias(t.endpoint.TaskID))
+	if err != nil {
+		t.hostKey, err = lookupHostKey(t.sshHostEntry())
+	}
+	return t, err
+}
+
+// connectToTask finds the task selected by the task selection flags and
+// opens an ssh connection to it as the account of sshUser
+func connectToTask(cmd *cobra.Command) (*ssh.Client, gltr.Task, error) {
+	t, err := selectTask(cmd)
+	if err != nil {
+		return nil, t.gt, err
+	}
+	auths, err := gltr.SSHAuthMethods(t.config.SSH.IdentityFile)
+	if err != nil {
+		return nil, t.gt, err
+	}
+	client, err := gltr.DialTaskSSH(t.endpoint, t.config.ProviderConfiguration.AWS, t.port, t.sshUser(), auths, t.hostKey)
+	return client, t.gt, err
+}
+
+func sshCommand(cmd *cobra.Command, args []string) {
+	forwardAgent, _ := cmd.Flags().GetBool("forward-agent")
+
+	client, _, err := connectToTask(cmd)
+	if err != nil {
+		pterm.Error.Printf("Error connecting to task: %v\n", err)
+		os.Exit(1)
+	}
+	defer client.Close()
+
+	exitCode, err := gltr.RunSSHSession(client, nil, forwardAgent, true)
+	if err != nil {
+		pterm.Error.Printf("Error running shell: %v\n", err)
+		os.Exit(1)
+	}
+	client.Close()
+	os.Exit(exitCode)
+}
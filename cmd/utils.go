@@ -1,47 +1,13 @@
 package cmd
 
 import (
-	"context"
 	"fmt"
-	"io/ioutil"
-	"net/http"
 	"strconv"
 	"strings"
 
 	gltr "github.com/gltr-sh/gltr/pkg"
-	"github.com/google/go-github/github"
 )
 
-func lookupSSHKeysWithUsername(u string) (keys []string) {
-
-	request := fmt.Sprintf("https://github.com/%s.keys", u)
-	resp, err := http.Get(request)
-	if err != nil {
-		fmt.Printf("Error searching for users\n")
-	}
-
-	body, _ := ioutil.ReadAll(resp.Body)
-	keys = strings.Split(string(body), "\n")
-	fmt.Printf("response = %v\n", string(body))
-	return
-}
-
-func lookupSshKeysWithEmailAddr(e string) (key string) {
-	client := github.NewClient(nil)
-
-	ctx := context.Background()
-	// res, resp, err := client.Search.Users(ctx, "", nil)
-	query := fmt.Sprintf("q=%s", e)
-	fmt.Printf("looking up user with query %v\n", query)
-	resp, _, err := client.Search.Users(ctx, query, nil)
-	if err != nil {
-		fmt.Printf("Error searching for users\n")
-	}
-
-	fmt.Printf("response = %v\n", resp.Users)
-	return
-}
-
 var (
 	defaultContainerImage = "gltr/minimal-notebook"
 )
@@ -83,7 +49,7 @@ func initializeProjectWithDefaults(defaults gltr.Task, config gltr.Config) (proj
 		}
 	}
 
-	project.GitRepo = gltr.ReadTextInput("Enter Git Repo (public via https)", defaults.GitRepo,
+	project.GitRepo = gltr.ReadTextInput("Enter Git Repo (https or ssh URL)", defaults.GitRepo,
 		"Git repo cannot be empty")
 
 	project.Users = defaults.Users
@@ -104,3 +70,42 @@ func initializeProjectWithDefaults(defaults gltr.Task, config gltr.Config) (proj
 
 	return
 }
+
+// readAllowedCIDRs asks for the CIDRs of the user allowed to access the
+// project ports, defaulting to the caller's public address rather than
+// opening the ports to the world
+func readAllowedCIDRs() []string {
+	detectedCIDRs, err := gltr.DetectCallerCIDRs()
+	if err != nil {
+		fmt.Printf("WARNING: %v\n", err)
+	}
+	for {
+		allowedCIDRs := gltr.ReadTextInput(
+			"Enter your CIDRs allowed to access the project ports: ",
+			strings.Join(detectedCIDRs, ","),
+			"Allowed CIDRs cannot be empty",
+		)
+		cidrs, err := gltr.NormalizeCIDRs(strings.Split(allowedCIDRs, ","))
+		if err == nil {
+			return cidrs
+		}
+		fmt.Printf("%v - please try again\n", err)
+	}
+}
+
+// setAllowedCIDRs keeps the CIDRs of the user for the project in the config
+func setAllowedCIDRs(config *gltr.Config, projectID string, cidrs []string) {
+	if config.AllowedCIDRs == nil {
+		config.AllowedCIDRs = map[string][]string{}
+	}
+	config.AllowedCIDRs[projectID] = cidrs
+}
+
+// resolveAllowedCIDRs returns the given CIDRs in normalized form or, if none
+// are given, the CIDRs for the caller's public addresses
+func resolveAllowedCIDRs(cidrs []string) ([]string, error) {
+	if len(cidrs) == 0 {
+		return gltr.DetectCallerCIDRs()
+	}
+	return gltr.NormalizeCIDRs(cidrs)
+}
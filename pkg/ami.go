@@ -0,0 +1,258 @@
+package gltr
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ssm"
+)
+
+const (
+	// resolved AMIs are looked up again after a week so that new projects
+	// pick up patched images
+	amiCacheTTL = 7 * 24 * time.Hour
+
+	defaultRootVolumeSize = 40
+	defaultRootVolumeType = "gp3"
+)
+
+// the default AMIs are published by AWS and Canonical in every region under
+// these public SSM parameters, keyed by amiKind; the launch script installs
+// docker if needed. The deep learning base AMI comes with the nvidia driver
+// and the nvidia container toolkit for docker run --gpus.
+var defaultAmis = map[string]AmiSelector{
+	"cpu-x86_64": {SSMParameter: "/aws/service/canonical/ubuntu/server/22.04/stable/current/amd64/hvm/ebs-gp2/ami-id"},
+	"cpu-arm64":  {SSMParameter: "/aws/service/canonical/ubuntu/server/22.04/stable/current/arm64/hvm/ebs-gp2/ami-id"},
+	"gpu-x86_64": {SSMParameter: "/aws/service/deeplearning/ami/x86_64/base-oss-nvidia-driver-gpu-ubuntu-22.04/latest/ami-id"},
+	"gpu-arm64":  {SSMParameter: "/aws/service/deeplearning/ami/arm64/base-oss-nvidia-driver-gpu-ubuntu-22.04/latest/ami-id"},
+}
+
+// older versions of gltr init wrote these AMIs, which only exist in a single
+// region, into the config of every user as default_ami_cpu_image and
+// default_ami_gpu_image; they were never pinned by the user
+var legacyDefaultAmis = map[string]bool{
+	"ami-0a29e902d4020927e": true,
+	"ami-08f55edd71b55694a": true,
+}
+
+// UnpinLegacyDefaultAmis clears the default AMIs which older versions of gltr
+// init wrote into the config, in the default and the named AWS environments,
+// so that the AMIs are resolved in the region of the environment instead;
+// it returns whether any were cleared
+func (p *ProviderConfiguration) UnpinLegacyDefaultAmis() bool {
+	unpin := func(c *AWSConfig) bool {
+		cleared := false
+		if legacyDefaultAmis[c.DefaultAmiCPUImage] {
+			c.DefaultAmiCPUImage = ""
+			cleared = true
+		}
+		if legacyDefaultAmis[c.DefaultAmiGPUImage] {
+			c.DefaultAmiGPUImage = ""
+			cleared = true
+		}
+		return cleared
+	}
+	cleared := unpin(&p.AWS)
+	for name, e := range p.AWSEnvironments {
+		if unpin(&e) {
+			p.AWSEnvironments[name] = e
+			cleared = true
+		}
+	}
+	return cleared
+}
+
+// amiKind names the AMI cache entry, eg gpu-x86_64
+func amiKind(gpu bool, architecture string) string {
+	if gpu {
+		return "gpu-" + architecture
+	}
+	return "cpu-" + architecture
+}
+
+// IsEmpty returns true if the selector selects nothing
+func (s AmiSelector) IsEmpty() bool {
+	return s.SSMParameter == "" && s.NamePattern == ""
+}
+
+// describeImage returns the image with the given id
+func describeImage(ec2Client *ec2.EC2, imageID string) (*ec2.Image, error) {
+	describeImagesOutput, err := ec2Client.DescribeImages(&ec2.DescribeImagesInput{
+		ImageIds: []*string{aws.String(imageID)},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(describeImagesOutput.Images) == 0 {
+		return nil, fmt.Errorf("AMI %v not found", imageID)
+	}
+	return describeImagesOutput.Images[0], nil
+}
+
+// resolveAmiSelector returns the image selected by the selector in the
+// region of the session
+func resolveAmiSelector(awsSession *session.Session, ec2Client *ec2.EC2, selector AmiSelector) (*ec2.Image, error) {
+	if selector.SSMParameter != "" {
+		getParameterOutput, err := ssm.New(awsSession).GetParameter(&ssm.GetParameterInput{
+			Name: aws.String(selector.SSMParameter),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error reading SSM parameter %v: %w", selector.SSMParameter, err)
+		}
+		return describeImage(ec2Client, aws.StringValue(getParameterOutput.Parameter.Value))
+	}
+	if selector.NamePattern == "" {
+		return nil, errors.New("an AMI selector needs an SSM parameter or a name pattern")
+	}
+
+	filters := []*ec2.Filter{
+		{Name: aws.String("name"), Values: []*string{aws.String(selector.NamePattern)}},
+		{Name: aws.String("state"), Values: []*string{aws.String("available")}},
+	}
+	if selector.Architecture != "" {
+		filters = append(filters, &ec2.Filter{
+			Name:   aws.String("architecture"),
+			Values: []*string{aws.String(selector.Architecture)},
+		})
+	}
+	describeImagesOutput, err := ec2Client.DescribeImages(&ec2.DescribeImagesInput{
+		Owners:  aws.StringSlice(selector.Owners),
+		Filters: filters,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var newest *ec2.Image
+	for _, i := range describeImagesOutput.Images {
+		// creation dates are ISO 8601 timestamps, so they sort as strings
+		if newest == nil || aws.StringValue(i.CreationDate) > aws.StringValue(newest.CreationDate) {
+			newest = i
+		}
+	}
+	if newest == nil {
+		return nil, fmt.Errorf("no AMI matches %v", selector.NamePattern)
+	}
+	return newest, nil
+}
+
+func resolvedAmi(image *ec2.Image) ResolvedAmi {
+	return ResolvedAmi{
+		ImageID:        aws.StringValue(image.ImageId),
+		Name:           aws.StringValue(image.Name),
+		RootDeviceName: aws.StringValue(image.RootDeviceName),
+		ResolvedAt:     time.Now().UTC(),
+	}
+}
+
+// ResolveDefaultAmi returns the default CPU or GPU AMI for the architecture
+// in the region of the AWS config. A pinned AMI is used as is; otherwise the
+// selector (or the gltr default) is resolved and the result is cached in the
+// config per region.
+func ResolveDefaultAmi(awsConfig *AWSConfig, gpu bool, architecture string) (ResolvedAmi, error) {
+	awsSession, ec2Client, err := getEc2Client()
+	if err != nil {
+		return ResolvedAmi{}, err
+	}
+
+	pinned, selector := awsConfig.DefaultAmiCPUImage, awsConfig.CPUAmi
+	if gpu {
+		pinned, selector = awsConfig.DefaultAmiGPUImage, awsConfig.GPUAmi
+	}
+	if pinned != "" && !legacyDefaultAmis[pinned] {
+		image, err := describeImage(ec2Client, pinned)
+		if err != nil {
+			return ResolvedAmi{}, fmt.Errorf("pinned AMI %v: %w", pinned, err)
+		}
+		if err := checkImageArchitecture(image, architecture); err != nil {
+			return ResolvedAmi{}, err
+		}
+		return resolvedAmi(image), nil
+	}
+	kind := amiKind(gpu, architecture)
+	if selector.IsEmpty() {
+		var ok bool
+		selector, ok = defaultAmis[kind]
+		if !ok {
+			return ResolvedAmi{}, fmt.Errorf("no default AMI for architecture %v", architecture)
+		}
+	} else if selector.SSMParameter == "" && selector.Architecture == "" {
+		selector.Architecture = architecture
+	}
+
+	region := awsConfig.RegionName
+	if region == "" {
+		region = aws.StringValue(awsSession.Config.Region)
+	}
+	cached := awsConfig.AmiCache[region][kind]
+	if cached.ImageID != "" && time.Since(cached.ResolvedAt) < amiCacheTTL {
+		return cached, nil
+	}
+
+	image, err := resolveAmiSelector(awsSession, ec2Client, selector)
+	if err != nil {
+		return ResolvedAmi{}, err
+	}
+	if err := checkImageArchitecture(image, architecture); err != nil {
+		return ResolvedAmi{}, err
+	}
+	ami := resolvedAmi(image)
+	if awsConfig.AmiCache == nil {
+		awsConfig.AmiCache = map[string]map[string]ResolvedAmi{}
+	}
+	if awsConfig.AmiCache[region] == nil {
+		awsConfig.AmiCache[region] = map[string]ResolvedAmi{}
+	}
+	awsConfig.AmiCache[region][kind] = ami
+	return ami, nil
+}
+
+// checkImageArchitecture returns an error if the image does not run on the
+// architecture
+func checkImageArchitecture(image *ec2.Image, architecture string) error {
+	if imageArchitecture := aws.StringValue(image.Architecture); imageArchitecture != architecture {
+		return fmt.Errorf("AMI %v is built for %v, not %v", aws.StringValue(image.ImageId), imageArchitecture, architecture)
+	}
+	return nil
+}
+
+// rootBlockDeviceMapping returns the mapping for the root volume of an
+// instance launched from the image: the device name is taken from the image
+// and the size is at least the size of the image snapshot
+func rootBlockDeviceMapping(ec2Client *ec2.EC2, ec2Config Ec2ProjectConfig) (*ec2.BlockDeviceMapping, error) {
+	image, err := describeImage(ec2Client, ec2Config.DefaultImage)
+	if err != nil {
+		return nil, err
+	}
+	deviceName := aws.StringValue(image.RootDeviceName)
+	if deviceName == "" {
+		return nil, fmt.Errorf("AMI %v has no root device", ec2Config.DefaultImage)
+	}
+
+	volumeSize := int64(ec2Config.RootVolumeSize)
+	if volumeSize == 0 {
+		volumeSize = defaultRootVolumeSize
+	}
+	for _, m := range image.BlockDeviceMappings {
+		if aws.StringValue(m.DeviceName) == deviceName && m.Ebs != nil && aws.Int64Value(m.Ebs.VolumeSize) > volumeSize {
+			volumeSize = aws.Int64Value(m.Ebs.VolumeSize)
+		}
+	}
+	volumeType := ec2Config.RootVolumeType
+	if volumeType == "" {
+		volumeType = defaultRootVolumeType
+	}
+
+	return &ec2.BlockDeviceMapping{
+		DeviceName: aws.String(deviceName),
+		Ebs: &ec2.EbsBlockDevice{
+			VolumeSize: aws.Int64(volumeSize),
+			VolumeType: aws.String(volumeType),
+			// by default, delete the volume on termination...
+			DeleteOnTermination: aws.Bool(true),
+		},
+	}, nil
+}
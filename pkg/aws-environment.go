@@ -0,0 +1,333 @@
+package gltr
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// DefaultAWSEnvironment names the AWS environment held in
+// provider_configuration.aws, which uses the shared AWS config as is
+const DefaultAWSEnvironment = "default"
+
+// awsSessionConfig is the identity AWS sessions are created with; it is set
+// from the active AWS environment of the config
+type awsSessionConfig struct {
+	Profile string
+	Region  string
+	RoleArn string
+}
+
+var (
+	awsSessionMutex  sync.Mutex
+	activeAWSSession awsSessionConfig
+	cachedAWSSession *session.Session
+)
+
+// setAWSSessionConfig makes newAWSSession use the identity of the AWS
+// environment; the region of the default environment is left to the shared
+// AWS config
+func setAWSSessionConfig(awsConfig AWSConfig, named bool) {
+	sessionConfig := awsSessionConfig{
+		Profile: awsConfig.Profile,
+		RoleArn: awsConfig.RoleArn,
+	}
+	if named {
+		sessionConfig.Region = awsConfig.RegionName
+	}
+	awsSessionMutex.Lock()
+	defer awsSessionMutex.Unlock()
+	if sessionConfig != activeAWSSession {
+		activeAWSSession = sessionConfig
+		cachedAWSSession = nil
+	}
+}
+
+// newAWSSession returns a session for the active AWS environment; the
+// session is shared so that an assumed role is only assumed once
+func newAWSSession() (*session.Session, error) {
+	awsSessionMutex.Lock()
+	defer awsSessionMutex.Unlock()
+	if cachedAWSSession != nil {
+		return cachedAWSSession, nil
+	}
+
+	options := session.Options{
+		SharedConfigState: session.SharedConfigEnable,
+		Profile:           activeAWSSession.Profile,
+		// profiles which assume a role with MFA prompt for the token
+		AssumeRoleTokenProvider: stscreds.StdinTokenProvider,
+	}
+	if activeAWSSession.Region != "" {
+		options.Config.Region = aws.String(activeAWSSession.Region)
+	}
+	awsSession, err := session.NewSessionWithOptions(options)
+	if err != nil {
+		return nil, err
+	}
+	if activeAWSSession.RoleArn != "" {
+		awsSession = awsSession.Copy(&aws.Config{
+			Credentials: stscreds.NewCredentials(awsSession, activeAWSSession.RoleArn),
+		})
+	}
+	cachedAWSSession = awsSession
+	return awsSession, nil
+}
+
+// awsCommandEnv returns the environment for aws cli commands run on behalf
+// of the active AWS environment; an assumed role is passed on as temporary
+// credentials since the cli cannot assume a role without a profile
+func awsCommandEnv() ([]string, error) {
+	awsSessionMutex.Lock()
+	sessionConfig := activeAWSSession
+	awsSessionMutex.Unlock()
+	if sessionConfig.RoleArn == "" {
+		return nil, nil
+	}
+
+	awsSession, err := newAWSSession()
+	if err != nil {
+		return nil, err
+	}
+	credentials, err := awsSession.Config.Credentials.Get()
+	if err != nil {
+		return nil, fmt.Errorf("error assuming role %v: %w", sessionConfig.RoleArn, err)
+	}
+	var env []string
+	for _, e := range os.Environ() {
+		if !strings.HasPrefix(e, "AWS_PROFILE=") {
+			env = append(env, e)
+		}
+	}
+	return append(
+		env,
+		"AWS_ACCESS_KEY_ID="+credentials.AccessKeyID,
+		"AWS_SECRET_ACCESS_KEY="+credentials.SecretAccessKey,
+		"AWS_SESSION_TOKEN="+credentials.SessionToken,
+	), nil
+}
+
+// UseAWSEnvironment makes the named AWS environment the active one: its
+// config is swapped into ProviderConfiguration.AWS and AWS sessions are
+// created with its profile, region and role. The empty name selects the
+// default environment.
+func (p *ProviderConfiguration) UseAWSEnvironment(name string) error {
+	if name == "" {
+		name = DefaultAWSEnvironment
+	}
+	if name != p.ActiveAWSEnvironment() {
+		if name != DefaultAWSEnvironment {
+			if _, ok := p.AWSEnvironments[name]; !ok {
+				return fmt.Errorf(
+					"unknown AWS environment %q (configured: %v)",
+					name, strings.Join(p.AWSEnvironmentNames(), ", "),
+				)
+			}
+		}
+		*p = p.Persisted()
+		if name != DefaultAWSEnvironment {
+			p.defaultAWS = p.AWS
+			p.AWS = p.AWSEnvironments[name]
+			p.activeAWSEnvironment = name
+		}
+	}
+	setAWSSessionConfig(p.AWS, p.activeAWSEnvironment != "")
+	return nil
+}
+
+// ActiveAWSEnvironment returns the name of the active AWS environment
+func (p ProviderConfiguration) ActiveAWSEnvironment() string {
+	if p.activeAWSEnvironment == "" {
+		return DefaultAWSEnvironment
+	}
+	return p.activeAWSEnvironment
+}
+
+// Persisted returns the provider configuration as it is written to the
+// config file, with the active AWS environment back in its place
+func (p ProviderConfiguration) Persisted() ProviderConfiguration {
+	if p.activeAWSEnvironment == "" {
+		return p
+	}
+	environments := map[string]AWSConfig{}
+	for n, e := range p.AWSEnvironments {
+		environments[n] = e
+	}
+	environments[p.activeAWSEnvironment] = p.AWS
+	p.AWSEnvironments = environments
+	p.AWS = p.defaultAWS
+	p.defaultAWS = AWSConfig{}
+	p.activeAWSEnvironment = ""
+	return p
+}
+
+// AWSEnvironmentNames returns the names of all AWS environments, the
+// default environment first
+func (p ProviderConfiguration) AWSEnvironmentNames() []string {
+	var names []string
+	for n := range p.AWSEnvironments {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return append([]string{DefaultAWSEnvironment}, names...)
+}
+
+// AddAWSEnvironment adds a named AWS environment with the given identity;
+// the environment is initialized like the default one when an AWS execution
+// platform is added while it is active
+func (p *ProviderConfiguration) AddAWSEnvironment(name string, identity AWSConfig) error {
+	if name == "" || name == DefaultAWSEnvironment {
+		return fmt.Errorf("%q cannot be used as the name of an AWS environment", name)
+	}
+	if _, ok := p.AWSEnvironments[name]; ok || name == p.activeAWSEnvironment {
+		return fmt.Errorf("AWS environment %v already exists", name)
+	}
+	if p.AWSEnvironments == nil {
+		p.AWSEnvironments = map[string]AWSConfig{}
+	}
+	p.AWSEnvironments[name] = identity.Identity()
+	return nil
+}
+
+// Identity returns the part of the AWS config which selects the account and
+// region, without any of the resources gltr created
+func (c AWSConfig) Identity() AWSConfig {
+	return AWSConfig{
+		Profile:    c.Profile,
+		RegionName: c.RegionName,
+		RoleArn:    c.RoleArn,
+	}
+}
+
+// EcsClusterName returns the ECS cluster of the active AWS environment
+func (c Config) EcsClusterName() string {
+	// clusters are regional, so a named environment has its own
+	if c.ProviderConfiguration.activeAWSEnvironment != "" {
+		return c.ProviderConfiguration.AWS.ClusterName
+	}
+	if p, ok := c.GetExecutionPlatformConfig(EcsFargate).(EcsFargateConfig); ok {
+		return p.ClusterName
+	}
+	return ""
+}
+
+// Ec2KeyName returns the default EC2 key pair of the active AWS environment
+func (c Config) Ec2KeyName() string {
+	// key pairs are regional, so a named environment has its own
+	if c.ProviderConfiguration.activeAWSEnvironment != "" {
+		return c.ProviderConfiguration.AWS.KeyName
+	}
+	if p, ok := c.GetExecutionPlatformConfig(Ec2).(Ec2Config); ok {
+		return p.DefaultLoginKeyName
+	}
+	return ""
+}
+
+// ConfiguredExecutionPlatforms returns the execution platforms configured
+// for the active AWS environment; a named environment has the AWS platforms
+// for which it has a cluster or key pair
+func (c Config) ConfiguredExecutionPlatforms() []ExecutionPlatformType {
+	var platforms []ExecutionPlatformType
+	for _, e := range c.ExecutionPlatforms {
+		if c.ProviderConfiguration.activeAWSEnvironment != "" && (e.Type == Ec2 || e.Type == EcsFargate) {
+			continue
+		}
+		platforms = append(platforms, e.Type)
+	}
+	if c.ProviderConfiguration.activeAWSEnvironment != "" {
+		if c.Ec2KeyName() != "" {
+			platforms = append(platforms, Ec2)
+		}
+		if c.EcsClusterName() != "" {
+			platforms = append(platforms, EcsFargate)
+		}
+	}
+	return platforms
+}
+
+// addAWSExecutionPlatform adds an AWS execution platform to the config; in a
+// named AWS environment the key pair or cluster is kept in the environment
+// and the execution platforms of the default environment are left alone
+func (c Config) addAWSExecutionPlatform(platform ExecutionPlatform) Config {
+	if c.ProviderConfiguration.activeAWSEnvironment == "" {
+		c.ExecutionPlatforms = append(c.ExecutionPlatforms, platform)
+		return c
+	}
+	switch p := platform.Configuration.(type) {
+	case Ec2Config:
+		c.ProviderConfiguration.AWS.KeyName = p.DefaultLoginKeyName
+	case EcsFargateConfig:
+		c.ProviderConfiguration.AWS.ClusterName = p.ClusterName
+	}
+	return c
+}
+
+// UseAWSEnvironment selects the execution platform configs of the project
+// for the named AWS environment
+func (t *Task) UseAWSEnvironment(name string) {
+	t.awsEnvironment = name
+}
+
+// AWSEnvironments returns the AWS environments the project has execution
+// platform configs for
+func (t Task) AWSEnvironments() []string {
+	var names []string
+	seen := map[string]bool{}
+	for _, c := range t.ExecutionPlatformConfigs {
+		if name, ok := projectAWSEnvironment(c.Configuration); ok && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// SetExecutionPlatformProjectConfig adds the execution platform config to
+// the project, replacing an existing config of the platform; AWS platforms
+// are only replaced in the selected AWS environment
+func (t *Task) SetExecutionPlatformProjectConfig(config ExecutionPlatformProjectConfig) {
+	for i, c := range t.ExecutionPlatformConfigs {
+		if c.Type == config.Type && t.inAWSEnvironment(c.Configuration) {
+			t.ExecutionPlatformConfigs[i] = config
+			return
+		}
+	}
+	t.ExecutionPlatformConfigs = append(t.ExecutionPlatformConfigs, config)
+}
+
+// inAWSEnvironment returns false for AWS execution platform configs of
+// other AWS environments than the selected one
+func (t Task) inAWSEnvironment(c ExecutionPlatformProjectConfiguration) bool {
+	name, ok := projectAWSEnvironment(c)
+	if !ok {
+		return true
+	}
+	if t.awsEnvironment == "" {
+		return name == DefaultAWSEnvironment
+	}
+	return name == t.awsEnvironment
+}
+
+// projectAWSEnvironment returns the AWS environment of an AWS execution
+// platform config and false for other platforms
+func projectAWSEnvironment(c ExecutionPlatformProjectConfiguration) (string, bool) {
+	var name string
+	switch p := c.(type) {
+	case Ec2ProjectConfig:
+		name = p.AWSEnvironment
+	case EcsProjectConfig:
+		name = p.AWSEnvironment
+	default:
+		return "", false
+	}
+	if name == "" {
+		name = DefaultAWSEnvironment
+	}
+	return name, true
+}
@@ -1,22 +1,262 @@
 package gltr
 
 import (
+	"errors"
 	"fmt"
-	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/erikgeiser/promptkit/confirmation"
+	"github.com/samber/lo"
 )
 
-func CreateNewSecurityGroup(securityGroupName, vpcID string, ports []int) (securityGroupID string, err error) {
+// CreateNewSecurityGroup creates a gltr managed security group with the
+// given ingress rules
+func CreateNewSecurityGroup(securityGroupName, vpcID string, ingress SecurityGroupIngress) (securityGroupID string, err error) {
 	_, ec2Client, err := getEc2Client()
+	if err != nil {
+		return "", err
+	}
 
 	securityGroupID, err = createSecurityGroup(ec2Client, vpcID, securityGroupName)
+	if err != nil {
+		return "", err
+	}
+
+	_, _, err = syncSecurityGroupIngress(ec2Client, securityGroupID, ingress)
+	if err != nil {
+		return securityGroupID, fmt.Errorf("error adding security group rules: %w", err)
+	}
+	return securityGroupID, nil
+}
+
+// getEc2NameTag returns the value of the Name tag or "-" if there is none
+func getEc2NameTag(tags []*ec2.Tag) string {
+	nameTag := getEc2Tag(tags, "Name")
+	if nameTag == nil {
+		return "-"
+	}
+	return aws.StringValue(nameTag.Value)
+}
+
+// getSubnetRoutingTable returns the routing table which applies to the subnet;
+// this is the table explicitly associated with the subnet if there is one,
+// otherwise the main table of the VPC
+func getSubnetRoutingTable(svc *ec2.EC2, subnetID, vpcID string) (ec2.RouteTable, error) {
+	describeRouteTablesOutput, err := svc.DescribeRouteTables(&ec2.DescribeRouteTablesInput{
+		Filters: []*ec2.Filter{
+			{Name: aws.String("association.subnet-id"), Values: []*string{aws.String(subnetID)}},
+		},
+	})
+	if err != nil {
+		return ec2.RouteTable{}, err
+	}
+	if len(describeRouteTablesOutput.RouteTables) > 0 {
+		return *describeRouteTablesOutput.RouteTables[0], nil
+	}
+	return getRoutingTable(svc, vpcID)
+}
+
+// checkSubnetInternetAccess determines how the subnet reaches the internet:
+// public subnets route 0.0.0.0/0 through an internet gateway, private subnets
+// through a NAT gateway or some other appliance. An error is returned if
+// there is no default route at all.
+func checkSubnetInternetAccess(svc *ec2.EC2, subnetID, vpcID string) (public bool, err error) {
+	routingTable, err := getSubnetRoutingTable(svc, subnetID, vpcID)
+	if err != nil {
+		return false, err
+	}
+
+	for _, route := range routingTable.Routes {
+		if aws.StringValue(route.DestinationCidrBlock) != "0.0.0.0/0" ||
+			aws.StringValue(route.State) != "active" {
+			continue
+		}
+		if strings.HasPrefix(aws.StringValue(route.GatewayId), "igw-") {
+			return true, nil
+		}
+		if route.NatGatewayId != nil || route.TransitGatewayId != nil ||
+			route.NetworkInterfaceId != nil || route.InstanceId != nil {
+			return false, nil
+		}
+	}
+	return false, fmt.Errorf("subnet %v has no active route to the internet", subnetID)
+}
+
+func selectExistingVpc(svc *ec2.EC2) (vpcID string, err error) {
+	describeVpcsOutput, err := svc.DescribeVpcs(&ec2.DescribeVpcsInput{})
+	if err != nil {
+		return "", err
+	}
+	if len(describeVpcsOutput.Vpcs) == 0 {
+		return "", errors.New("no VPCs found in this region")
+	}
+
+	options := map[string]string{}
+	var labels []string
+	for _, v := range describeVpcsOutput.Vpcs {
+		label := fmt.Sprintf(
+			"%v (%v, %v)",
+			aws.StringValue(v.VpcId),
+			getEc2NameTag(v.Tags),
+			aws.StringValue(v.CidrBlock),
+		)
+		options[label] = aws.StringValue(v.VpcId)
+		labels = append(labels, label)
+	}
+	vpcLabel := ReadOptionInput("Select VPC", "", labels)
+	return options[vpcLabel], nil
+}
+
+func selectExistingSubnets(svc *ec2.EC2, vpcID string) (subnets []AWSSubnetConfig, err error) {
+	describeSubnetsOutput, err := svc.DescribeSubnets(&ec2.DescribeSubnetsInput{
+		Filters: []*ec2.Filter{{Name: aws.String("vpc-id"), Values: []*string{aws.String(vpcID)}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	options := map[string]*ec2.Subnet{}
+	var labels []string
+	for _, s := range describeSubnetsOutput.Subnets {
+		label := fmt.Sprintf(
+			"%v (%v, %v, %v)",
+			aws.StringValue(s.SubnetId),
+			getEc2NameTag(s.Tags),
+			aws.StringValue(s.AvailabilityZone),
+			aws.StringValue(s.CidrBlock),
+		)
+		options[label] = s
+		labels = append(labels, label)
+	}
+
+	for len(labels) > 0 {
+		subnetLabel := ReadOptionInput("Select subnet", "", labels)
+		s := options[subnetLabel]
+		subnetID := aws.StringValue(s.SubnetId)
+
+		public, err := checkSubnetInternetAccess(svc, subnetID, vpcID)
+		if err != nil {
+			fmt.Printf("Cannot use subnet: %v\n", err)
+		} else {
+			if public {
+				fmt.Printf("Subnet %v is public (internet gateway route found)\n", subnetID)
+			} else {
+				fmt.Printf("Subnet %v is private (NAT route found) - workspaces will not get a public IP\n", subnetID)
+			}
+			subnets = append(subnets, AWSSubnetConfig{
+				SubnetID:         subnetID,
+				AvailabilityZone: aws.StringValue(s.AvailabilityZone),
+				Public:           public,
+			})
+		}
+		labels = lo.Without(labels, subnetLabel)
+
+		if len(subnets) > 0 && !ReadConfirmationInput("Add another subnet", confirmation.No) {
+			break
+		}
+	}
+
+	if len(subnets) == 0 {
+		return nil, fmt.Errorf("no subnet with internet access selected in vpc %v", vpcID)
+	}
+	return subnets, nil
+}
+
+func selectExistingSecurityGroups(svc *ec2.EC2, vpcID string) (securityGroupIDs []string, err error) {
+	if !ReadConfirmationInput("Use existing security groups for workspaces", confirmation.No) {
+		return nil, nil
+	}
+
+	describeSecurityGroupsOutput, err := svc.DescribeSecurityGroups(&ec2.DescribeSecurityGroupsInput{
+		Filters: []*ec2.Filter{{Name: aws.String("vpc-id"), Values: []*string{aws.String(vpcID)}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	options := map[string]string{}
+	var labels []string
+	for _, s := range describeSecurityGroupsOutput.SecurityGroups {
+		label := fmt.Sprintf("%v (%v)", aws.StringValue(s.GroupId), aws.StringValue(s.GroupName))
+		options[label] = aws.StringValue(s.GroupId)
+		labels = append(labels, label)
+	}
+
+	for len(labels) > 0 {
+		securityGroupLabel := ReadOptionInput("Select security group", "", labels)
+		securityGroupIDs = append(securityGroupIDs, options[securityGroupLabel])
+		labels = lo.Without(labels, securityGroupLabel)
+
+		if !ReadConfirmationInput("Add another security group", confirmation.No) {
+			break
+		}
+	}
+	return securityGroupIDs, nil
+}
+
+// configureExistingNetwork lets the user choose a pre-provisioned VPC, one or
+// more subnets and optionally security groups for gltr to use. These are
+// marked as externally managed so that gltr never removes them.
+func configureExistingNetwork(awsSession *session.Session, config *AWSConfig) (err error) {
+	svc := ec2.New(awsSession)
+
+	config.VpcID, err = selectExistingVpc(svc)
+	if err != nil {
+		return fmt.Errorf("error selecting VPC: %w", err)
+	}
+
+	config.Subnets, err = selectExistingSubnets(svc, config.VpcID)
+	if err != nil {
+		return fmt.Errorf("error selecting subnets: %w", err)
+	}
+	config.SubnetID = config.Subnets[0].SubnetID
+
+	config.SecurityGroupIDs, err = selectExistingSecurityGroups(svc, config.VpcID)
+	if err != nil {
+		return fmt.Errorf("error selecting security groups: %w", err)
+	}
+
+	config.IgwID = ""
+	config.ExternallyManaged = true
+	return nil
+}
+
+// validateExistingNetwork checks that the externally managed VPC, subnets and
+// security groups in the config still exist and that the subnets still have
+// a route to the internet
+func validateExistingNetwork(awsSession *session.Session, config *AWSConfig) error {
+	svc := ec2.New(awsSession)
+
+	_, err := svc.DescribeVpcs(&ec2.DescribeVpcsInput{VpcIds: []*string{aws.String(config.VpcID)}})
+	if err != nil {
+		return fmt.Errorf("error checking VPC %v: %w", config.VpcID, err)
+	}
+
+	_, err = svc.DescribeSubnets(&ec2.DescribeSubnetsInput{
+		SubnetIds: aws.StringSlice(config.GetSubnetIDs()),
+	})
+	if err != nil {
+		return fmt.Errorf("error checking subnets: %w", err)
+	}
+	for i, s := range config.Subnets {
+		config.Subnets[i].Public, err = checkSubnetInternetAccess(svc, s.SubnetID, config.VpcID)
+		if err != nil {
+			return err
+		}
+	}
 
-	for _, p := range ports {
-		err = addSecurityGroupRule(ec2Client, securityGroupID, p)
+	if len(config.SecurityGroupIDs) > 0 {
+		_, err = svc.DescribeSecurityGroups(&ec2.DescribeSecurityGroupsInput{
+			GroupIds: aws.StringSlice(config.SecurityGroupIDs),
+		})
 		if err != nil {
-			fmt.Printf("Error adding security group rules to security group %v\n", err)
-			os.Exit(1)
+			return fmt.Errorf("error checking security groups: %w", err)
 		}
 	}
-	return
 
+	fmt.Printf("Using existing VPC id=%v with subnets %v\n", config.VpcID, config.GetSubnetIDs())
+	return nil
 }
@@ -0,0 +1,177 @@
+package gltr
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/pterm/pterm"
+)
+
+const (
+	bastionName         = "gltr-bastion"
+	bastionInstanceType = "t3.micro"
+	bastionUser         = "ec2-user"
+	// AWS publishes the latest Amazon Linux AMI for each region under this
+	// public SSM parameter
+	bastionAmiParameter = "/aws/service/ami-amazon-linux-latest/al2023-ami-kernel-default-x86_64"
+)
+
+// getPublicSubnet returns a subnet with a route to the internet gateway
+// which the bastion can be launched into
+func getPublicSubnet(awsConfig AWSConfig) (string, error) {
+	if !awsConfig.ExternallyManaged {
+		// the subnet created by gltr init is always public
+		return awsConfig.SubnetID, nil
+	}
+	for _, s := range awsConfig.Subnets {
+		if s.Public {
+			return s.SubnetID, nil
+		}
+	}
+	return "", errors.New("no public subnet configured - a bastion needs a subnet with an internet gateway route")
+}
+
+// bastionIngress returns the ingress rules for the bastion security group
+func bastionIngress(allowedCIDRs []string) SecurityGroupIngress {
+	return SecurityGroupIngress{Ports: []int{22}, CIDRs: allowedCIDRs}
+}
+
+// CreateBastion launches a small instance with a public IP address in a
+// public subnet; tasks in private subnets are reached by jumping through it.
+// Only the allowed CIDRs can reach the bastion.
+func CreateBastion(awsConfig AWSConfig, keyName string, allowedCIDRs []string) (AWSBastionConfig, error) {
+	awsSession, ec2Client, err := getEc2Client()
+	if err != nil {
+		return AWSBastionConfig{}, err
+	}
+
+	subnetID, err := getPublicSubnet(awsConfig)
+	if err != nil {
+		return AWSBastionConfig{}, err
+	}
+
+	getParameterOutput, err := ssm.New(awsSession).GetParameter(&ssm.GetParameterInput{
+		Name: aws.String(bastionAmiParameter),
+	})
+	if err != nil {
+		return AWSBastionConfig{}, fmt.Errorf("error looking up bastion AMI: %w", err)
+	}
+	amiID := aws.StringValue(getParameterOutput.Parameter.Value)
+
+	hostKey, err := GenerateHostKey()
+	if err != nil {
+		return AWSBastionConfig{}, err
+	}
+	userData, err := hostKeyUserData(hostKey)
+	if err != nil {
+		return AWSBastionConfig{}, err
+	}
+
+	securityGroupID, err := CreateNewSecurityGroup(bastionName, awsConfig.VpcID, bastionIngress(allowedCIDRs))
+	bastion := AWSBastionConfig{
+		SecurityGroupID: securityGroupID,
+		User:            bastionUser,
+		AllowedCIDRs:    allowedCIDRs,
+		HostKey:         hostKey.AuthorizedKey(),
+	}
+	if err != nil {
+		return bastion, fmt.Errorf("error creating bastion security group: %w", err)
+	}
+
+	pterm.Info.Printf("Launching bastion instance (AMI %v)...\n", amiID)
+	runInstancesOutput, err := ec2Client.RunInstances(&ec2.RunInstancesInput{
+		ImageId:      aws.String(amiID),
+		InstanceType: aws.String(bastionInstanceType),
+		MinCount:     aws.Int64(1),
+		MaxCount:     aws.Int64(1),
+		KeyName:      aws.String(keyName),
+		UserData:     aws.String(userData),
+		NetworkInterfaces: []*ec2.InstanceNetworkInterfaceSpecification{
+			{
+				SubnetId:                 aws.String(subnetID),
+				AssociatePublicIpAddress: aws.Bool(true),
+				DeviceIndex:              aws.Int64(0),
+				Groups:                   []*string{aws.String(securityGroupID)},
+			},
+		},
+		TagSpecifications: []*ec2.TagSpecification{
+			{
+				ResourceType: aws.String("instance"),
+				Tags: []*ec2.Tag{
+					{Key: aws.String("Name"), Value: aws.String(bastionName)},
+					{Key: aws.String("gltr-managed"), Value: aws.String("true")},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return bastion, fmt.Errorf("error launching bastion: %w", err)
+	}
+	bastion.InstanceID = aws.StringValue(runInstancesOutput.Instances[0].InstanceId)
+
+	spinner, _ := pterm.DefaultSpinner.Start("Waiting for bastion to reach RUNNING state...")
+	describeInstancesInput := ec2.DescribeInstancesInput{InstanceIds: []*string{aws.String(bastion.InstanceID)}}
+	err = ec2Client.WaitUntilInstanceRunning(&describeInstancesInput)
+	if err != nil {
+		spinner.Fail("Timed out waiting for bastion to start")
+		return bastion, err
+	}
+	describeInstancesOutput, err := ec2Client.DescribeInstances(&describeInstancesInput)
+	if err != nil {
+		spinner.Fail("Error obtaining bastion info")
+		return bastion, err
+	}
+	instance := describeInstancesOutput.Reservations[0].Instances[0]
+	bastion.Host = aws.StringValue(instance.PublicDnsName)
+	if bastion.Host == "" {
+		bastion.Host = aws.StringValue(instance.PublicIpAddress)
+	}
+	spinner.Success(fmt.Sprintf("Bastion running (id: %v, host: %v)", bastion.InstanceID, bastion.Host))
+	return bastion, nil
+}
+
+// UpdateBastionIngress restricts access to the bastion to the allowed CIDRs
+func UpdateBastionIngress(bastion AWSBastionConfig) error {
+	return SyncSecurityGroupIngress(bastion.SecurityGroupID, bastionIngress(bastion.AllowedCIDRs))
+}
+
+// RemoveBastion terminates the bastion instance and removes its security group
+func RemoveBastion(bastion AWSBastionConfig) error {
+	_, ec2Client, err := getEc2Client()
+	if err != nil {
+		return err
+	}
+
+	if bastion.InstanceID != "" {
+		_, err = ec2Client.TerminateInstances(&ec2.TerminateInstancesInput{
+			InstanceIds: []*string{aws.String(bastion.InstanceID)},
+		})
+		if err != nil && !isAwsErrorCode(err, "InvalidInstanceID.NotFound") {
+			return fmt.Errorf("error terminating bastion: %w", err)
+		}
+		if err == nil {
+			spinner, _ := pterm.DefaultSpinner.Start("Waiting for bastion to terminate...")
+			err = ec2Client.WaitUntilInstanceTerminated(&ec2.DescribeInstancesInput{
+				InstanceIds: []*string{aws.String(bastion.InstanceID)},
+			})
+			if err != nil {
+				spinner.Fail("Timed out waiting for bastion to terminate")
+				return err
+			}
+			spinner.Success(fmt.Sprintf("Bastion %v terminated", bastion.InstanceID))
+		}
+	}
+
+	if bastion.SecurityGroupID != "" {
+		_, err = ec2Client.DeleteSecurityGroup(&ec2.DeleteSecurityGroupInput{
+			GroupId: aws.String(bastion.SecurityGroupID),
+		})
+		if err != nil && !isAwsErrorCode(err, "InvalidGroup.NotFound") {
+			return fmt.Errorf("error removing bastion security group: %w", err)
+		}
+	}
+	return nil
+}
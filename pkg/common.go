@@ -5,6 +5,7 @@ import (
 	"log"
 	"os"
 
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/aws/aws-sdk-go/service/ecs"
@@ -12,9 +13,7 @@ import (
 
 func getEcsClient() (awsSession *session.Session, ecsClient *ecs.ECS, err error) {
 	// initialize AWS session
-	awsSession, err = session.NewSessionWithOptions(session.Options{
-		SharedConfigState: session.SharedConfigEnable,
-	})
+	awsSession, err = newAWSSession()
 
 	if err != nil {
 		fmt.Printf("Error initializing AWS session: %v\n", err)
@@ -28,9 +27,7 @@ func getEcsClient() (awsSession *session.Session, ecsClient *ecs.ECS, err error)
 
 func getEc2Client() (awsSession *session.Session, ec2Client *ec2.EC2, err error) {
 	// initialize AWS session
-	awsSession, err = session.NewSessionWithOptions(session.Options{
-		SharedConfigState: session.SharedConfigEnable,
-	})
+	awsSession, err = newAWSSession()
 
 	if err != nil {
 		log.Printf("Error initializing AWS session: %v", err)
@@ -60,3 +57,11 @@ func getCluster(ecsClient *ecs.ECS, clusterName string) (cluster *ecs.Cluster, e
 	cluster = clusters.Clusters[0]
 	return
 }
+
+// isAwsErrorCode returns true if err is an AWS error with the given code
+func isAwsErrorCode(err error, code string) bool {
+	if aerr, ok := err.(awserr.Error); ok {
+		return aerr.Code() == code
+	}
+	return false
+}
@@ -66,20 +66,21 @@ func getKeyList(session *session.Session) ([]string, error) {
 	return keypairs, nil
 }
 
-func ConfigAddEc2ExecutionPlatform(config Config) (Config, error) {
+// ConfigAddEc2ExecutionPlatform adds the Ec2 execution platform to the config,
+// initializing AWS first if necessary; saveAWSConfig is used to persist the
+// progress of the AWS initialization.
+func ConfigAddEc2ExecutionPlatform(config Config, saveAWSConfig func(AWSConfig) error) (Config, error) {
 
 	// create session
-	awsSession, err := session.NewSessionWithOptions(session.Options{
-		SharedConfigState: session.SharedConfigEnable,
-	})
+	awsSession, err := newAWSSession()
 	if err != nil {
 		fmt.Printf("Error initializing AWS session: %v", err)
 		return Config{}, err
 	}
 
-	var awsConfig AWSConfig
-	if !config.ProviderConfiguration.AWS.Initialized {
-		awsConfig, err = InitializeAWS()
+	awsConfig := config.ProviderConfiguration.AWS
+	if !awsConfig.Initialized {
+		awsConfig, err = InitializeAWS(awsConfig, saveAWSConfig)
 		if err != nil {
 			return Config{}, err
 		}
@@ -93,16 +94,13 @@ func ConfigAddEc2ExecutionPlatform(config Config) (Config, error) {
 	}
 	// assume that a check has been done before calling this function that
 	// no ecsfargateconfig exists
-	config.ExecutionPlatforms = append(config.ExecutionPlatforms, ec2Config)
-	return config, nil
+	return config.addAWSExecutionPlatform(ec2Config), nil
 }
 
 func initializeEc2(awsConfig AWSConfig, awsSession *session.Session) (ExecutionPlatform, error) {
 
 	// create session
-	awsSession, err := session.NewSessionWithOptions(session.Options{
-		SharedConfigState: session.SharedConfigEnable,
-	})
+	awsSession, err := newAWSSession()
 	if err != nil {
 		fmt.Printf("Error initializing AWS session: %v", err)
 		return ExecutionPlatform{}, err
@@ -142,21 +140,20 @@ func initializeEcsFargate(awsConfig AWSConfig, awsSession *session.Session) (Exe
 	}, nil
 }
 
-func ConfigAddEcsFargateExecutionPlatform(config Config) (Config, error) {
+// ConfigAddEcsFargateExecutionPlatform adds the ECS Fargate execution platform
+// to the config, initializing AWS first if necessary; saveAWSConfig is used
+// to persist the progress of the AWS initialization.
+func ConfigAddEcsFargateExecutionPlatform(config Config, saveAWSConfig func(AWSConfig) error) (Config, error) {
 	// first check if config contains a valid AWS config...
-	var awsConfig AWSConfig
-	var err error
-
-	awsSession, err := session.NewSessionWithOptions(session.Options{
-		SharedConfigState: session.SharedConfigEnable,
-	})
+	awsSession, err := newAWSSession()
 	if err != nil {
 		fmt.Printf("Error initializing AWS session: %v", err)
 		return Config{}, err
 	}
 
-	if !config.ProviderConfiguration.AWS.Initialized {
-		awsConfig, err = InitializeAWS()
+	awsConfig := config.ProviderConfiguration.AWS
+	if !awsConfig.Initialized {
+		awsConfig, err = InitializeAWS(awsConfig, saveAWSConfig)
 		if err != nil {
 			return Config{}, err
 		}
@@ -170,6 +167,5 @@ func ConfigAddEcsFargateExecutionPlatform(config Config) (Config, error) {
 	}
 	// assume that a check has been done before calling this function that
 	// no ecsfargateconfig exists
-	config.ExecutionPlatforms = append(config.ExecutionPlatforms, ecsFargateConfig)
-	return config, nil
+	return config.addAWSExecutionPlatform(ecsFargateConfig), nil
 }
@@ -0,0 +1,406 @@
+package gltr
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// hosting services which deploy keys can be registered with
+const (
+	GitProviderGitHub    = "github"
+	GitProviderGitLab    = "gitlab"
+	GitProviderBitbucket = "bitbucket"
+)
+
+// GitProviders lists the values of git_provider.type in gltr.yaml
+var GitProviders = []string{GitProviderGitHub, GitProviderGitLab, GitProviderBitbucket}
+
+// ErrReadOnlyDeployKeys is returned for providers whose deploy keys cannot push
+var ErrReadOnlyDeployKeys = errors.New("deploy keys are read-only")
+
+// DeployKeyProvider registers ssh keys with the hosting service of a git
+// repository which give access to that repository only
+type DeployKeyProvider interface {
+	// AddDeployKey registers the key unless it already is registered
+	AddDeployKey(repo GitURL, title string, publicKey string, readOnly bool) error
+	// RemoveDeployKey removes the key if it is registered
+	RemoveDeployKey(repo GitURL, publicKey string) error
+	// String describes the provider in messages
+	String() string
+}
+
+// NewDeployKeyProvider returns the provider of the repository; the type and
+// API URL of the settings are derived from the repository host if empty,
+// which only works for github.com, gitlab.com and bitbucket.org. Tokens are
+// read from the environment.
+func NewDeployKeyProvider(settings GitProviderSettings, repo GitURL) (DeployKeyProvider, error) {
+	providerType := settings.Type
+	if providerType == "" {
+		switch strings.ToLower(repo.Host) {
+		case "github.com":
+			providerType = GitProviderGitHub
+		case "gitlab.com":
+			providerType = GitProviderGitLab
+		case "bitbucket.org":
+			providerType = GitProviderBitbucket
+		default:
+			return nil, fmt.Errorf(
+				"the git provider of %v is not known, it must be given as one of %v",
+				repo.Host, strings.Join(GitProviders, ", "),
+			)
+		}
+	}
+	apiURL := strings.TrimSuffix(settings.APIURL, "/")
+	client := &http.Client{Timeout: 30 * time.Second}
+	switch providerType {
+	case GitProviderGitHub:
+		if apiURL == "" {
+			apiURL = "https://api.github.com"
+			if !strings.EqualFold(repo.Host, "github.com") {
+				// GitHub Enterprise Server
+				apiURL = fmt.Sprintf("https://%v/api/v3", repo.Host)
+			}
+		}
+		token := os.Getenv("GITHUB_TOKEN")
+		if token == "" {
+			token = os.Getenv("GH_TOKEN")
+		}
+		if token == "" {
+			return nil, fmt.Errorf("GITHUB_TOKEN must be set to a token which can administer %v", repo.RepoPath())
+		}
+		return &GitHubDeployKeys{APIURL: apiURL, Token: token, Client: client}, nil
+	case GitProviderGitLab:
+		if apiURL == "" {
+			apiURL = fmt.Sprintf("https://%v/api/v4", repo.Host)
+		}
+		token := os.Getenv("GITLAB_TOKEN")
+		if token == "" {
+			return nil, fmt.Errorf("GITLAB_TOKEN must be set to a token with the api scope for %v", repo.RepoPath())
+		}
+		return &GitLabDeployKeys{APIURL: apiURL, Token: token, Client: client}, nil
+	case GitProviderBitbucket:
+		if apiURL == "" {
+			apiURL = "https://api.bitbucket.org/2.0"
+		}
+		username, password := os.Getenv("BITBUCKET_USERNAME"), os.Getenv("BITBUCKET_APP_PASSWORD")
+		token := os.Getenv("BITBUCKET_TOKEN")
+		if token == "" && (username == "" || password == "") {
+			return nil, fmt.Errorf(
+				"BITBUCKET_TOKEN or BITBUCKET_USERNAME and BITBUCKET_APP_PASSWORD must be set to credentials which can administer %v",
+				repo.RepoPath(),
+			)
+		}
+		return &BitbucketDeployKeys{
+			APIURL: apiURL, Token: token, Username: username, Password: password, Client: client,
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown git provider %v, must be one of %v", providerType, strings.Join(GitProviders, ", "))
+}
+
+// GitHubDeployKeys manages deploy keys with the GitHub REST API
+type GitHubDeployKeys struct {
+	APIURL string
+	Token  string
+	Client *http.Client
+}
+
+type gitHubDeployKey struct {
+	ID       int64  `json:"id,omitempty"`
+	Title    string `json:"title"`
+	Key      string `json:"key"`
+	ReadOnly bool   `json:"read_only"`
+}
+
+func (p *GitHubDeployKeys) String() string {
+	return "GitHub at " + p.APIURL
+}
+
+func (p *GitHubDeployKeys) keysURL(repo GitURL) string {
+	return fmt.Sprintf("%v/repos/%v/keys", p.APIURL, repo.RepoPath())
+}
+
+func (p *GitHubDeployKeys) authorize(req *http.Request) {
+	req.Header.Set("Authorization", "Bearer "+p.Token)
+	req.Header.Set("Accept", "application/vnd.github+json")
+}
+
+// find returns the registered key or nil, following the pages of the keys
+// in the Link header
+func (p *GitHubDeployKeys) find(repo GitURL, publicKey string) (*gitHubDeployKey, error) {
+	for pageURL := p.keysURL(repo) + "?per_page=100"; pageURL != ""; {
+		var keys []gitHubDeployKey
+		header, err := deployKeyResponse(p.Client, p.authorize, http.MethodGet, pageURL, nil, &keys)
+		if err != nil {
+			return nil, err
+		}
+		for i := range keys {
+			if sameSSHKey(keys[i].Key, publicKey) {
+				return &keys[i], nil
+			}
+		}
+		pageURL = nextPageLink(header)
+	}
+	return nil, nil
+}
+
+// AddDeployKey registers the key unless it already is registered
+func (p *GitHubDeployKeys) AddDeployKey(repo GitURL, title string, publicKey string, readOnly bool) error {
+	existing, err := p.find(repo, publicKey)
+	if err != nil || existing != nil {
+		return err
+	}
+	key := gitHubDeployKey{Title: title, Key: publicKey, ReadOnly: readOnly}
+	return deployKeyRequest(p.Client, p.authorize, http.MethodPost, p.keysURL(repo), key, nil)
+}
+
+// RemoveDeployKey removes the key if it is registered
+func (p *GitHubDeployKeys) RemoveDeployKey(repo GitURL, publicKey string) error {
+	existing, err := p.find(repo, publicKey)
+	if err != nil || existing == nil {
+		return err
+	}
+	return deployKeyRequest(p.Client, p.authorize, http.MethodDelete, fmt.Sprintf("%v/%v", p.keysURL(repo), existing.ID), nil, nil)
+}
+
+// GitLabDeployKeys manages deploy keys with the GitLab REST API
+type GitLabDeployKeys struct {
+	APIURL string
+	Token  string
+	Client *http.Client
+}
+
+type gitLabDeployKey struct {
+	ID      int64  `json:"id,omitempty"`
+	Title   string `json:"title"`
+	Key     string `json:"key"`
+	CanPush bool   `json:"can_push"`
+}
+
+func (p *GitLabDeployKeys) String() string {
+	return "GitLab at " + p.APIURL
+}
+
+// projects are addressed by their url encoded path, which includes the
+// slashes between groups
+func (p *GitLabDeployKeys) keysURL(repo GitURL) string {
+	project := strings.ReplaceAll(url.PathEscape(repo.RepoPath()), "/", "%2F")
+	return fmt.Sprintf("%v/projects/%v/deploy_keys", p.APIURL, project)
+}
+
+func (p *GitLabDeployKeys) authorize(req *http.Request) {
+	req.Header.Set("PRIVATE-TOKEN", p.Token)
+}
+
+// find returns the registered key or nil, following the pages of the keys
+// in the Link header
+func (p *GitLabDeployKeys) find(repo GitURL, publicKey string) (*gitLabDeployKey, error) {
+	for pageURL := p.keysURL(repo) + "?per_page=100"; pageURL != ""; {
+		var keys []gitLabDeployKey
+		header, err := deployKeyResponse(p.Client, p.authorize, http.MethodGet, pageURL, nil, &keys)
+		if err != nil {
+			return nil, err
+		}
+		for i := range keys {
+			if sameSSHKey(keys[i].Key, publicKey) {
+				return &keys[i], nil
+			}
+		}
+		pageURL = nextPageLink(header)
+	}
+	return nil, nil
+}
+
+// AddDeployKey registers the key unless it already is registered
+func (p *GitLabDeployKeys) AddDeployKey(repo GitURL, title string, publicKey string, readOnly bool) error {
+	existing, err := p.find(repo, publicKey)
+	if err != nil || existing != nil {
+		return err
+	}
+	key := gitLabDeployKey{Title: title, Key: publicKey, CanPush: !readOnly}
+	return deployKeyRequest(p.Client, p.authorize, http.MethodPost, p.keysURL(repo), key, nil)
+}
+
+// RemoveDeployKey removes the key if it is registered
+func (p *GitLabDeployKeys) RemoveDeployKey(repo GitURL, publicKey string) error {
+	existing, err := p.find(repo, publicKey)
+	if err != nil || existing == nil {
+		return err
+	}
+	return deployKeyRequest(p.Client, p.authorize, http.MethodDelete, fmt.Sprintf("%v/%v", p.keysURL(repo), existing.ID), nil, nil)
+}
+
+// BitbucketDeployKeys manages deploy keys with the Bitbucket Cloud REST API;
+// they are always read-only. Either an access token or a username with an
+// app password authorize the requests.
+type BitbucketDeployKeys struct {
+	APIURL   string
+	Token    string
+	Username string
+	Password string
+	Client   *http.Client
+}
+
+type bitbucketDeployKey struct {
+	ID    int64  `json:"id,omitempty"`
+	Label string `json:"label"`
+	Key   string `json:"key"`
+}
+
+func (p *BitbucketDeployKeys) String() string {
+	return "Bitbucket at " + p.APIURL
+}
+
+func (p *BitbucketDeployKeys) keysURL(repo GitURL) string {
+	return fmt.Sprintf("%v/repositories/%v/deploy-keys", p.APIURL, repo.RepoPath())
+}
+
+func (p *BitbucketDeployKeys) authorize(req *http.Request) {
+	if p.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.Token)
+		return
+	}
+	req.SetBasicAuth(p.Username, p.Password)
+}
+
+// find returns the registered key or nil, following the next links of the
+// pages of the keys
+func (p *BitbucketDeployKeys) find(repo GitURL, publicKey string) (*bitbucketDeployKey, error) {
+	for pageURL := p.keysURL(repo) + "?pagelen=100"; pageURL != ""; {
+		var page struct {
+			Values []bitbucketDeployKey `json:"values"`
+			Next   string               `json:"next"`
+		}
+		if err := deployKeyRequest(p.Client, p.authorize, http.MethodGet, pageURL, nil, &page); err != nil {
+			return nil, err
+		}
+		for i := range page.Values {
+			if sameSSHKey(page.Values[i].Key, publicKey) {
+				return &page.Values[i], nil
+			}
+		}
+		pageURL = page.Next
+	}
+	return nil, nil
+}
+
+// AddDeployKey registers the key unless it already is registered
+func (p *BitbucketDeployKeys) AddDeployKey(repo GitURL, title string, publicKey string, readOnly bool) error {
+	if !readOnly {
+		return fmt.Errorf("bitbucket: %w, pushing needs a forwarded agent", ErrReadOnlyDeployKeys)
+	}
+	existing, err := p.find(repo, publicKey)
+	if err != nil || existing != nil {
+		return err
+	}
+	key := bitbucketDeployKey{Label: title, Key: publicKey}
+	return deployKeyRequest(p.Client, p.authorize, http.MethodPost, p.keysURL(repo), key, nil)
+}
+
+// RemoveDeployKey removes the key if it is registered
+func (p *BitbucketDeployKeys) RemoveDeployKey(repo GitURL, publicKey string) error {
+	existing, err := p.find(repo, publicKey)
+	if err != nil || existing == nil {
+		return err
+	}
+	return deployKeyRequest(p.Client, p.authorize, http.MethodDelete, fmt.Sprintf("%v/%v", p.keysURL(repo), existing.ID), nil, nil)
+}
+
+// deployKeyRequest sends a JSON request to the API of a provider and decodes
+// the response into out if it is not nil
+func deployKeyRequest(
+	client *http.Client,
+	authorize func(*http.Request),
+	method string,
+	url string,
+	in interface{},
+	out interface{},
+) error {
+	_, err := deployKeyResponse(client, authorize, method, url, in, out)
+	return err
+}
+
+// deployKeyResponse is deployKeyRequest which also returns the headers of
+// the response, eg for their links to further pages
+func deployKeyResponse(
+	client *http.Client,
+	authorize func(*http.Request),
+	method string,
+	url string,
+	in interface{},
+	out interface{},
+) (http.Header, error) {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	authorize(req)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error accessing deploy keys: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("error reading response of %v: %w", url, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("%v %v returned %v: %s", method, url, resp.Status, bytes.TrimSpace(data))
+	}
+	if out == nil {
+		return resp.Header, nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return nil, fmt.Errorf("error decoding response of %v: %w", url, err)
+	}
+	return resp.Header, nil
+}
+
+// nextPageLink returns the URL of the next page from the Link header of a
+// response, as GitHub and GitLab paginate, or "" on the last page
+func nextPageLink(header http.Header) string {
+	for _, link := range strings.Split(strings.Join(header.Values("Link"), ","), ",") {
+		parts := strings.Split(link, ";")
+		target := strings.TrimSpace(parts[0])
+		if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+			continue
+		}
+		for _, param := range parts[1:] {
+			name, value, found := strings.Cut(strings.TrimSpace(param), "=")
+			if !found || !strings.EqualFold(strings.TrimSpace(name), "rel") {
+				continue
+			}
+			for _, rel := range strings.Fields(strings.Trim(strings.TrimSpace(value), `"`)) {
+				if strings.EqualFold(rel, "next") {
+					return strings.TrimSuffix(strings.TrimPrefix(target, "<"), ">")
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// sameSSHKey compares the type and key of two authorized_keys lines,
+// ignoring their comments
+func sameSSHKey(a, b string) bool {
+	fa, fb := strings.Fields(a), strings.Fields(b)
+	return len(fa) >= 2 && len(fb) >= 2 && fa[0] == fb[0] && fa[1] == fb[1]
+}
@@ -0,0 +1,121 @@
+package gltr
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// fakeDeployKeys serves keys two to a page, paginated as the provider does,
+// and records the keys deleted and added
+type fakeDeployKeys struct {
+	provider string
+	keys     []string
+	deleted  []string
+	added    int
+}
+
+func (f *fakeDeployKeys) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		f.added++
+		return
+	case http.MethodDelete:
+		f.deleted = append(f.deleted, r.URL.Path)
+		return
+	}
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page == 0 {
+		page = 1
+	}
+	var values []map[string]interface{}
+	for i := (page - 1) * 2; i < len(f.keys) && i < page*2; i++ {
+		values = append(values, map[string]interface{}{"id": i + 1, "key": f.keys[i]})
+	}
+	next := ""
+	if page*2 < len(f.keys) {
+		next = fmt.Sprintf("http://%v%v?page=%v", r.Host, r.URL.Path, page+1)
+	}
+	if f.provider == GitProviderBitbucket {
+		json.NewEncoder(w).Encode(map[string]interface{}{"values": values, "next": next})
+		return
+	}
+	if next != "" {
+		w.Header().Add("Link", fmt.Sprintf(`<%v>; rel="next", <http://%v%v?page=9>; rel="last"`, next, r.Host, r.URL.Path))
+	}
+	json.NewEncoder(w).Encode(values)
+}
+
+func TestDeployKeysPagination(t *testing.T) {
+	repo, err := ParseGitURL("git@example.com:owner/repo.git")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for i := 0; i < 5; i++ {
+		keys = append(keys, newTestPublicKey(t, fmt.Sprintf("key-%v", i)))
+	}
+	lastKey := keys[4]
+
+	for _, providerType := range GitProviders {
+		t.Run(providerType, func(t *testing.T) {
+			fake := &fakeDeployKeys{provider: providerType, keys: keys}
+			server := httptest.NewServer(fake)
+			defer server.Close()
+
+			t.Setenv("GITHUB_TOKEN", "token")
+			t.Setenv("GITLAB_TOKEN", "token")
+			t.Setenv("BITBUCKET_TOKEN", "token")
+			provider, err := NewDeployKeyProvider(GitProviderSettings{Type: providerType, APIURL: server.URL}, repo)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// the key is on the last page, so it is not added again
+			if err := provider.AddDeployKey(repo, "gltr", lastKey, true); err != nil {
+				t.Fatal(err)
+			}
+			if fake.added != 0 {
+				t.Errorf("key on the last page was added again")
+			}
+			if err := provider.AddDeployKey(repo, "gltr", newTestPublicKey(t, "new"), true); err != nil {
+				t.Fatal(err)
+			}
+			if fake.added != 1 {
+				t.Errorf("new key was added %v times", fake.added)
+			}
+
+			if err := provider.RemoveDeployKey(repo, lastKey); err != nil {
+				t.Fatal(err)
+			}
+			if len(fake.deleted) != 1 || !strings.HasSuffix(fake.deleted[0], "/5") {
+				t.Errorf("RemoveDeployKey deleted %v, want key 5", fake.deleted)
+			}
+		})
+	}
+}
+
+func TestNextPageLink(t *testing.T) {
+	tests := []struct {
+		links []string
+		want  string
+	}{
+		{nil, ""},
+		{[]string{`<https://api.example.com/keys?page=2>; rel="next", <https://api.example.com/keys?page=5>; rel="last"`}, "https://api.example.com/keys?page=2"},
+		{[]string{`<https://api.example.com/keys?page=1>; rel="prev"`, `<https://api.example.com/keys?page=3>; rel="next"`}, "https://api.example.com/keys?page=3"},
+		{[]string{`<https://api.example.com/keys?page=1>; rel="first", <https://api.example.com/keys?page=4>; rel="prev"`}, ""},
+	}
+	for _, tt := range tests {
+		header := http.Header{}
+		for _, link := range tt.links {
+			header.Add("Link", link)
+		}
+		if got := nextPageLink(header); got != tt.want {
+			t.Errorf("nextPageLink(%q) = %q, want %q", tt.links, got, tt.want)
+		}
+	}
+}
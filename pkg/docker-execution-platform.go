@@ -5,8 +5,10 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"os"
 	"os/exec"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/docker/docker/api/types"
@@ -16,6 +18,9 @@ import (
 	"github.com/tidwall/gjson"
 )
 
+// the container installs its secrets right after it has started
+const dockerSecretsTimeout = 2 * time.Minute
+
 // DockerExecutionPlatform does not contain any state right now
 type DockerExecutionPlatform struct {
 }
@@ -119,30 +124,75 @@ func (d DockerExecutionPlatform) KillTask(taskID string) error {
 	return nil
 }
 
-// RunTask runs a docker container  kills a task with the given taskID
-func (d DockerExecutionPlatform) RunTask(gt Task, config Config, gltrPrivateKey []byte, hostname string) error {
+// RunTask runs a docker container for the task and returns its task id
+func (d DockerExecutionPlatform) RunTask(
+	gt Task,
+	config Config,
+	gltrPrivateKey []byte,
+	hostKey HostKey,
+	hostname string,
+) (taskID string, err error) {
+
+	taskID = generateTaskID()
+
+	// the secrets are mounted into the container rather than passed in its
+	// environment, where docker inspect would show them, or copied into it,
+	// which would keep them on disk for as long as the container exists
+	secretsDir, err := writeHostTaskSecrets(taskSecrets(gltrPrivateKey, hostKey))
+	if err != nil {
+		return "", fmt.Errorf("error writing task secrets: %w", err)
+	}
+	defer os.RemoveAll(secretsDir)
 
-	taskID := generateTaskID()
-	command := createDockerRunInstruction(gt, config, gltrPrivateKey, taskID, true, hostname, false)
+	command := createDockerCreateInstruction(gt, config, taskID, true, hostname, false, secretsDir)
 	// fmt.Printf("command: %v\n", command)
 
-	cmd := exec.Command(command[0], command[1:]...)
-	if err := cmd.Start(); err != nil {
-		pterm.Error.Printf("Error launching container run command %v\n", gt.ProjectName)
-		return err
+	pterm.Info.Printf("Creating container for %v\n", gt.ProjectName)
+	output, err := exec.Command(command[0], command[1:]...).Output()
+	if err != nil {
+		pterm.Error.Printf("Error creating container for %v\n", gt.ProjectName)
+		return "", dockerCommandError(err)
+	}
+	containerID := strings.TrimSpace(string(output))
+
+	pterm.Info.Printf("Starting container for %v\n", gt.ProjectName)
+	err = dockerCommandError(exec.Command("docker", "start", containerID).Run())
+	if err == nil {
+		err = waitForDockerSecrets(containerID)
+	}
+	if err != nil {
+		exec.Command("docker", "rm", "-f", containerID).Run()
+		return "", err
 	}
-	pterm.Info.Printf("Starting container run command  %v\n", gt.ProjectName)
+	return taskID, nil
+}
 
-	// apparently, it is not clear how well this works on non linux systems...
-	if err := cmd.Wait(); err != nil {
-		if exiterr, ok := err.(*exec.ExitError); ok {
-			errString := fmt.Sprintf("docker command terminated with exit code: %d", exiterr.ExitCode())
-			return errors.New(errString)
+// waitForDockerSecrets waits until the container has installed the secrets
+// which are mounted into it
+func waitForDockerSecrets(containerID string) error {
+	endTime := time.Now().Add(dockerSecretsTimeout)
+	for {
+		err := exec.Command("docker", "exec", containerID, "test", "-e", taskSecretsInstalledFile).Run()
+		if err == nil {
+			return nil
 		}
-		// error waiting for command to finish...
-		return err
+		if time.Now().After(endTime) {
+			return fmt.Errorf(
+				"container did not install its keys within %v - the image may be older than glattr",
+				dockerSecretsTimeout,
+			)
+		}
+		time.Sleep(time.Second)
 	}
-	return nil
+}
+
+// dockerCommandError turns the exit status of a docker command into an error
+// message
+func dockerCommandError(err error) error {
+	if exiterr, ok := err.(*exec.ExitError); ok {
+		return fmt.Errorf("docker command terminated with exit code: %d", exiterr.ExitCode())
+	}
+	return err
 }
 
 func (d DockerExecutionPlatform) GetContainerAddressAndPort(
@@ -177,3 +227,28 @@ func (d DockerExecutionPlatform) GetContainerAddressAndPort(
 	}
 	return
 }
+
+// KillProjectTasks kills all tasks which are labelled as belonging to the
+// given project
+func (d DockerExecutionPlatform) KillProjectTasks(projectName string) (killed int, err error) {
+	tasks, err := d.ListTasks()
+	if err != nil {
+		return 0, err
+	}
+
+	for _, t := range tasks {
+		project := d.GetTag(t, "gltr-project")
+		if project == nil || *project != projectName {
+			continue
+		}
+		taskID := d.GetTag(t, "gltr-task-id")
+		if taskID == nil {
+			continue
+		}
+		if err := d.KillTask(*taskID); err != nil {
+			return killed, err
+		}
+		killed++
+	}
+	return killed, nil
+}
@@ -0,0 +1,301 @@
+package gltr
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"golang.org/x/crypto/ssh"
+)
+
+// EC2 limits user data to 16KB before base64 encoding
+const maxUserDataSize = 16 * 1024
+
+const (
+	// the env file only lives until the container has been started
+	taskEnvFile      = "/etc/gltr/task.env"
+	taskLaunchScript = "/etc/gltr/launch-task"
+	// secrets of the container live on the tmpfs of the instance and are
+	// mounted at taskSecretsDir
+	taskHostSecretsDir = "/run/gltr/secrets"
+	// the launch script writes the public host key of the task to the
+	// console output after this prefix
+	taskHostKeyPrefix = "gltr-task-host-key: "
+	// the container takes a while to start when the image is not cached
+	containerStartTimeout = 10 * time.Minute
+)
+
+// taskLaunchScriptTemplate is run by cloud-init once the instance has booted;
+// its output ends up in /var/log/cloud-init-output.log and the console output
+const taskLaunchScriptTemplate = `#!/bin/sh
+set -e
+trap 'rm -rf %[1]v %[3]v' EXIT
+# the host key of the task is generated here and only its public half leaves
+# the instance, through the console output
+if ! command -v ssh-keygen >/dev/null 2>&1; then
+	echo "gltr: ssh-keygen is needed to generate the task host key"
+	exit 1
+fi
+mkdir -p -m 700 /run/gltr %[3]v
+ssh-keygen -q -t ed25519 -N '' -C gltr-task -f /run/gltr/host_key
+base64 /run/gltr/host_key > %[3]v/GLTR_SSH_HOST_KEY
+chmod 400 %[3]v/GLTR_SSH_HOST_KEY
+echo "%[6]v$(cat /run/gltr/host_key.pub)" | tee /dev/console || true
+rm -f /run/gltr/host_key /run/gltr/host_key.pub
+# the container sshd is published on port %[7]v, so the sshd of the instance
+# moves out of its way
+if command -v sshd >/dev/null 2>&1 && sshd -T 2>/dev/null | grep -qx 'port %[7]v'; then
+	echo "gltr: moving the instance sshd to port %[8]v"
+	mkdir -p /etc/ssh/sshd_config.d
+	echo "Port %[8]v" > /etc/ssh/sshd_config.d/00-gltr.conf
+	systemctl daemon-reload
+	if systemctl is-active --quiet ssh.socket; then
+		systemctl restart ssh.socket
+	fi
+	systemctl restart ssh 2>/dev/null || systemctl restart sshd || true
+fi
+if ! command -v docker >/dev/null 2>&1; then
+	echo "gltr: installing docker"
+	curl -fsSL https://get.docker.com | sh
+fi
+systemctl start docker || true
+tries=0
+until docker info >/dev/null 2>&1; do
+	tries=$((tries + 1))
+	if [ "$tries" -gt 60 ]; then
+		echo "gltr: docker is not running - giving up"
+		exit 1
+	fi
+	sleep 5
+done
+echo "gltr: starting task container"
+container=$(docker run --rm -d --env-file %[1]v -v %[3]v:%[4]v:ro %[2]v)
+echo "gltr: task container started"
+# the host key is deleted by the trap once the container has installed it
+tries=0
+until docker exec "$container" test -e %[5]v; do
+	tries=$((tries + 1))
+	if [ "$tries" -gt 150 ]; then
+		echo "gltr: the task container did not install its host key"
+		exit 1
+	fi
+	sleep 2
+done
+echo "gltr: task host key installed"
+`
+
+// shellQuote quotes the argument for a POSIX shell
+func shellQuote(arg string) string {
+	return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+}
+
+// ec2TaskUserData returns base64 encoded cloud-init user data which starts
+// the task container with the given environment and docker run arguments.
+// User data can be read through the EC2 API and the instance metadata, so
+// it carries no secrets: the launch script generates the host key of the
+// task on the instance and the project key is installed over ssh once the
+// container is up. The host key is only installed in the container, so an
+// ssh server which presents it is the container rather than the sshd of
+// the instance. runArgs publish the container sshd on sshPort, and an
+// instance sshd on that port is moved to 2222, or to 22 if sshPort is 2222.
+func ec2TaskUserData(env []string, runArgs []string, sshPort int) (string, error) {
+	for _, e := range env {
+		if strings.ContainsAny(e, "\r\n") {
+			return "", fmt.Errorf("environment variable %v contains a newline", strings.SplitN(e, "=", 2)[0])
+		}
+	}
+	instanceSSHPort := 2222
+	if sshPort == instanceSSHPort {
+		instanceSSHPort = 22
+	}
+	var quotedArgs []string
+	for _, a := range runArgs {
+		quotedArgs = append(quotedArgs, shellQuote(a))
+	}
+	writeFiles := []map[string]string{
+		{
+			"path":        taskEnvFile,
+			"permissions": "0600",
+			"content":     strings.Join(env, "\n") + "\n",
+		},
+		{
+			"path":        taskLaunchScript,
+			"permissions": "0700",
+			"content": fmt.Sprintf(
+				taskLaunchScriptTemplate,
+				taskEnvFile, strings.Join(quotedArgs, " "), taskHostSecretsDir, taskSecretsDir,
+				taskSecretsInstalledFile, taskHostKeyPrefix, sshPort, instanceSSHPort,
+			),
+		},
+	}
+	cloudConfig := map[string]interface{}{
+		"write_files": writeFiles,
+		"runcmd":      [][]string{{taskLaunchScript}},
+	}
+	return encodeCloudConfig(cloudConfig)
+}
+
+// probeTaskSSH returns nil if the ssh server at the port of the task
+// presents the host key; no login is attempted, so the handshake reaching
+// authentication is enough
+func probeTaskSSH(endpoint TaskEndpoint, awsConfig AWSConfig, auths []ssh.AuthMethod, port int, hostKey ssh.PublicKey) error {
+	verified := false
+	config := &ssh.ClientConfig{
+		User: SharedAccount,
+		HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			if err := ssh.FixedHostKey(hostKey)(hostname, remote, key); err != nil {
+				return err
+			}
+			verified = true
+			return nil
+		},
+		HostKeyAlgorithms: []string{hostKey.Type()},
+		Timeout:           10 * time.Second,
+	}
+	conn, err := dialTask(endpoint, awsConfig, auths, port)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	c, chans, reqs, err := newSSHClientConn(conn, fmt.Sprintf("%v:%v", endpoint.Address, port), config)
+	if err == nil {
+		ssh.NewClient(c, chans, reqs).Close()
+		return nil
+	}
+	if verified {
+		return nil
+	}
+	return err
+}
+
+// instanceState returns the state name of the instance, eg running
+func instanceState(ec2Client *ec2.EC2, instanceID string) (string, error) {
+	describeInstancesOutput, err := ec2Client.DescribeInstances(&ec2.DescribeInstancesInput{
+		InstanceIds: []*string{aws.String(instanceID)},
+	})
+	if err != nil {
+		return "", err
+	}
+	for _, r := range describeInstancesOutput.Reservations {
+		for _, i := range r.Instances {
+			if i.State != nil {
+				return aws.StringValue(i.State.Name), nil
+			}
+		}
+	}
+	return "", fmt.Errorf("instance %v not found", instanceID)
+}
+
+// consoleOutput returns the console output of the instance. The latest
+// output is only available on Nitro instances, on others it is updated
+// every few minutes, so it may be empty.
+func consoleOutput(ec2Client *ec2.EC2, instanceID string) (string, error) {
+	consoleOutput, err := ec2Client.GetConsoleOutput(&ec2.GetConsoleOutputInput{
+		InstanceId: aws.String(instanceID),
+		Latest:     aws.Bool(true),
+	})
+	if err != nil {
+		consoleOutput, err = ec2Client.GetConsoleOutput(&ec2.GetConsoleOutputInput{
+			InstanceId: aws.String(instanceID),
+		})
+	}
+	if err != nil {
+		return "", err
+	}
+	dat, err := base64.StdEncoding.DecodeString(aws.StringValue(consoleOutput.Output))
+	if err != nil {
+		return "", err
+	}
+	return string(dat), nil
+}
+
+// consoleOutputTail returns the last lines of the console output of the
+// instance
+func consoleOutputTail(ec2Client *ec2.EC2, instanceID string, lines int) string {
+	output, err := consoleOutput(ec2Client, instanceID)
+	if err != nil {
+		return ""
+	}
+	outputLines := strings.Split(strings.TrimRight(output, "\n"), "\n")
+	if len(outputLines) > lines {
+		outputLines = outputLines[len(outputLines)-lines:]
+	}
+	return strings.Join(outputLines, "\n")
+}
+
+// taskHostKeyFromConsole returns the host key which the launch script wrote
+// to the console output, or nil if it is not there yet
+func taskHostKeyFromConsole(output string) (ssh.PublicKey, error) {
+	var hostKey ssh.PublicKey
+	for _, line := range strings.Split(output, "\n") {
+		i := strings.Index(line, taskHostKeyPrefix)
+		if i < 0 {
+			continue
+		}
+		key, err := ParseHostPublicKey(strings.TrimSpace(line[i+len(taskHostKeyPrefix):]))
+		if err != nil {
+			return nil, err
+		}
+		// the key is written to the console more than once, but always the
+		// same key
+		if hostKey != nil && !bytes.Equal(hostKey.Marshal(), key.Marshal()) {
+			return nil, errors.New("the console output has more than one task host key")
+		}
+		hostKey = key
+	}
+	return hostKey, nil
+}
+
+// waitForTaskContainer waits for the launch script to write the host key of
+// the task to the console output and then polls the container sshd at port
+// sshPort of the instance until it presents that key, which is returned. It fails if the
+// instance stops running or the container is not up within
+// containerStartTimeout.
+func waitForTaskContainer(
+	ec2Client *ec2.EC2,
+	instanceID string,
+	endpoint TaskEndpoint,
+	awsConfig AWSConfig,
+	auths []ssh.AuthMethod,
+	sshPort int,
+) (ssh.PublicKey, error) {
+	endTime := time.Now().Add(containerStartTimeout)
+	var hostKey ssh.PublicKey
+	for {
+		var err error
+		if hostKey == nil {
+			var output string
+			output, err = consoleOutput(ec2Client, instanceID)
+			if err == nil {
+				hostKey, err = taskHostKeyFromConsole(output)
+			}
+			if err == nil && hostKey == nil {
+				err = errors.New("no task host key in the console output yet")
+			}
+		}
+		if hostKey != nil {
+			err = probeTaskSSH(endpoint, awsConfig, auths, sshPort, hostKey)
+			if err == nil {
+				return hostKey, nil
+			}
+		}
+		state, stateErr := instanceState(ec2Client, instanceID)
+		if stateErr == nil && state != ec2.InstanceStateNameRunning {
+			return nil, fmt.Errorf("instance %v is %v", instanceID, state)
+		}
+		if time.Now().After(endTime) {
+			return nil, fmt.Errorf(
+				"task container on %v not up within %v (last error: %v)\n"+
+					"the launch script logs to /var/log/cloud-init-output.log on the instance; console output:\n%v",
+				instanceID, containerStartTimeout, err, consoleOutputTail(ec2Client, instanceID, 20),
+			)
+		}
+		time.Sleep(10 * time.Second)
+	}
+}
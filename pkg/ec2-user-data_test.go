@@ -0,0 +1,109 @@
+package gltr
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestTaskHostKeyFromConsole(t *testing.T) {
+	hostKey, err := GenerateHostKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := GenerateHostKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	line := taskHostKeyPrefix + hostKey.AuthorizedKey() + " gltr-task"
+
+	tests := []struct {
+		name    string
+		output  string
+		want    []byte
+		wantErr bool
+	}{
+		{"not yet", "[   12.3] cloud-init: starting\n", nil, false},
+		{"once", "gltr: installing docker\n" + line + "\ngltr: starting task container\n", hostKey.PublicKey.Marshal(), false},
+		// cloud-init writes the line to the console as well
+		{"twice", "[   20.1] " + line + "\r\n" + line + "\n", hostKey.PublicKey.Marshal(), false},
+		{"different keys", line + "\n" + taskHostKeyPrefix + otherKey.AuthorizedKey() + "\n", nil, true},
+		{"invalid", taskHostKeyPrefix + "ssh-ed25519 not-a-key\n", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := taskHostKeyFromConsole(tt.output)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("taskHostKeyFromConsole() = %v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.want == nil {
+				if got != nil {
+					t.Fatalf("taskHostKeyFromConsole() = %v, want none", got)
+				}
+				return
+			}
+			if got == nil || !bytes.Equal(got.Marshal(), tt.want) {
+				t.Fatalf("taskHostKeyFromConsole() = %v", got)
+			}
+		})
+	}
+}
+
+func TestEc2TaskUserDataHasNoSecrets(t *testing.T) {
+	userData, err := ec2TaskUserData([]string{"GLTR_PROJECT_NAME=demo"}, []string{"--name", "demo", "gltr/minimal-notebook"}, 22)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := base64.StdEncoding.DecodeString(userData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(decoded), "PRIVATE KEY") {
+		t.Errorf("user data contains a private key:\n%s", decoded)
+	}
+	if strings.Contains(string(decoded), "path: "+taskHostSecretsDir) {
+		t.Errorf("user data writes a secret file:\n%s", decoded)
+	}
+	if !strings.Contains(string(decoded), "ssh-keygen") {
+		t.Errorf("launch script does not generate the host key:\n%s", decoded)
+	}
+}
+
+func TestEc2TaskUserDataSSHPort(t *testing.T) {
+	tests := []struct {
+		sshPort int
+		// the instance sshd is moved if it listens on the port of the
+		// container sshd
+		moved, movedTo string
+	}{
+		{22, "grep -qx 'port 22'", `echo "Port 2222"`},
+		{2200, "grep -qx 'port 2200'", `echo "Port 2222"`},
+		{2222, "grep -qx 'port 2222'", `echo "Port 22"`},
+	}
+	for _, tt := range tests {
+		runArgs := dockerRunArguments(Task{ProjectName: "demo"}, "task", false, "demo", false, tt.sshPort)
+		userData, err := ec2TaskUserData(nil, runArgs, tt.sshPort)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := base64.StdEncoding.DecodeString(userData)
+		if err != nil {
+			t.Fatal(err)
+		}
+		script := string(decoded)
+		if published := fmt.Sprintf("'-p' '%v:22'", tt.sshPort); !strings.Contains(script, published) {
+			t.Errorf("port %v: container sshd is not published with %v:\n%s", tt.sshPort, published, script)
+		}
+		if !strings.Contains(script, tt.moved) || !strings.Contains(script, tt.movedTo) {
+			t.Errorf("port %v: instance sshd is not moved with %v and %v:\n%s", tt.sshPort, tt.moved, tt.movedTo, script)
+		}
+	}
+}
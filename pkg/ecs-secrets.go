@@ -0,0 +1,191 @@
+package gltr
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/pterm/pterm"
+)
+
+const (
+	// ECS resolves the secrets of a task with its execution role
+	ecsExecutionRoleName = "gltr-ecs-task-execution"
+	// the managed policy lets the execution role pull images and write logs
+	ecsExecutionManagedPolicyArn = "arn:aws:iam::aws:policy/service-role/AmazonECSTaskExecutionRolePolicy"
+	// task secrets are stored as SecureString parameters under this prefix
+	taskSecretParameterPrefix = "/gltr"
+)
+
+const ecsExecutionRoleTrustPolicy = `{
+  "Version": "2012-10-17",
+  "Statement": [{
+    "Effect": "Allow",
+    "Principal": {"Service": "ecs-tasks.amazonaws.com"},
+    "Action": "sts:AssumeRole"
+  }]
+}`
+
+const ecsExecutionRoleSecretsPolicy = `{
+  "Version": "2012-10-17",
+  "Statement": [{
+    "Effect": "Allow",
+    "Action": "ssm:GetParameters",
+    "Resource": "arn:aws:ssm:*:*:parameter/gltr/*"
+  }]
+}`
+
+// ensureEcsExecutionRole returns the ARN of the gltr execution role, creating
+// it if it does not exist yet
+func ensureEcsExecutionRole(awsSession *session.Session) (string, error) {
+	iamClient := iam.New(awsSession)
+	getRoleOutput, err := iamClient.GetRole(&iam.GetRoleInput{
+		RoleName: aws.String(ecsExecutionRoleName),
+	})
+	if err == nil {
+		return aws.StringValue(getRoleOutput.Role.Arn), nil
+	}
+	if !isAwsErrorCode(err, iam.ErrCodeNoSuchEntityException) {
+		return "", fmt.Errorf("error looking up role %v: %w", ecsExecutionRoleName, err)
+	}
+
+	pterm.Info.Printf("Creating ECS task execution role %v\n", ecsExecutionRoleName)
+	createRoleOutput, err := iamClient.CreateRole(&iam.CreateRoleInput{
+		RoleName:                 aws.String(ecsExecutionRoleName),
+		AssumeRolePolicyDocument: aws.String(ecsExecutionRoleTrustPolicy),
+		Description:              aws.String("Lets ECS read the secrets of gltr tasks"),
+		Tags: []*iam.Tag{
+			{Key: aws.String("gltr-managed"), Value: aws.String("true")},
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("error creating role %v: %w", ecsExecutionRoleName, err)
+	}
+	_, err = iamClient.AttachRolePolicy(&iam.AttachRolePolicyInput{
+		RoleName:  aws.String(ecsExecutionRoleName),
+		PolicyArn: aws.String(ecsExecutionManagedPolicyArn),
+	})
+	if err != nil {
+		return "", fmt.Errorf("error attaching policy to role %v: %w", ecsExecutionRoleName, err)
+	}
+	_, err = iamClient.PutRolePolicy(&iam.PutRolePolicyInput{
+		RoleName:       aws.String(ecsExecutionRoleName),
+		PolicyName:     aws.String("gltr-task-secrets"),
+		PolicyDocument: aws.String(ecsExecutionRoleSecretsPolicy),
+	})
+	if err != nil {
+		return "", fmt.Errorf("error adding policy to role %v: %w", ecsExecutionRoleName, err)
+	}
+
+	// new roles take a few seconds before ECS can assume them
+	time.Sleep(15 * time.Second)
+	return aws.StringValue(createRoleOutput.Role.Arn), nil
+}
+
+// taskSecretParameterPath returns the parameter path holding the secrets of
+// the task, or of all tasks of the project if taskID is empty
+func taskSecretParameterPath(projectName, taskID string) string {
+	if taskID == "" {
+		return fmt.Sprintf("%v/%v", taskSecretParameterPrefix, projectName)
+	}
+	return fmt.Sprintf("%v/%v/%v", taskSecretParameterPrefix, projectName, taskID)
+}
+
+// putTaskSecretParameters stores the secrets as SecureString parameters and
+// returns the container secrets which reference them along with the names
+// of the parameters
+func putTaskSecretParameters(
+	ssmClient *ssm.SSM,
+	gt Task,
+	taskID string,
+	secrets []taskSecret,
+) ([]*ecs.Secret, []string, error) {
+	var containerSecrets []*ecs.Secret
+	var names []string
+	for _, s := range secrets {
+		name := fmt.Sprintf("%v/%v", taskSecretParameterPath(gt.ProjectName, taskID), s.Name)
+		_, err := ssmClient.PutParameter(&ssm.PutParameterInput{
+			Name:  aws.String(name),
+			Type:  aws.String(ssm.ParameterTypeSecureString),
+			Value: aws.String(s.Value),
+			Tags: []*ssm.Tag{
+				{Key: aws.String("gltr-managed"), Value: aws.String("true")},
+				{Key: aws.String("gltr-project"), Value: aws.String(gt.ProjectName)},
+				{Key: aws.String("gltr-task-id"), Value: aws.String(taskID)},
+			},
+		})
+		if err != nil {
+			deleteSecretParameters(ssmClient, names)
+			return nil, nil, fmt.Errorf("error storing secret %v: %w", s.Name, err)
+		}
+		names = append(names, name)
+		containerSecrets = append(containerSecrets, &ecs.Secret{
+			Name:      aws.String(s.Name),
+			ValueFrom: aws.String(name),
+		})
+	}
+	return containerSecrets, names, nil
+}
+
+// deleteSecretParameters deletes the parameters; ECS reads the secrets when
+// the container starts, so they are not needed once the task is running
+func deleteSecretParameters(ssmClient *ssm.SSM, names []string) error {
+	// at most 10 parameters can be deleted at once
+	for len(names) > 0 {
+		n := len(names)
+		if n > 10 {
+			n = 10
+		}
+		_, err := ssmClient.DeleteParameters(&ssm.DeleteParametersInput{
+			Names: aws.StringSlice(names[:n]),
+		})
+		if err != nil {
+			return err
+		}
+		names = names[n:]
+	}
+	return nil
+}
+
+// deleteProjectSecretParameters deletes the secrets left behind by tasks of
+// the project which did not start
+func deleteProjectSecretParameters(ssmClient *ssm.SSM, projectName string) error {
+	var names []string
+	err := ssmClient.GetParametersByPathPages(
+		&ssm.GetParametersByPathInput{
+			Path:      aws.String(taskSecretParameterPath(projectName, "")),
+			Recursive: aws.Bool(true),
+		},
+		func(page *ssm.GetParametersByPathOutput, lastPage bool) bool {
+			for _, p := range page.Parameters {
+				names = append(names, aws.StringValue(p.Name))
+			}
+			return true
+		},
+	)
+	if err != nil {
+		return err
+	}
+	return deleteSecretParameters(ssmClient, names)
+}
+
+// stopStartingEcsTask stops a task which has not entered the RUNNING state
+// and waits until it is stopped, after which ECS no longer reads its secrets
+func stopStartingEcsTask(ecsClient *ecs.ECS, clusterArn string, taskArn string) error {
+	_, err := ecsClient.StopTask(&ecs.StopTaskInput{
+		Cluster: aws.String(clusterArn),
+		Task:    aws.String(taskArn),
+		Reason:  aws.String("gltr run: task did not start"),
+	})
+	if err != nil {
+		return err
+	}
+	return ecsClient.WaitUntilTasksStopped(&ecs.DescribeTasksInput{
+		Cluster: aws.String(clusterArn),
+		Tasks:   []*string{aws.String(taskArn)},
+	})
+}
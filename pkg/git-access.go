@@ -0,0 +1,87 @@
+package gltr
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pterm/pterm"
+	"golang.org/x/crypto/ssh"
+)
+
+// how the workspace reaches the git repository of the project
+const (
+	// fetch anonymously over https, push over ssh with a forwarded agent
+	GitAccessPublic = "public"
+	// fetch and push over ssh with the project key, which is registered as
+	// deploy key of the repository
+	GitAccessDeployKey = "deploy-key"
+	// fetch and push over ssh with a forwarded agent; the repository is
+	// cloned on the first login which forwards one
+	GitAccessAgent = "agent"
+)
+
+// GitAccessModes lists the values of git_access in gltr.yaml
+var GitAccessModes = []string{GitAccessPublic, GitAccessDeployKey, GitAccessAgent}
+
+// GitAccessMode returns how the workspace reaches the git repository; public
+// if gltr.yaml does not say
+func (t Task) GitAccessMode() string {
+	if t.GitAccess == "" {
+		return GitAccessPublic
+	}
+	return t.GitAccess
+}
+
+// ValidateGitAccess checks the git_access setting and the git repository URL
+func (t Task) ValidateGitAccess() error {
+	mode := t.GitAccessMode()
+	valid := false
+	for _, m := range GitAccessModes {
+		valid = valid || m == mode
+	}
+	if !valid {
+		return fmt.Errorf("unknown git_access %v, must be one of %v", mode, strings.Join(GitAccessModes, ", "))
+	}
+	// the clone is made by the first login as gltr, which user accounts
+	// do not log in as
+	if mode == GitAccessAgent && t.UserAccounts {
+		return fmt.Errorf("git_access %v cannot be combined with user_accounts", mode)
+	}
+	if _, err := ParseGitURL(t.GitRepo); err != nil {
+		return err
+	}
+	return nil
+}
+
+// FetchAndPushRepos returns the URLs the workspace fetches from and pushes
+// to; only public repositories are fetched over https
+func (t Task) FetchAndPushRepos() (string, string) {
+	repo, err := ParseGitURL(t.GitRepo)
+	if err != nil {
+		pterm.Warning.Printf("Cannot parse fetch and push repos: %v\n", err)
+		return t.GitRepo, t.GitRepo
+	}
+	if t.GitAccessMode() == GitAccessPublic {
+		if fetchURL := repo.HTTPS(); fetchURL != "" {
+			return fetchURL, repo.SSH()
+		}
+	}
+	return repo.SSH(), repo.SSH()
+}
+
+// cloneRepositorySSH clones the git repository in the task container; on EC2
+// the project key arrives after the container has started, so the git-clone
+// service of the image cannot clone with a deploy key
+func cloneRepositorySSH(client *ssh.Client) error {
+	session, err := client.NewSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	output, err := session.CombinedOutput("/etc/s6-overlay/scripts/gltr-git-clone")
+	if err != nil {
+		return fmt.Errorf("error cloning the git repository: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
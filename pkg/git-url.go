@@ -0,0 +1,157 @@
+package gltr
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// GitURL is a remote git repository URL in any of the forms git accepts:
+// ssh://[user@]host[:port]/path, the scp-like [user@]host:path and
+// http(s)://[user@]host[:port]/path
+type GitURL struct {
+	Scheme string
+	User   string
+	Host   string
+	Port   string
+	// the repository path as written in the URL, eg /owner/repo.git or, in
+	// the scp-like form, owner/repo.git relative to the home directory
+	Path string
+
+	scpLike bool
+}
+
+// ParseGitURL parses a remote git repository URL; local paths and file://
+// URLs are not remote and are rejected
+func ParseGitURL(s string) (GitURL, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return GitURL{}, fmt.Errorf("git repository URL is empty")
+	}
+	if strings.Contains(s, "://") {
+		return parseGitSchemeURL(s)
+	}
+	// git treats host:path as scp-like if there is no slash before the
+	// first colon, otherwise it is a local path
+	colon := strings.Index(s, ":")
+	// [host]:path is how ipv6 addresses are written in the scp-like form
+	if open := strings.Index(s, "["); open >= 0 && open < colon {
+		if end := strings.Index(s, "]:"); end > open {
+			colon = end + 1
+		}
+	}
+	if colon <= 0 || strings.Contains(s[:colon], "/") {
+		return GitURL{}, fmt.Errorf("%v is not a remote git repository URL", s)
+	}
+	u := GitURL{Scheme: "ssh", Host: s[:colon], Path: s[colon+1:], scpLike: true}
+	if at := strings.LastIndex(u.Host, "@"); at >= 0 {
+		u.User, u.Host = u.Host[:at], u.Host[at+1:]
+	}
+	u.Host = strings.TrimSuffix(strings.TrimPrefix(u.Host, "["), "]")
+	if u.Host == "" || u.Path == "" {
+		return GitURL{}, fmt.Errorf("%v is not a valid git repository URL", s)
+	}
+	return u, nil
+}
+
+func parseGitSchemeURL(s string) (GitURL, error) {
+	parsed, err := url.Parse(s)
+	if err != nil {
+		return GitURL{}, fmt.Errorf("%v is not a valid git repository URL: %w", s, err)
+	}
+	u := GitURL{
+		Scheme: strings.ToLower(parsed.Scheme),
+		Host:   parsed.Hostname(),
+		Port:   parsed.Port(),
+		Path:   parsed.Path,
+	}
+	switch u.Scheme {
+	case "git+ssh", "ssh+git":
+		u.Scheme = "ssh"
+	case "ssh", "git", "http", "https":
+	default:
+		return GitURL{}, fmt.Errorf("%v: unsupported git URL scheme %v", s, parsed.Scheme)
+	}
+	// credentials are never kept, only the user name which matters for ssh
+	if parsed.User != nil {
+		u.User = parsed.User.Username()
+	}
+	if u.Host == "" || strings.Trim(u.Path, "/") == "" {
+		return GitURL{}, fmt.Errorf("%v is not a valid git repository URL", s)
+	}
+	return u, nil
+}
+
+// RepoPath returns the path of the repository without .git suffix and
+// slashes, eg owner/repo; this is how hosting services identify it
+func (u GitURL) RepoPath() string {
+	return strings.TrimSuffix(strings.Trim(u.Path, "/"), ".git")
+}
+
+// SSH returns the URL for accessing the repository over ssh, in the form
+// it was given in if it already was an ssh URL. The port of an http(s) URL
+// is not carried over as it is not the ssh port of the server.
+func (u GitURL) SSH() string {
+	if u.Scheme == "ssh" && u.scpLike {
+		host := u.Host
+		if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		return fmt.Sprintf("%v:%v", withUser(u.User, host), u.Path)
+	}
+	host := u.Host
+	if u.Scheme == "ssh" && u.Port != "" {
+		host = net.JoinHostPort(u.Host, u.Port)
+	} else if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	user := u.User
+	if u.Scheme != "ssh" || user == "" {
+		user = "git"
+	}
+	return fmt.Sprintf("ssh://%v%v", withUser(user, host), u.Path)
+}
+
+// HTTPS returns the URL for accessing the repository anonymously over
+// http(s); the port of an ssh URL is not carried over. Repositories which
+// are addressed relative to a home directory have no such URL.
+func (u GitURL) HTTPS() string {
+	if strings.HasPrefix(u.Path, "~") || strings.HasPrefix(u.Path, "/~") {
+		return ""
+	}
+	scheme := "https"
+	if u.Scheme == "http" {
+		scheme = "http"
+	}
+	host := u.Host
+	if (u.Scheme == "http" || u.Scheme == "https") && u.Port != "" {
+		host = net.JoinHostPort(u.Host, u.Port)
+	} else if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	return fmt.Sprintf("%v://%v/%v", scheme, host, strings.TrimPrefix(u.Path, "/"))
+}
+
+func (u GitURL) String() string {
+	switch u.Scheme {
+	case "http", "https":
+		return u.HTTPS()
+	case "git":
+		host := u.Host
+		if u.Port != "" {
+			host = net.JoinHostPort(u.Host, u.Port)
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		return fmt.Sprintf("git://%v%v", host, u.Path)
+	}
+	return u.SSH()
+}
+
+func withUser(user, host string) string {
+	if user == "" {
+		return host
+	}
+	return user + "@" + host
+}
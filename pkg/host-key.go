@@ -0,0 +1,95 @@
+package gltr
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"strings"
+
+	"github.com/mikesmitty/edkey"
+	"golang.org/x/crypto/ssh"
+	"gopkg.in/yaml.v3"
+)
+
+// HostKey is the ssh host key generated by gltr for a single task; the
+// private key is installed in the task so that the public key is known
+// before the first connection is made
+type HostKey struct {
+	PrivateKeyPEM []byte
+	PublicKey     ssh.PublicKey
+}
+
+// GenerateHostKey creates a new ed25519 host key
+func GenerateHostKey() (HostKey, error) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return HostKey{}, err
+	}
+	sshPublicKey, err := ssh.NewPublicKey(publicKey)
+	if err != nil {
+		return HostKey{}, err
+	}
+	pemKey := &pem.Block{
+		Type:  "OPENSSH PRIVATE KEY",
+		Bytes: edkey.MarshalED25519PrivateKey(privateKey),
+	}
+	return HostKey{
+		PrivateKeyPEM: pem.EncodeToMemory(pemKey),
+		PublicKey:     sshPublicKey,
+	}, nil
+}
+
+// AuthorizedKey returns the public key in the single line authorized_keys
+// format, eg ssh-ed25519 AAAA...
+func (h HostKey) AuthorizedKey() string {
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(h.PublicKey)))
+}
+
+// ParseHostPublicKey parses a public key in authorized_keys format
+func ParseHostPublicKey(authorizedKey string) (ssh.PublicKey, error) {
+	publicKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(authorizedKey))
+	if err != nil {
+		return nil, fmt.Errorf("invalid host key: %w", err)
+	}
+	return publicKey, nil
+}
+
+// hostKeyClientConfig makes the client only accept the given host key and
+// only offer the matching algorithm, so that the server presents the key
+// which gltr installed
+func hostKeyClientConfig(config *ssh.ClientConfig, hostKey ssh.PublicKey) {
+	config.HostKeyCallback = ssh.FixedHostKey(hostKey)
+	config.HostKeyAlgorithms = []string{hostKey.Type()}
+}
+
+// hostKeyCloudConfig returns the cloud-config which installs the host key
+// for the sshd of an instance
+func hostKeyCloudConfig(hostKey HostKey) map[string]interface{} {
+	return map[string]interface{}{
+		"ssh_keys": map[string]string{
+			"ed25519_private": string(hostKey.PrivateKeyPEM),
+			"ed25519_public":  hostKey.AuthorizedKey(),
+		},
+	}
+}
+
+// hostKeyUserData returns base64 encoded cloud-init user data which
+// installs the host key on an instance
+func hostKeyUserData(hostKey HostKey) (string, error) {
+	return encodeCloudConfig(hostKeyCloudConfig(hostKey))
+}
+
+// encodeCloudConfig returns the cloud-config as base64 encoded user data
+func encodeCloudConfig(cloudConfig map[string]interface{}) (string, error) {
+	out, err := yaml.Marshal(cloudConfig)
+	if err != nil {
+		return "", err
+	}
+	userData := "#cloud-config\n" + string(out)
+	if len(userData) > maxUserDataSize {
+		return "", fmt.Errorf("user data is %v bytes, EC2 accepts at most %v", len(userData), maxUserDataSize)
+	}
+	return base64.StdEncoding.EncodeToString([]byte(userData)), nil
+}
@@ -17,7 +17,10 @@ import (
 
 func getRoutingTable(svc *ec2.EC2, vpcID string) (routingTable ec2.RouteTable, err error) {
 	describeRouteTablesInput := &ec2.DescribeRouteTablesInput{
-		Filters: []*ec2.Filter{{Name: aws.String("vpc-id"), Values: []*string{aws.String(vpcID)}}},
+		Filters: []*ec2.Filter{
+			{Name: aws.String("vpc-id"), Values: []*string{aws.String(vpcID)}},
+			{Name: aws.String("association.main"), Values: []*string{aws.String("true")}},
+		},
 	}
 	describeRouteTablesOutput, err := svc.DescribeRouteTables(describeRouteTablesInput)
 	if err != nil {
@@ -37,33 +40,11 @@ func getRoutingTable(svc *ec2.EC2, vpcID string) (routingTable ec2.RouteTable, e
 	// log.Printf("Routing table output = %v", describeRouteTablesOutput)
 
 	// each vpc should simply have a single default routing table
-	routingTable = *describeRouteTablesOutput.RouteTables[0]
-	return
-}
-
-func addSecurityGroupRule(svc *ec2.EC2, securityGroupID string, port int) (err error) {
-	// add two inbound rules to the secgroup
-	secgroupRuleInput := &ec2.AuthorizeSecurityGroupIngressInput{
-		CidrIp:     aws.String("0.0.0.0/0"),
-		ToPort:     lo.ToPtr(int64(port)),
-		FromPort:   lo.ToPtr(int64(port)),
-		GroupId:    aws.String(securityGroupID),
-		IpProtocol: aws.String("tcp"),
-	}
-	_, err = svc.AuthorizeSecurityGroupIngress(secgroupRuleInput)
-	if err != nil {
-		if aerr, ok := err.(awserr.Error); ok {
-			switch aerr.Code() {
-			default:
-				fmt.Println(aerr.Error())
-			}
-		} else {
-			// Print the error, cast err to awserr.Error to get the Code and
-			// Message from an error.
-			fmt.Println(err.Error())
-		}
+	if len(describeRouteTablesOutput.RouteTables) == 0 {
+		err = fmt.Errorf("no main routing table found for vpc %v", vpcID)
 		return
 	}
+	routingTable = *describeRouteTablesOutput.RouteTables[0]
 	return
 }
 
@@ -173,85 +154,243 @@ func createVpc(svc *ec2.EC2) (vpc ec2.Vpc, err error) {
 	}
 	_, err = svc.ModifyVpcAttribute(modifyVpcAttributeInput)
 	if err != nil {
+		// the vpc exists at this point so it is returned to the caller
+		// to record it
 		fmt.Printf("Error modifying VPC attribute: %s\n", err.Error())
-		os.Exit(1)
+		return *createVpcOutput.Vpc, err
 	}
 
 	fmt.Printf("Sucessfully created VPC id=%v\n", *createVpcOutput.Vpc.VpcId)
 	return *createVpcOutput.Vpc, nil
 }
 
-func setupNetworking(awsSession *session.Session) (vpcID, igwID, subnetID string, err error) {
+// gltrManagedFilters returns filters which match gltr managed resources with
+// the given name tag
+func gltrManagedFilters(name string) []*ec2.Filter {
+	return []*ec2.Filter{
+		{Name: aws.String("tag:gltr-managed"), Values: []*string{aws.String("true")}},
+		{Name: aws.String("tag:Name"), Values: []*string{aws.String(name)}},
+	}
+}
+
+// ensureVpc returns the id of the gltr VPC; an existing VPC is used if it is
+// recorded in the config or can be found by its tags, otherwise a new VPC
+// is created
+func ensureVpc(svc *ec2.EC2, vpcID string) (string, error) {
+	if vpcID != "" {
+		_, err := svc.DescribeVpcs(&ec2.DescribeVpcsInput{VpcIds: []*string{aws.String(vpcID)}})
+		if err == nil {
+			fmt.Printf("Using existing VPC id=%v\n", vpcID)
+			return vpcID, ensureVpcDnsAttributes(svc, vpcID)
+		}
+		if !isAwsErrorCode(err, "InvalidVpcID.NotFound") {
+			return "", fmt.Errorf("error checking VPC %v: %w", vpcID, err)
+		}
+		fmt.Printf("VPC %v recorded in configuration no longer exists\n", vpcID)
+	}
 
-	svc := ec2.New(awsSession)
+	describeVpcsOutput, err := svc.DescribeVpcs(&ec2.DescribeVpcsInput{Filters: gltrManagedFilters("gltr-vpc")})
+	if err != nil {
+		return "", fmt.Errorf("error looking up gltr VPC: %w", err)
+	}
+	if len(describeVpcsOutput.Vpcs) > 0 {
+		if len(describeVpcsOutput.Vpcs) > 1 {
+			fmt.Printf("WARNING: found %v gltr VPCs - using the first\n", len(describeVpcsOutput.Vpcs))
+		}
+		vpcID = aws.StringValue(describeVpcsOutput.Vpcs[0].VpcId)
+		fmt.Printf("Found existing VPC id=%v\n", vpcID)
+		return vpcID, ensureVpcDnsAttributes(svc, vpcID)
+	}
 
-	// create the VPC
 	vpc, err := createVpc(svc)
-	vpcID = *vpc.VpcId
+	return aws.StringValue(vpc.VpcId), err
+}
 
-	createInternetGatewayInput := &ec2.CreateInternetGatewayInput{
-		TagSpecifications: []*ec2.TagSpecification{
-			{
-				ResourceType: aws.String("internet-gateway"),
-				Tags: []*ec2.Tag{
-					{Key: lo.ToPtr("Name"), Value: lo.ToPtr("gltr-igw")},
-					{Key: lo.ToPtr("gltr-managed"), Value: lo.ToPtr("true")},
+// ensureVpcDnsAttributes turns DNS support and DNS hostnames back on in a
+// reused VPC; instances need both for public DNS names and SSM endpoints.
+// Each attribute has to be described and modified on its own.
+func ensureVpcDnsAttributes(svc *ec2.EC2, vpcID string) error {
+	for _, attribute := range []string{ec2.VpcAttributeNameEnableDnsSupport, ec2.VpcAttributeNameEnableDnsHostnames} {
+		describeVpcAttributeOutput, err := svc.DescribeVpcAttribute(&ec2.DescribeVpcAttributeInput{
+			Attribute: aws.String(attribute),
+			VpcId:     aws.String(vpcID),
+		})
+		if err != nil {
+			return fmt.Errorf("error checking %v of VPC %v: %w", attribute, vpcID, err)
+		}
+		current := describeVpcAttributeOutput.EnableDnsHostnames
+		modifyVpcAttributeInput := &ec2.ModifyVpcAttributeInput{VpcId: aws.String(vpcID)}
+		enabled := &ec2.AttributeBooleanValue{Value: aws.Bool(true)}
+		if attribute == ec2.VpcAttributeNameEnableDnsSupport {
+			current = describeVpcAttributeOutput.EnableDnsSupport
+			modifyVpcAttributeInput.EnableDnsSupport = enabled
+		} else {
+			modifyVpcAttributeInput.EnableDnsHostnames = enabled
+		}
+		if current != nil && aws.BoolValue(current.Value) {
+			continue
+		}
+		fmt.Printf("Turning %v back on in VPC %v\n", attribute, vpcID)
+		if _, err := svc.ModifyVpcAttribute(modifyVpcAttributeInput); err != nil {
+			return fmt.Errorf("error turning on %v of VPC %v: %w", attribute, vpcID, err)
+		}
+	}
+	return nil
+}
+
+// ensureInternetGateway returns the id of an internet gateway attached to the
+// gltr VPC, creating and attaching one if necessary
+func ensureInternetGateway(svc *ec2.EC2, igwID, vpcID string) (string, error) {
+	var igw *ec2.InternetGateway
+	if igwID != "" {
+		describeInternetGatewaysOutput, err := svc.DescribeInternetGateways(&ec2.DescribeInternetGatewaysInput{
+			InternetGatewayIds: []*string{aws.String(igwID)},
+		})
+		switch {
+		case err == nil && len(describeInternetGatewaysOutput.InternetGateways) == 1:
+			igw = describeInternetGatewaysOutput.InternetGateways[0]
+		case err == nil || isAwsErrorCode(err, "InvalidInternetGatewayID.NotFound"):
+			fmt.Printf("Internet gateway %v recorded in configuration no longer exists\n", igwID)
+		default:
+			return "", fmt.Errorf("error checking internet gateway %v: %w", igwID, err)
+		}
+	}
+
+	// a VPC can only have a single internet gateway attached, so if there is
+	// one already, we use it
+	if igw == nil {
+		describeInternetGatewaysOutput, err := svc.DescribeInternetGateways(&ec2.DescribeInternetGatewaysInput{
+			Filters: []*ec2.Filter{{Name: aws.String("attachment.vpc-id"), Values: []*string{aws.String(vpcID)}}},
+		})
+		if err != nil {
+			return "", fmt.Errorf("error looking up internet gateway: %w", err)
+		}
+		if len(describeInternetGatewaysOutput.InternetGateways) > 0 {
+			igw = describeInternetGatewaysOutput.InternetGateways[0]
+		}
+	}
+
+	// a gateway might have been created on a previous run but not attached
+	if igw == nil {
+		describeInternetGatewaysOutput, err := svc.DescribeInternetGateways(&ec2.DescribeInternetGatewaysInput{
+			Filters: gltrManagedFilters("gltr-igw"),
+		})
+		if err != nil {
+			return "", fmt.Errorf("error looking up internet gateway: %w", err)
+		}
+		for _, i := range describeInternetGatewaysOutput.InternetGateways {
+			if len(i.Attachments) == 0 {
+				igw = i
+				break
+			}
+		}
+	}
+
+	if igw == nil {
+		createInternetGatewayInput := &ec2.CreateInternetGatewayInput{
+			TagSpecifications: []*ec2.TagSpecification{
+				{
+					ResourceType: aws.String("internet-gateway"),
+					Tags: []*ec2.Tag{
+						{Key: lo.ToPtr("Name"), Value: lo.ToPtr("gltr-igw")},
+						{Key: lo.ToPtr("gltr-managed"), Value: lo.ToPtr("true")},
+					},
 				},
 			},
-		},
+		}
+		createInternetGatewayOutput, err := svc.CreateInternetGateway(createInternetGatewayInput)
+		if err != nil {
+			return "", fmt.Errorf("error creating internet gateway: %w", err)
+		}
+		igw = createInternetGatewayOutput.InternetGateway
+		fmt.Printf("Successfully created Internet gateway id=%v\n", aws.StringValue(igw.InternetGatewayId))
+	} else {
+		fmt.Printf("Using existing Internet gateway id=%v\n", aws.StringValue(igw.InternetGatewayId))
 	}
-	createInternetGatewayOutput, err := svc.CreateInternetGateway(createInternetGatewayInput)
-	if err != nil {
-		if aerr, ok := err.(awserr.Error); ok {
-			switch aerr.Code() {
-			default:
-				fmt.Println(aerr.Error())
-			}
-		} else {
-			// Print the error, cast err to awserr.Error to get the Code and
-			// Message from an error.
-			fmt.Println(err.Error())
+	igwID = aws.StringValue(igw.InternetGatewayId)
+
+	for _, a := range igw.Attachments {
+		if aws.StringValue(a.VpcId) == vpcID {
+			return igwID, nil
 		}
-		return
 	}
-	fmt.Printf(
-		"Successfully create Internet gateway id=%v\n",
-		*createInternetGatewayOutput.InternetGateway.InternetGatewayId,
-	)
-	igwID = *createInternetGatewayOutput.InternetGateway.InternetGatewayId
 
 	attachInternetGatewayInput := &ec2.AttachInternetGatewayInput{
-		VpcId:             &vpcID,
-		InternetGatewayId: &igwID,
+		VpcId:             aws.String(vpcID),
+		InternetGatewayId: aws.String(igwID),
 	}
-	_, err = svc.AttachInternetGateway(attachInternetGatewayInput)
+	_, err := svc.AttachInternetGateway(attachInternetGatewayInput)
 	if err != nil {
-		if aerr, ok := err.(awserr.Error); ok {
-			switch aerr.Code() {
-			default:
-				fmt.Println(aerr.Error())
-			}
-		} else {
-			// Print the error, cast err to awserr.Error to get the Code and
-			// Message from an error.
-			fmt.Println(err.Error())
+		return igwID, fmt.Errorf("error attaching internet gateway %v to vpc %v: %w", igwID, vpcID, err)
+	}
+	fmt.Printf("Attached Internet gateway id=%v to VPC id=%v\n", igwID, vpcID)
+	return igwID, nil
+}
+
+// ensureSubnet returns the id of the gltr subnet in the VPC, creating it if
+// necessary
+func ensureSubnet(svc *ec2.EC2, subnetID, vpcID string) (string, error) {
+	if subnetID != "" {
+		_, err := svc.DescribeSubnets(&ec2.DescribeSubnetsInput{SubnetIds: []*string{aws.String(subnetID)}})
+		if err == nil {
+			fmt.Printf("Using existing subnet id=%v\n", subnetID)
+			return subnetID, nil
 		}
-		return
+		if !isAwsErrorCode(err, "InvalidSubnetID.NotFound") {
+			return "", fmt.Errorf("error checking subnet %v: %w", subnetID, err)
+		}
+		fmt.Printf("Subnet %v recorded in configuration no longer exists\n", subnetID)
 	}
-	// log.Printf("igw attached to vpc")
 
-	subnetID, err = createSubnet(svc, vpcID)
+	describeSubnetsOutput, err := svc.DescribeSubnets(&ec2.DescribeSubnetsInput{
+		Filters: append(
+			gltrManagedFilters("gltr-subnet"),
+			&ec2.Filter{Name: aws.String("vpc-id"), Values: []*string{aws.String(vpcID)}},
+		),
+	})
 	if err != nil {
-		fmt.Printf("Error creating subnet: %s", err.Error())
-		// have to add cleanup functions here...
-		os.Exit(1)
-
+		return "", fmt.Errorf("error looking up gltr subnet: %w", err)
+	}
+	if len(describeSubnetsOutput.Subnets) > 0 {
+		subnetID = aws.StringValue(describeSubnetsOutput.Subnets[0].SubnetId)
+		fmt.Printf("Found existing subnet id=%v\n", subnetID)
+		return subnetID, nil
 	}
 
+	return createSubnet(svc, vpcID)
+}
+
+// ensureDefaultRoute makes sure that the main routing table of the VPC routes
+// 0.0.0.0/0 through the internet gateway
+func ensureDefaultRoute(svc *ec2.EC2, vpcID, igwID string) error {
 	routingTable, err := getRoutingTable(svc, vpcID)
-	routingTableID := *routingTable.RouteTableId
+	if err != nil {
+		return fmt.Errorf("error obtaining routing table for vpc %v: %w", vpcID, err)
+	}
+	routingTableID := aws.StringValue(routingTable.RouteTableId)
+
+	for _, route := range routingTable.Routes {
+		if aws.StringValue(route.DestinationCidrBlock) != "0.0.0.0/0" {
+			continue
+		}
+		if aws.StringValue(route.GatewayId) == igwID && aws.StringValue(route.State) == "active" {
+			fmt.Printf("Default route via Internet gateway already present\n")
+			return nil
+		}
+		// the route exists but points somewhere else (typically a gateway
+		// which has since been removed), so we replace it
+		_, err = svc.ReplaceRoute(&ec2.ReplaceRouteInput{
+			DestinationCidrBlock: aws.String("0.0.0.0/0"),
+			GatewayId:            aws.String(igwID),
+			RouteTableId:         aws.String(routingTableID),
+		})
+		if err != nil {
+			return fmt.Errorf("error replacing default route: %w", err)
+		}
+		fmt.Printf("Replaced default route with route via Internet gateway id=%v\n", igwID)
+		return nil
+	}
 
-	// add route to subnet
 	createRouteInput := &ec2.CreateRouteInput{
 		DestinationCidrBlock: aws.String("0.0.0.0/0"),
 		GatewayId:            aws.String(igwID),
@@ -259,25 +398,70 @@ func setupNetworking(awsSession *session.Session) (vpcID, igwID, subnetID string
 	}
 	_, err = svc.CreateRoute(createRouteInput)
 	if err != nil {
-		if aerr, ok := err.(awserr.Error); ok {
-			switch aerr.Code() {
-			default:
-				fmt.Println(aerr.Error())
+		return fmt.Errorf("error creating default route: %w", err)
+	}
+	fmt.Printf("Successfully added default route via Internet gateway id=%v\n", igwID)
+	return nil
+}
+
+// setupNetworking creates the VPC, internet gateway, subnet and default route
+// which gltr needs. Each step first checks for resources which already exist,
+// either because they are recorded in the config or because they carry the
+// gltr tags, so setupNetworking can be rerun safely after a partial failure.
+// The config is passed to save after each step so that progress is not lost.
+func setupNetworking(awsSession *session.Session, config *AWSConfig, save func(AWSConfig) error) (err error) {
+
+	svc := ec2.New(awsSession)
+
+	// a step can fail after creating its resource, so progress is saved
+	// whenever a resource id is known, irrespective of the error
+	saveProgress := func(id string, err error) error {
+		if id != "" && save != nil {
+			if saveErr := save(*config); saveErr != nil && err == nil {
+				return saveErr
 			}
-		} else {
-			// Print the error, cast err to awserr.Error to get the Code and
-			// Message from an error.
-			fmt.Println(err.Error())
 		}
+		return err
+	}
+
+	config.VpcID, err = ensureVpc(svc, config.VpcID)
+	if err = saveProgress(config.VpcID, err); err != nil {
 		return
 	}
-	// log.Printf("igw route added to subnet")
 
-	return
+	config.IgwID, err = ensureInternetGateway(svc, config.IgwID, config.VpcID)
+	if err = saveProgress(config.IgwID, err); err != nil {
+		return
+	}
+
+	config.SubnetID, err = ensureSubnet(svc, config.SubnetID, config.VpcID)
+	if err = saveProgress(config.SubnetID, err); err != nil {
+		return
+	}
+
+	return ensureDefaultRoute(svc, config.VpcID, config.IgwID)
 }
 
 func createEcsCluster(awsSession *session.Session) (cluster *ecs.Cluster, err error) {
 	_, ecsClient, err := getEcsClient()
+	if err != nil {
+		return
+	}
+
+	// reuse the cluster if it was created on a previous run
+	describeClustersOutput, err := ecsClient.DescribeClusters(&ecs.DescribeClustersInput{
+		Clusters: []*string{lo.ToPtr("gltr-cluster")},
+	})
+	if err != nil {
+		log.Printf("Error looking up cluster: %v", err.Error())
+		return
+	}
+	for _, c := range describeClustersOutput.Clusters {
+		if aws.StringValue(c.Status) == "ACTIVE" {
+			return c, nil
+		}
+	}
+
 	createClusterInput := &ecs.CreateClusterInput{
 		ClusterName: lo.ToPtr("gltr-cluster"),
 		// capaciity providers are either autoscaling groups or fargate...
@@ -299,41 +483,67 @@ func createEcsCluster(awsSession *session.Session) (cluster *ecs.Cluster, err er
 // - a VPC and subnet which have public connectivity
 // - an ECS cluster
 // - optionally a cluster role which supports adding cloudwatch to the cluster
-func InitializeAWS() (config AWSConfig, err error) {
+//
+// InitializeAWS starts from the given config and only creates what is
+// missing, so it can be used to complete or repair a partially initialized
+// environment. If save is not nil, it is called with the updated config
+// after each resource is created.
+func InitializeAWS(config AWSConfig, save func(AWSConfig) error) (AWSConfig, error) {
 
-	// this could be an input parameter here; need to be more precise
-	// about the interface
-	useDefaultAwsConfiguration := ReadConfirmationInput("Use default AWS configuration", confirmation.Yes)
-	if !useDefaultAwsConfiguration {
-		fmt.Printf("Not implemented yet - exiting...\n")
-		os.Exit(1)
-	}
-	fmt.Printf("\n")
-
-	awsSession, err := session.NewSessionWithOptions(session.Options{
-		SharedConfigState: session.SharedConfigEnable,
-	})
+	awsSession, err := newAWSSession()
 
 	if err != nil {
 		fmt.Printf("Error initializing AWS session: %v", err)
-		return
+		return config, err
+	}
+	config.RegionName = aws.StringValue(awsSession.Config.Region)
+
+	// this could be an input parameter here; need to be more precise
+	// about the interface
+	if config.VpcID == "" {
+		useDefaultAwsConfiguration := ReadConfirmationInput("Use default AWS configuration", confirmation.Yes)
+		fmt.Printf("\n")
+		if !useDefaultAwsConfiguration {
+			err = configureExistingNetwork(awsSession, &config)
+			if err != nil {
+				fmt.Printf("Error configuring existing AWS network: %v\n", err)
+				return config, err
+			}
+		}
 	}
 
-	// vpcId, subnetId, securityGroupID, err := setupNetworking(awsSession)
-	vpcID, igwID, subnetID, err := setupNetworking(awsSession)
-	config.SubnetID = subnetID
-	config.VpcID = vpcID
-	config.IgwID = igwID
+	if config.ExternallyManaged {
+		// nothing is created in an externally managed network, we just
+		// check that what was configured is still usable
+		err = validateExistingNetwork(awsSession, &config)
+		if err != nil {
+			fmt.Printf("Error validating existing AWS network: %v\n", err)
+			return config, err
+		}
+	} else {
+		err = setupNetworking(awsSession, &config, save)
+		if err != nil {
+			fmt.Printf("Error setting up AWS networking: %v\n", err)
+			fmt.Printf("Progress has been saved - rerun with --repair to complete initialization\n")
+			return config, err
+		}
+	}
 
-	// this is ugly but workable for now...
-	fmt.Printf("WARNING: Default AMI image is currently hardcoded...\n")
-	// this should be fixed up such that we query AWS for the ami and the keyname
-	config.DefaultAmiCPUImage = "ami-0a29e902d4020927e"
-	config.DefaultAmiGPUImage = "ami-08f55edd71b55694a"
+	// the default AMIs differ per region; failing to resolve them here is
+	// not fatal since they are resolved again when a project is added
+	for _, gpu := range []bool{false, true} {
+		ami, err := ResolveDefaultAmi(&config, gpu, defaultArchitecture)
+		if err != nil {
+			fmt.Printf("WARNING: unable to resolve default AMI (gpu: %v): %v\n", gpu, err)
+			continue
+		}
+		fmt.Printf("Default AMI (gpu: %v): %v (%v)\n", gpu, ami.ImageID, ami.Name)
+	}
 	config.Initialized = true
-	// config.SecurityGroup = securityGroupID
-	return
-
+	if save != nil {
+		err = save(config)
+	}
+	return config, err
 }
 
 func WriteAWSConfig(config AWSConfig, filename string) {
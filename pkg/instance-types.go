@@ -0,0 +1,317 @@
+package gltr
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/pricing"
+)
+
+const (
+	defaultArchitecture = "x86_64"
+	// the price list API is only served from a few regions
+	pricingRegion = "us-east-1"
+	// only the smallest matching instance types are offered
+	maxInstanceTypeOptions = 25
+)
+
+var Architectures = []string{"x86_64", "arm64"}
+
+// InstanceTypeFilter narrows down the instance types offered for a project;
+// zero values do not filter
+type InstanceTypeFilter struct {
+	Architecture string
+	MinVCPUs     int64
+	MinMemoryGiB float64
+	MinGPUs      int64
+	// case insensitive substring of the GPU name, eg T4 or A10G
+	GPUModel string
+}
+
+// InstanceTypeInfo summarises an instance type
+type InstanceTypeInfo struct {
+	Name          string
+	VCPUs         int64
+	MemoryGiB     float64
+	GPUs          int64
+	GPUModel      string
+	Architectures []string
+	// on demand Linux price in USD per hour, empty if unknown
+	HourlyPrice string
+}
+
+func instanceTypeInfo(t *ec2.InstanceTypeInfo) InstanceTypeInfo {
+	info := InstanceTypeInfo{
+		Name: aws.StringValue(t.InstanceType),
+	}
+	if t.VCpuInfo != nil {
+		info.VCPUs = aws.Int64Value(t.VCpuInfo.DefaultVCpus)
+	}
+	if t.MemoryInfo != nil {
+		info.MemoryGiB = float64(aws.Int64Value(t.MemoryInfo.SizeInMiB)) / 1024
+	}
+	if t.ProcessorInfo != nil {
+		info.Architectures = aws.StringValueSlice(t.ProcessorInfo.SupportedArchitectures)
+	}
+	if t.GpuInfo != nil {
+		for _, g := range t.GpuInfo.Gpus {
+			// docker run --gpus needs the nvidia container toolkit
+			if aws.StringValue(g.Manufacturer) != "NVIDIA" {
+				continue
+			}
+			info.GPUs += aws.Int64Value(g.Count)
+			info.GPUModel = aws.StringValue(g.Name)
+		}
+	}
+	return info
+}
+
+// SupportsArchitecture returns true if the instance type runs the
+// architecture
+func (i InstanceTypeInfo) SupportsArchitecture(architecture string) bool {
+	for _, a := range i.Architectures {
+		if a == architecture {
+			return true
+		}
+	}
+	return false
+}
+
+// Matches returns true if the instance type passes the filter
+func (f InstanceTypeFilter) Matches(i InstanceTypeInfo) bool {
+	if f.Architecture != "" && !i.SupportsArchitecture(f.Architecture) {
+		return false
+	}
+	if i.VCPUs < f.MinVCPUs || i.MemoryGiB < f.MinMemoryGiB || i.GPUs < f.MinGPUs {
+		return false
+	}
+	if f.GPUModel != "" && !strings.Contains(strings.ToLower(i.GPUModel), strings.ToLower(f.GPUModel)) {
+		return false
+	}
+	return true
+}
+
+// subnetAvailabilityZone returns the availability zone of the subnet
+func subnetAvailabilityZone(ec2Client *ec2.EC2, subnetID string) (string, error) {
+	describeSubnetsOutput, err := ec2Client.DescribeSubnets(&ec2.DescribeSubnetsInput{
+		SubnetIds: []*string{aws.String(subnetID)},
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(describeSubnetsOutput.Subnets) == 0 {
+		return "", fmt.Errorf("subnet %v not found", subnetID)
+	}
+	return aws.StringValue(describeSubnetsOutput.Subnets[0].AvailabilityZone), nil
+}
+
+// offeredInstanceTypes returns the instance types offered in the
+// availability zone
+func offeredInstanceTypes(ec2Client *ec2.EC2, availabilityZone string) (map[string]bool, error) {
+	offered := map[string]bool{}
+	err := ec2Client.DescribeInstanceTypeOfferingsPages(
+		&ec2.DescribeInstanceTypeOfferingsInput{
+			LocationType: aws.String(ec2.LocationTypeAvailabilityZone),
+			Filters: []*ec2.Filter{
+				{Name: aws.String("location"), Values: []*string{aws.String(availabilityZone)}},
+			},
+		},
+		func(page *ec2.DescribeInstanceTypeOfferingsOutput, lastPage bool) bool {
+			for _, o := range page.InstanceTypeOfferings {
+				offered[aws.StringValue(o.InstanceType)] = true
+			}
+			return true
+		},
+	)
+	return offered, err
+}
+
+// ListInstanceTypes returns the current generation, virtualized instance
+// types offered in the availability zone of the subnet which pass the
+// filter, smallest first
+func ListInstanceTypes(subnetID string, filter InstanceTypeFilter) ([]InstanceTypeInfo, error) {
+	_, ec2Client, err := getEc2Client()
+	if err != nil {
+		return nil, err
+	}
+	availabilityZone, err := subnetAvailabilityZone(ec2Client, subnetID)
+	if err != nil {
+		return nil, err
+	}
+	offered, err := offeredInstanceTypes(ec2Client, availabilityZone)
+	if err != nil {
+		return nil, err
+	}
+
+	var instanceTypes []InstanceTypeInfo
+	err = ec2Client.DescribeInstanceTypesPages(
+		&ec2.DescribeInstanceTypesInput{
+			Filters: []*ec2.Filter{
+				{Name: aws.String("current-generation"), Values: []*string{aws.String("true")}},
+				{Name: aws.String("bare-metal"), Values: []*string{aws.String("false")}},
+			},
+		},
+		func(page *ec2.DescribeInstanceTypesOutput, lastPage bool) bool {
+			for _, t := range page.InstanceTypes {
+				info := instanceTypeInfo(t)
+				if offered[info.Name] && filter.Matches(info) {
+					instanceTypes = append(instanceTypes, info)
+				}
+			}
+			return true
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(instanceTypes, func(i, j int) bool {
+		a, b := instanceTypes[i], instanceTypes[j]
+		if a.GPUs != b.GPUs {
+			return a.GPUs < b.GPUs
+		}
+		if a.VCPUs != b.VCPUs {
+			return a.VCPUs < b.VCPUs
+		}
+		if a.MemoryGiB != b.MemoryGiB {
+			return a.MemoryGiB < b.MemoryGiB
+		}
+		return a.Name < b.Name
+	})
+	return instanceTypes, nil
+}
+
+// onDemandPrice extracts the hourly USD price from a price list entry
+func onDemandPrice(priceList aws.JSONValue) string {
+	terms, _ := priceList["terms"].(map[string]interface{})
+	onDemand, _ := terms["OnDemand"].(map[string]interface{})
+	for _, offer := range onDemand {
+		offerTerms, _ := offer.(map[string]interface{})
+		dimensions, _ := offerTerms["priceDimensions"].(map[string]interface{})
+		for _, dimension := range dimensions {
+			d, _ := dimension.(map[string]interface{})
+			pricePerUnit, _ := d["pricePerUnit"].(map[string]interface{})
+			if usd, ok := pricePerUnit["USD"].(string); ok {
+				return usd
+			}
+		}
+	}
+	return ""
+}
+
+// instanceTypePrice returns the on demand Linux price of the instance type
+// in the region from the AWS price list
+func instanceTypePrice(pricingClient *pricing.Pricing, region, instanceType string) (string, error) {
+	filter := func(field, value string) *pricing.Filter {
+		return &pricing.Filter{
+			Type:  aws.String(pricing.FilterTypeTermMatch),
+			Field: aws.String(field),
+			Value: aws.String(value),
+		}
+	}
+	getProductsOutput, err := pricingClient.GetProducts(&pricing.GetProductsInput{
+		ServiceCode: aws.String("AmazonEC2"),
+		Filters: []*pricing.Filter{
+			filter("instanceType", instanceType),
+			filter("regionCode", region),
+			filter("operatingSystem", "Linux"),
+			filter("tenancy", "Shared"),
+			filter("preInstalledSw", "NA"),
+			filter("capacitystatus", "Used"),
+			filter("licenseModel", "No License required"),
+		},
+		MaxResults: aws.Int64(1),
+	})
+	if err != nil {
+		return "", err
+	}
+	for _, p := range getProductsOutput.PriceList {
+		if price := onDemandPrice(p); price != "" {
+			return price, nil
+		}
+	}
+	return "", nil
+}
+
+// AddPricingHints looks up the on demand prices of the instance types in the
+// region; prices which cannot be found are left empty, since they are only
+// a hint
+func AddPricingHints(instanceTypes []InstanceTypeInfo, region string) {
+	awsSession, err := newAWSSession()
+	if err != nil {
+		return
+	}
+	pricingClient := pricing.New(awsSession, aws.NewConfig().WithRegion(pricingRegion))
+
+	var wg sync.WaitGroup
+	for i := range instanceTypes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			price, err := instanceTypePrice(pricingClient, region, instanceTypes[i].Name)
+			if err != nil || price == "" {
+				return
+			}
+			if p, err := strconv.ParseFloat(price, 64); err == nil {
+				price = fmt.Sprintf("%.4f", p)
+			}
+			instanceTypes[i].HourlyPrice = price
+		}(i)
+	}
+	wg.Wait()
+}
+
+// ValidateInstanceType checks that the instance type of the project is
+// offered in the availability zone of its subnet and runs the architecture
+// of its AMI
+func ValidateInstanceType(ec2Config Ec2ProjectConfig) error {
+	_, ec2Client, err := getEc2Client()
+	if err != nil {
+		return err
+	}
+	availabilityZone, err := subnetAvailabilityZone(ec2Client, ec2Config.SubnetID)
+	if err != nil {
+		return err
+	}
+	describeInstanceTypeOfferingsOutput, err := ec2Client.DescribeInstanceTypeOfferings(&ec2.DescribeInstanceTypeOfferingsInput{
+		LocationType: aws.String(ec2.LocationTypeAvailabilityZone),
+		Filters: []*ec2.Filter{
+			{Name: aws.String("location"), Values: []*string{aws.String(availabilityZone)}},
+			{Name: aws.String("instance-type"), Values: []*string{aws.String(ec2Config.DefaultInstanceType)}},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if len(describeInstanceTypeOfferingsOutput.InstanceTypeOfferings) == 0 {
+		return fmt.Errorf(
+			"instance type %v is not offered in %v (the availability zone of subnet %v)",
+			ec2Config.DefaultInstanceType, availabilityZone, ec2Config.SubnetID,
+		)
+	}
+
+	describeInstanceTypesOutput, err := ec2Client.DescribeInstanceTypes(&ec2.DescribeInstanceTypesInput{
+		InstanceTypes: []*string{aws.String(ec2Config.DefaultInstanceType)},
+	})
+	if err != nil {
+		return err
+	}
+	image, err := describeImage(ec2Client, ec2Config.DefaultImage)
+	if err != nil {
+		return err
+	}
+	for _, t := range describeInstanceTypesOutput.InstanceTypes {
+		if architecture := aws.StringValue(image.Architecture); !instanceTypeInfo(t).SupportsArchitecture(architecture) {
+			return fmt.Errorf(
+				"instance type %v does not run %v, the architecture of AMI %v",
+				ec2Config.DefaultInstanceType, architecture, ec2Config.DefaultImage,
+			)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package keystore
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// FileStore keeps the private key unencrypted in the project key directory,
+// as gltr always has
+type FileStore struct {
+	Dir string
+}
+
+func (s *FileStore) path(projectID string) string {
+	return filepath.Join(s.Dir, projectID, projectID)
+}
+
+// Get reads the private key of the project
+func (s *FileStore) Get(projectID string) ([]byte, error) {
+	privateKey, err := os.ReadFile(s.path(projectID))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return privateKey, err
+}
+
+// Put writes the private key of the project, readable only by the user
+func (s *FileStore) Put(projectID string, privateKey []byte) error {
+	return writeKeyFile(s.path(projectID), privateKey)
+}
+
+// Delete removes the private key file of the project
+func (s *FileStore) Delete(projectID string) error {
+	return removeKeyFile(s.path(projectID))
+}
+
+func (s *FileStore) String() string {
+	return "files in " + s.Dir
+}
+
+// writeKeyFile writes the key at path, creating the project directory
+func writeKeyFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// removeKeyFile removes the key at path if it exists
+func removeKeyFile(path string) error {
+	err := os.Remove(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,47 @@
+package keystore
+
+import (
+	"errors"
+
+	"github.com/zalando/go-keyring"
+)
+
+// the keys are stored in the keyring under this service with the project ID
+// as the user
+const keyringService = "gltr"
+
+// KeyringStore keeps the private key in the keyring of the operating system;
+// on Linux this is the Secret Service, eg GNOME Keyring or KWallet
+type KeyringStore struct {
+	Service string
+}
+
+// Get returns the private key of the project from the keyring
+func (s *KeyringStore) Get(projectID string) ([]byte, error) {
+	privateKey, err := keyring.Get(s.Service, projectID)
+	if errors.Is(err, keyring.ErrNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return []byte(privateKey), nil
+}
+
+// Put adds the private key of the project to the keyring
+func (s *KeyringStore) Put(projectID string, privateKey []byte) error {
+	return keyring.Set(s.Service, projectID, string(privateKey))
+}
+
+// Delete removes the private key of the project from the keyring
+func (s *KeyringStore) Delete(projectID string) error {
+	err := keyring.Delete(s.Service, projectID)
+	if errors.Is(err, keyring.ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+func (s *KeyringStore) String() string {
+	return "the " + s.Service + " service of the OS keyring"
+}
@@ -0,0 +1,60 @@
+// Package keystore keeps the private keys of gltr projects. The key of a
+// project is stored under its project ID; public keys are not secret and
+// stay in the project key directory whichever store holds the private key.
+package keystore
+
+import (
+	"errors"
+	"fmt"
+
+	gltr "github.com/gltr-sh/gltr/pkg"
+)
+
+// ErrNotFound is returned by Get if the store holds no key for the project
+var ErrNotFound = errors.New("project key not found")
+
+// the key store types which can be selected in the gltr config
+const (
+	TypeFile           = "file"
+	TypePassphraseFile = "passphrase-file"
+	TypeKeyring        = "keyring"
+	TypeVault          = "vault"
+)
+
+// Types lists the key store types in the order they are documented
+var Types = []string{TypeFile, TypePassphraseFile, TypeKeyring, TypeVault}
+
+// Store keeps project private keys, which are OpenSSH PEM encoded
+type Store interface {
+	// Get returns the private key of the project or ErrNotFound
+	Get(projectID string) ([]byte, error)
+	// Put stores the private key of the project, replacing any previous one
+	Put(projectID string, privateKey []byte) error
+	// Delete removes the private key of the project; deleting a key which
+	// is not stored is not an error
+	Delete(projectID string) error
+	// String describes where the keys are kept
+	String() string
+}
+
+// New returns the key store selected by the settings. keyDir is the
+// directory holding a subdirectory per project; passphrase is asked for the
+// passphrase of the passphrase-file store, with confirm set when a new key
+// is encrypted.
+func New(
+	settings gltr.KeyStoreSettings,
+	keyDir string,
+	passphrase func(confirm bool) ([]byte, error),
+) (Store, error) {
+	switch settings.Type {
+	case "", TypeFile:
+		return &FileStore{Dir: keyDir}, nil
+	case TypePassphraseFile:
+		return &PassphraseFileStore{Dir: keyDir, Passphrase: passphrase}, nil
+	case TypeKeyring:
+		return &KeyringStore{Service: keyringService}, nil
+	case TypeVault:
+		return NewVaultStore(settings.Vault)
+	}
+	return nil, fmt.Errorf("unknown key store type %q - expected one of %v", settings.Type, Types)
+}
@@ -0,0 +1,111 @@
+package keystore
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+// PassphraseFileStore keeps the private key in the project key directory,
+// encrypted with age for a passphrase
+type PassphraseFileStore struct {
+	Dir string
+	// Passphrase asks for the passphrase; confirm is set when a key is
+	// encrypted, so that the passphrase can be entered twice
+	Passphrase func(confirm bool) ([]byte, error)
+
+	// the passphrase is only asked for once per run
+	passphrase []byte
+}
+
+func (s *PassphraseFileStore) path(projectID string) string {
+	return filepath.Join(s.Dir, projectID, projectID+".age")
+}
+
+func (s *PassphraseFileStore) getPassphrase(confirm bool) ([]byte, error) {
+	if s.passphrase != nil {
+		return s.passphrase, nil
+	}
+	if s.Passphrase == nil {
+		return nil, errors.New("no passphrase for the project key")
+	}
+	passphrase, err := s.Passphrase(confirm)
+	if err != nil {
+		return nil, err
+	}
+	if len(passphrase) == 0 {
+		return nil, errors.New("the passphrase is empty")
+	}
+	s.passphrase = passphrase
+	return passphrase, nil
+}
+
+// Get decrypts the private key of the project
+func (s *PassphraseFileStore) Get(projectID string) ([]byte, error) {
+	sealed, err := os.ReadFile(s.path(projectID))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	passphrase, err := s.getPassphrase(false)
+	if err != nil {
+		return nil, err
+	}
+	identity, err := age.NewScryptIdentity(string(passphrase))
+	if err != nil {
+		return nil, err
+	}
+	r, err := age.Decrypt(armor.NewReader(bytes.NewReader(sealed)), identity)
+	if err != nil {
+		// a wrong passphrase must not be used for the next key
+		s.passphrase = nil
+		return nil, fmt.Errorf("error decrypting project key - wrong passphrase?: %w", err)
+	}
+	return io.ReadAll(r)
+}
+
+// Put encrypts the private key of the project with the passphrase
+func (s *PassphraseFileStore) Put(projectID string, privateKey []byte) error {
+	passphrase, err := s.getPassphrase(true)
+	if err != nil {
+		return err
+	}
+	recipient, err := age.NewScryptRecipient(string(passphrase))
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	armorWriter := armor.NewWriter(&buf)
+	w, err := age.Encrypt(armorWriter, recipient)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(privateKey); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	if err := armorWriter.Close(); err != nil {
+		return err
+	}
+	return writeKeyFile(s.path(projectID), buf.Bytes())
+}
+
+// Delete removes the encrypted private key of the project
+func (s *PassphraseFileStore) Delete(projectID string) error {
+	return removeKeyFile(s.path(projectID))
+}
+
+func (s *PassphraseFileStore) String() string {
+	return "passphrase encrypted files in " + s.Dir
+}
@@ -0,0 +1,111 @@
+package keystore
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	gltr "github.com/gltr-sh/gltr/pkg"
+	vault "github.com/hashicorp/vault/api"
+)
+
+const (
+	defaultVaultMount = "secret"
+	defaultVaultPath  = "gltr/project-keys"
+)
+
+// VaultStore keeps the private key in a HashiCorp Vault KV version 2 secrets
+// engine, one secret per project with the key in its private_key field
+type VaultStore struct {
+	client *vault.Client
+	mount  string
+	path   string
+}
+
+// NewVaultStore returns a store for the vault server of the settings. The
+// address and token default to VAULT_ADDR and VAULT_TOKEN; without
+// VAULT_TOKEN the token the vault CLI saved in ~/.vault-token is used.
+func NewVaultStore(settings gltr.VaultKeyStoreSettings) (*VaultStore, error) {
+	config := vault.DefaultConfig()
+	if config.Error != nil {
+		return nil, config.Error
+	}
+	if settings.Address != "" {
+		config.Address = settings.Address
+	}
+	client, err := vault.NewClient(config)
+	if err != nil {
+		return nil, fmt.Errorf("error creating vault client: %w", err)
+	}
+	if client.Token() == "" {
+		token, err := os.ReadFile(filepath.Join(os.Getenv("HOME"), ".vault-token"))
+		if err != nil {
+			return nil, errors.New("no vault token - set VAULT_TOKEN or log in with vault login")
+		}
+		client.SetToken(strings.TrimSpace(string(token)))
+	}
+
+	s := &VaultStore{client: client, mount: settings.Mount, path: settings.Path}
+	if s.mount == "" {
+		s.mount = defaultVaultMount
+	}
+	if s.path == "" {
+		s.path = defaultVaultPath
+	}
+	return s, nil
+}
+
+func (s *VaultStore) secretPath(kind, projectID string) string {
+	return path.Join(s.mount, kind, s.path, projectID)
+}
+
+// Get reads the private key of the project from vault
+func (s *VaultStore) Get(projectID string) ([]byte, error) {
+	secret, err := s.client.Logical().Read(s.secretPath("data", projectID))
+	if err != nil {
+		return nil, fmt.Errorf("error reading project key from vault: %w", err)
+	}
+	// a deleted version has no data
+	if secret == nil || secret.Data["data"] == nil {
+		return nil, ErrNotFound
+	}
+	data, ok := secret.Data["data"].(map[string]interface{})
+	if !ok {
+		return nil, errors.New("unexpected secret format in vault - is the mount a KV version 2 engine?")
+	}
+	privateKey, ok := data["private_key"].(string)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return []byte(privateKey), nil
+}
+
+// Put writes the private key of the project to vault as a new version
+func (s *VaultStore) Put(projectID string, privateKey []byte) error {
+	_, err := s.client.Logical().Write(s.secretPath("data", projectID), map[string]interface{}{
+		"data": map[string]interface{}{
+			"private_key": string(privateKey),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("error writing project key to vault: %w", err)
+	}
+	return nil
+}
+
+// Delete removes the private key of the project and all its versions from
+// vault
+func (s *VaultStore) Delete(projectID string) error {
+	_, err := s.client.Logical().Delete(s.secretPath("metadata", projectID))
+	if err != nil {
+		return fmt.Errorf("error deleting project key from vault: %w", err)
+	}
+	return nil
+}
+
+func (s *VaultStore) String() string {
+	return fmt.Sprintf("vault at %v under %v", s.client.Address(), path.Join(s.mount, s.path))
+}
@@ -0,0 +1,133 @@
+package gltr
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// the jupyter-server service in the gltr container runs this jupyter
+const jupyterBinary = "/opt/conda/bin/jupyter"
+
+// PortForward tunnels a local port to a port inside the task over ssh
+type PortForward struct {
+	LocalPort  int
+	RemotePort int
+	listener   net.Listener
+}
+
+// ListenForward opens a local listener for the remote port; the same port
+// number is used locally if it is free, otherwise any free port
+func ListenForward(remotePort int) (*PortForward, error) {
+	listener, err := net.Listen("tcp", fmt.Sprintf("localhost:%v", remotePort))
+	if err != nil {
+		listener, err = net.Listen("tcp", "localhost:0")
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &PortForward{
+		LocalPort:  listener.Addr().(*net.TCPAddr).Port,
+		RemotePort: remotePort,
+		listener:   listener,
+	}, nil
+}
+
+// Serve accepts local connections and tunnels each of them through the ssh
+// connection until the forward is closed
+func (f *PortForward) Serve(client *ssh.Client) error {
+	for {
+		local, err := f.listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go func() {
+			defer local.Close()
+			remote, err := client.Dial("tcp", fmt.Sprintf("localhost:%v", f.RemotePort))
+			if err != nil {
+				return
+			}
+			defer remote.Close()
+			pipe(local, remote)
+		}()
+	}
+}
+
+// Close stops accepting connections
+func (f *PortForward) Close() error {
+	return f.listener.Close()
+}
+
+// pipe copies data in both directions until either side is closed
+func pipe(a, b net.Conn) {
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		io.Copy(a, b)
+		a.Close()
+		wg.Done()
+	}()
+	go func() {
+		io.Copy(b, a)
+		b.Close()
+		wg.Done()
+	}()
+	wg.Wait()
+}
+
+type jupyterServer struct {
+	Token   string `json:"token"`
+	BaseURL string `json:"base_url"`
+}
+
+// JupyterURL asks the jupyter server in the task for its token and returns
+// the authenticated URL for the local end of the forward. Jupyter can take
+// a while to start, so the server list is retried for up to a minute.
+func JupyterURL(client *ssh.Client, localPort int) (string, error) {
+	var server *jupyterServer
+	for attempt := 0; attempt < 12 && server == nil; attempt++ {
+		if attempt > 0 {
+			time.Sleep(5 * time.Second)
+		}
+		session, err := client.NewSession()
+		if err != nil {
+			return "", err
+		}
+		out, err := session.Output(jupyterBinary + " server list --json")
+		session.Close()
+		if err != nil {
+			continue
+		}
+		// one json document is printed per running server
+		for _, line := range strings.Split(string(out), "\n") {
+			var s jupyterServer
+			if json.Unmarshal([]byte(line), &s) == nil {
+				server = &s
+				break
+			}
+		}
+	}
+	if server == nil {
+		return "", errors.New("jupyter server is not running in the task")
+	}
+
+	baseURL := server.BaseURL
+	if !strings.HasSuffix(baseURL, "/") {
+		baseURL += "/"
+	}
+	url := fmt.Sprintf("http://localhost:%v%vlab", localPort, baseURL)
+	if server.Token != "" {
+		url += "?token=" + server.Token
+	}
+	return url, nil
+}
@@ -143,11 +143,20 @@ func detachInternetGateway(ec2Client *ec2.EC2, igwID, vpcID string) (err error)
 }
 
 func removeSecurityGroups(ec2Client *ec2.EC2, vpcID string) (err error) {
+	// only security groups created by gltr are removed; the VPC may be
+	// externally managed and contain groups which gltr does not own
 	describeSecurityGroupsInput := ec2.DescribeSecurityGroupsInput{
-		Filters: []*ec2.Filter{{Name: aws.String("vpc-id"), Values: []*string{aws.String(vpcID)}}},
+		Filters: []*ec2.Filter{
+			{Name: aws.String("vpc-id"), Values: []*string{aws.String(vpcID)}},
+			{Name: aws.String("tag:gltr-managed"), Values: []*string{aws.String("true")}},
+		},
 	}
 
 	describeSecurityGroupsOutput, err := ec2Client.DescribeSecurityGroups(&describeSecurityGroupsInput)
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
 
 	for _, s := range describeSecurityGroupsOutput.SecurityGroups {
 		if *s.GroupName != "default" {
@@ -226,16 +235,45 @@ func removeNetworkConfig(c AWSConfig) (err error) {
 	return
 }
 
-func PowerhoseAws(c AWSConfig) (err error) {
+// PowerhoseAws removes the gltr ECS cluster, the bastion and the gltr
+// networking resources. If the network is externally managed, only the security groups
+// which gltr created are removed; the VPC, subnets and any configured
+// security groups are left untouched.
+func PowerhoseAws(config Config) (err error) {
 	fmt.Printf("Powerhosing aws\n")
 
-	clusterName := "test"
-	err = removeCluster(clusterName)
-	if err != nil {
-		fmt.Printf("Terminating powerhose operation...")
-		return
+	if clusterName := config.EcsClusterName(); clusterName != "" {
+		err = removeCluster(clusterName)
+		if err != nil {
+			fmt.Printf("Terminating powerhose operation...")
+			return
+		}
+		fmt.Printf("Cluster %v removed\n", clusterName)
+	}
+
+	c := config.ProviderConfiguration.AWS
+	if c.Bastion.InstanceID != "" {
+		err = RemoveBastion(c.Bastion)
+		if err != nil {
+			fmt.Printf("Terminating powerhose operation...")
+			return
+		}
+		fmt.Printf("Bastion removed\n")
+	}
+
+	if c.ExternallyManaged {
+		_, ec2Client, err := getEc2Client()
+		if err != nil {
+			return err
+		}
+		err = removeSecurityGroups(ec2Client, c.VpcID)
+		if err != nil {
+			fmt.Printf("Terminating powerhose operation...")
+			return err
+		}
+		fmt.Printf("Successfully removed gltr security groups - externally managed network left in place\n")
+		return nil
 	}
-	fmt.Printf("Cluster %v removed\n", clusterName)
 
 	err = removeNetworkConfig(c)
 	if err != nil {
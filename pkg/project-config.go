@@ -3,53 +3,178 @@ package gltr
 import (
 	"fmt"
 	"strconv"
+	"strings"
 
 	"github.com/erikgeiser/promptkit/confirmation"
 )
 
+// selectProjectSubnet returns the subnet which project tasks are launched in;
+// the user chooses if more than one subnet has been configured
+func selectProjectSubnet(awsConfig AWSConfig) string {
+	subnetIDs := awsConfig.GetSubnetIDs()
+	if len(subnetIDs) <= 1 {
+		return awsConfig.SubnetID
+	}
+	return ReadOptionInput("Select Subnet", awsConfig.SubnetID, subnetIDs)
+}
+
+// getProjectSecurityGroup returns the security group for the project; if
+// existing security groups have been configured, the user chooses one of
+// them, otherwise a new security group is created for the project
+func getProjectSecurityGroup(awsConfig AWSConfig, securityGroupName string, ingress SecurityGroupIngress) (string, error) {
+	switch len(awsConfig.SecurityGroupIDs) {
+	case 0:
+		return CreateNewSecurityGroup(securityGroupName, awsConfig.VpcID, ingress)
+	case 1:
+		return awsConfig.SecurityGroupIDs[0], nil
+	default:
+		return ReadOptionInput("Select Security Group", "", awsConfig.SecurityGroupIDs), nil
+	}
+}
+
+// subnetIsPublic returns true if the subnet has a route to an internet
+// gateway; the subnet created by gltr init is always public
+func subnetIsPublic(awsConfig AWSConfig, subnetID string) bool {
+	for _, s := range awsConfig.Subnets {
+		if s.SubnetID == subnetID {
+			return s.Public
+		}
+	}
+	return true
+}
+
+// selectConnectionMode asks how ssh connections reach the project tasks;
+// tasks in private subnets cannot be reached directly, so public is only
+// offered for public subnets
+func selectConnectionMode(awsConfig AWSConfig, subnetID string) ConnectionMode {
+	options := ConnectionModes
+	defaultMode := string(ConnectionPublic)
+	if !subnetIsPublic(awsConfig, subnetID) {
+		options = []string{string(ConnectionSSM), string(ConnectionBastion)}
+		defaultMode = string(ConnectionSSM)
+	}
+	mode := ConnectionMode(ReadOptionInput("Select Connection Mode", defaultMode, options))
+	if mode == ConnectionBastion && awsConfig.Bastion.InstanceID == "" {
+		fmt.Printf("WARNING: no bastion configured - run gltr config add-bastion and then gltr project allow-ip before running this project\n")
+	}
+	return mode
+}
+
 func ProjectAddDockerExecutionPlatform(config Config) (ExecutionPlatformProjectConfig, error) {
 	fmt.Printf("WARNING: add docker execution platform not supported yet\n")
 	return ExecutionPlatformProjectConfig{}, nil
 }
 
-func ProjectAddEc2ExecutionPlatform(gt Task, config Config) (ExecutionPlatformProjectConfig, error) {
-	ec2Config := config.GetExecutionPlatformConfig(Ec2).(Ec2Config)
+// readInstanceTypeFilter asks for the requirements of the project instance
+func readInstanceTypeFilter(gpuRequired bool) (InstanceTypeFilter, error) {
+	filter := InstanceTypeFilter{
+		Architecture: ReadOptionInput("Select Architecture (arm64 is AWS Graviton)", defaultArchitecture, Architectures),
+	}
+	var err error
+	filter.MinVCPUs, err = strconv.ParseInt(ReadTextInput("Enter Minimum vCPUs", "2", ""), 10, 64)
+	if err != nil {
+		return filter, fmt.Errorf("invalid number of vCPUs: %w", err)
+	}
+	filter.MinMemoryGiB, err = strconv.ParseFloat(ReadTextInput("Enter Minimum Memory (GiB)", "4", ""), 64)
+	if err != nil {
+		return filter, fmt.Errorf("invalid memory size: %w", err)
+	}
+	if gpuRequired {
+		filter.MinGPUs, err = strconv.ParseInt(ReadTextInput("Enter Minimum GPUs", "1", ""), 10, 64)
+		if err != nil {
+			return filter, fmt.Errorf("invalid number of GPUs: %w", err)
+		}
+		filter.GPUModel = ReadTextInput("Enter GPU Model (empty for any)", "", "T4, A10G, L4, ...")
+	}
+	return filter, nil
+}
+
+// selectInstanceType offers the smallest instance types which match the
+// filter in the availability zone of the subnet, with on demand prices; if
+// they cannot be listed the instance type is entered by hand
+func selectInstanceType(awsConfig AWSConfig, subnetID string, filter InstanceTypeFilter) string {
+	instanceTypes, err := ListInstanceTypes(subnetID, filter)
+	if err != nil || len(instanceTypes) == 0 {
+		if err != nil {
+			fmt.Printf("WARNING: unable to list instance types: %v\n", err)
+		} else {
+			fmt.Printf("WARNING: no instance type in the subnet matches the requirements\n")
+		}
+		return ReadTextInput("Enter Instance Type", "", "m5.large")
+	}
+	if len(instanceTypes) > maxInstanceTypeOptions {
+		instanceTypes = instanceTypes[:maxInstanceTypeOptions]
+	}
+	AddPricingHints(instanceTypes, awsConfig.RegionName)
+
+	var options []string
+	for _, t := range instanceTypes {
+		option := fmt.Sprintf("%v (%d vCPUs, %.1f GiB", t.Name, t.VCPUs, t.MemoryGiB)
+		if t.GPUs > 0 {
+			option += fmt.Sprintf(", %d x %v", t.GPUs, t.GPUModel)
+		}
+		if t.HourlyPrice != "" {
+			option += fmt.Sprintf(", $%v/h", t.HourlyPrice)
+		}
+		options = append(options, option+")")
+	}
+	selected := ReadOptionInput("Default Instance Type", "", options)
+	return strings.Fields(selected)[0]
+}
 
+func ProjectAddEc2ExecutionPlatform(gt Task, config *Config) (ExecutionPlatformProjectConfig, error) {
 	gpuRequired := ReadConfirmationInput("GPU Required", confirmation.No)
 
-	var instanceTypes []string
-	switch gpuRequired {
-	case true:
-		instanceTypes = []string{"g4dn.xlarge", "g4dn.2xlarge", "g4dn.4xlare"}
-	case false:
-		instanceTypes = []string{"t2.micro", "t2.small", "t2.medium", "t2.large"}
+	// the instance types on offer depend on the availability zone of the subnet
+	subnetID := selectProjectSubnet(config.ProviderConfiguration.AWS)
+	connectionMode := selectConnectionMode(config.ProviderConfiguration.AWS, subnetID)
+
+	filter, err := readInstanceTypeFilter(gpuRequired)
+	if err != nil {
+		return ExecutionPlatformProjectConfig{}, err
+	}
+	instanceType := selectInstanceType(config.ProviderConfiguration.AWS, subnetID, filter)
+
+	// the resolved AMI is cached in the config, which the caller saves
+	ami, err := ResolveDefaultAmi(&config.ProviderConfiguration.AWS, gpuRequired, filter.Architecture)
+	if err != nil {
+		fmt.Printf("WARNING: unable to resolve the default AMI: %v\n", err)
+	}
+	defaultAmi := ReadTextInput("Enter AMI", ami.ImageID, "ami-...")
+	rootVolumeSize, err := strconv.Atoi(ReadTextInput(
+		"Enter Root Volume Size (GiB)", fmt.Sprintf("%d", defaultRootVolumeSize), ""))
+	if err != nil {
+		return ExecutionPlatformProjectConfig{}, fmt.Errorf("invalid root volume size: %w", err)
+	}
+
+	var instanceProfileName string
+	if connectionMode == ConnectionSSM {
+		instanceProfileName = ReadTextInput(
+			"Enter Instance Profile Name (must allow the SSM agent to register)", "", "")
 	}
-	instanceType := ReadOptionInput(
-		"Default Instance Type", "", instanceTypes)
 
 	// create security group
-	// assume 2222 is not in the port list - we need to add a check here - FIXME
-	ports := append(gt.Ports, 2222)
 	securityGroupName := fmt.Sprintf("%v-ec2", gt.ProjectName)
-	securityGroupId, err := CreateNewSecurityGroup(securityGroupName, config.ProviderConfiguration.AWS.VpcID, ports)
+	securityGroupId, err := getProjectSecurityGroup(
+		config.ProviderConfiguration.AWS,
+		securityGroupName,
+		projectIngress(gt, *config, connectionMode, gt.Ec2SSHLogin(*config).Port),
+	)
 	if err != nil {
 		return ExecutionPlatformProjectConfig{}, err
 	}
 
-	var defaultAmi string
-	if gpuRequired {
-		defaultAmi = config.ProviderConfiguration.AWS.DefaultAmiGPUImage
-	} else {
-		defaultAmi = config.ProviderConfiguration.AWS.DefaultAmiCPUImage
-	}
-
 	projectConfig := Ec2ProjectConfig{
 		GpuRequired:         gpuRequired,
 		DefaultInstanceType: instanceType,
 		DefaultImage:        defaultAmi,
-		KeyName:             ec2Config.DefaultLoginKeyName,
-		SubnetID:            config.ProviderConfiguration.AWS.SubnetID,
+		KeyName:             config.Ec2KeyName(),
+		SubnetID:            subnetID,
 		SecurityGroupID:     securityGroupId,
+		ConnectionMode:      connectionMode,
+		InstanceProfileName: instanceProfileName,
+		RootVolumeSize:      rootVolumeSize,
+		AWSEnvironment:      config.ProviderConfiguration.activeAWSEnvironment,
 	}
 	return ExecutionPlatformProjectConfig{
 		Type:          Ec2,
@@ -60,11 +185,10 @@ func ProjectAddEc2ExecutionPlatform(gt Task, config Config) (ExecutionPlatformPr
 func ProjectAddEcsFargateExecutionPlatform(gt Task, config Config) (ExecutionPlatformProjectConfig, error) {
 	fmt.Printf("WARNING: add default ECS Fargate execution platform\n")
 
-	ecsConfig := config.GetExecutionPlatformConfig(EcsFargate).(EcsFargateConfig)
 	ClusterName := ReadTextInput(
 		"Enter Cluster Name",
-		ecsConfig.ClusterName,
-		ecsConfig.ClusterName,
+		config.EcsClusterName(),
+		config.EcsClusterName(),
 	)
 
 	var cpuOptions []string
@@ -83,9 +207,21 @@ func ProjectAddEcsFargateExecutionPlatform(gt Task, config Config) (ExecutionPla
 		"Enter Memory Requirements (MB)", "2048", memoryOptions)
 	memoryRequirementsInt, _ := strconv.Atoi(memoryRequirementsString)
 
+	subnetID := selectProjectSubnet(config.ProviderConfiguration.AWS)
+	connectionMode := selectConnectionMode(config.ProviderConfiguration.AWS, subnetID)
+	var taskRoleArn string
+	if connectionMode == ConnectionSSM {
+		taskRoleArn = ReadTextInput(
+			"Enter Task Role ARN (must allow ECS Exec ssmmessages actions)", "", "")
+	}
+
 	// create security group
 	securityGroupName := fmt.Sprintf("%v-ecs-fargate", gt.ProjectName)
-	securityGroupId, err := CreateNewSecurityGroup(securityGroupName, config.ProviderConfiguration.AWS.VpcID, gt.Ports)
+	securityGroupId, err := getProjectSecurityGroup(
+		config.ProviderConfiguration.AWS,
+		securityGroupName,
+		projectIngress(gt, config, connectionMode, 0),
+	)
 	if err != nil {
 		return ExecutionPlatformProjectConfig{}, err
 	}
@@ -94,8 +230,11 @@ func ProjectAddEcsFargateExecutionPlatform(gt Task, config Config) (ExecutionPla
 		CPURequirements:    cpuRequirementsInt,
 		MemoryRequirements: memoryRequirementsInt,
 		ClusterName:        ClusterName,
-		SubnetID:           config.ProviderConfiguration.AWS.SubnetID,
+		SubnetID:           subnetID,
 		SecurityGroupID:    securityGroupId,
+		ConnectionMode:     connectionMode,
+		TaskRoleArn:        taskRoleArn,
+		AWSEnvironment:     config.ProviderConfiguration.activeAWSEnvironment,
 	}
 	return ExecutionPlatformProjectConfig{
 		Type:          EcsFargate,
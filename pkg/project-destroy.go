@@ -0,0 +1,324 @@
+package gltr
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/pterm/pterm"
+	"github.com/samber/lo"
+)
+
+// ProjectSecurityGroupNames returns the names of the security groups which
+// gltr creates for a project when the AWS execution platforms are added
+func ProjectSecurityGroupNames(projectName string) []string {
+	return []string{
+		fmt.Sprintf("%v-ec2", projectName),
+		fmt.Sprintf("%v-ecs-fargate", projectName),
+	}
+}
+
+// findProjectTasksEcs returns the arns of all tasks in the cluster which are
+// tagged as belonging to the given project
+func findProjectTasksEcs(ecsClient *ecs.ECS, clusterArn, projectName string) (taskArns []*string, err error) {
+	var allTaskArns []*string
+	listTasksInput := ecs.ListTasksInput{
+		Cluster: aws.String(clusterArn),
+	}
+	err = ecsClient.ListTasksPages(&listTasksInput, func(page *ecs.ListTasksOutput, lastPage bool) bool {
+		allTaskArns = append(allTaskArns, page.TaskArns...)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// DescribeTasks accepts at most 100 tasks per call
+	for _, chunk := range lo.Chunk(allTaskArns, 100) {
+		describeTasksInput := ecs.DescribeTasksInput{
+			Cluster: aws.String(clusterArn),
+			Tasks:   chunk,
+			// if this is not included, the tags associated with the resource are not returned
+			Include: []*string{aws.String("TAGS")},
+		}
+		describeTasksOutput, err := ecsClient.DescribeTasks(&describeTasksInput)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range describeTasksOutput.Tasks {
+			if len(t.Tags) == 0 {
+				continue
+			}
+			projectTag := getEcsTag(t.Tags, "gltr-project")
+			if projectTag != nil && aws.StringValue(projectTag.Value) == projectName {
+				taskArns = append(taskArns, t.TaskArn)
+			}
+		}
+	}
+	return
+}
+
+// killProjectTasksEcs stops all tasks belonging to the project and waits
+// for them to reach the STOPPED state
+func killProjectTasksEcs(ecsClient *ecs.ECS, clusterName, projectName string) error {
+	describeClustersOutput, err := ecsClient.DescribeClusters(&ecs.DescribeClustersInput{
+		Clusters: []*string{aws.String(clusterName)},
+	})
+	if err != nil {
+		return fmt.Errorf("error obtaining cluster %v: %w", clusterName, err)
+	}
+	if len(describeClustersOutput.Clusters) != 1 {
+		pterm.Info.Printf("ECS cluster %v not found - no ECS tasks to stop\n", clusterName)
+		return nil
+	}
+	clusterArn := aws.StringValue(describeClustersOutput.Clusters[0].ClusterArn)
+
+	taskArns, err := findProjectTasksEcs(ecsClient, clusterArn, projectName)
+	if err != nil {
+		return fmt.Errorf("error listing ECS tasks: %w", err)
+	}
+	if len(taskArns) == 0 {
+		pterm.Info.Printf("No ECS tasks running for project %v\n", projectName)
+		return nil
+	}
+
+	for _, taskArn := range taskArns {
+		_, err = ecsClient.StopTask(&ecs.StopTaskInput{
+			Cluster: aws.String(clusterArn),
+			Task:    taskArn,
+			Reason:  aws.String("gltr project destroy"),
+		})
+		if err != nil {
+			return fmt.Errorf("error stopping task %v: %w", aws.StringValue(taskArn), err)
+		}
+		pterm.Info.Printf("Stopping ECS task %v\n", aws.StringValue(taskArn))
+	}
+
+	spinner, _ := pterm.DefaultSpinner.Start("Waiting for ECS tasks to enter STOPPED state...")
+	for _, chunk := range lo.Chunk(taskArns, 100) {
+		err = ecsClient.WaitUntilTasksStopped(&ecs.DescribeTasksInput{
+			Cluster: aws.String(clusterArn),
+			Tasks:   chunk,
+		})
+		if err != nil {
+			spinner.Fail("Timed out waiting for ECS tasks to stop")
+			return err
+		}
+	}
+	spinner.Success(fmt.Sprintf("%v ECS task(s) stopped", len(taskArns)))
+	return nil
+}
+
+// killProjectTasksEc2 terminates all instances belonging to the project and
+// waits for them to reach the terminated state
+func killProjectTasksEc2(ec2Client *ec2.EC2, projectName string) error {
+	describeInstancesInput := ec2.DescribeInstancesInput{
+		Filters: []*ec2.Filter{
+			{
+				Name:   aws.String("tag:gltr-managed"),
+				Values: []*string{aws.String("true")},
+			},
+			{
+				Name:   aws.String("tag:gltr-project"),
+				Values: []*string{aws.String(projectName)},
+			},
+			{
+				Name: aws.String("instance-state-name"),
+				Values: aws.StringSlice(
+					[]string{"pending", "running", "stopping", "stopped"},
+				),
+			},
+		},
+	}
+
+	var instanceIDs []*string
+	err := ec2Client.DescribeInstancesPages(
+		&describeInstancesInput,
+		func(page *ec2.DescribeInstancesOutput, lastPage bool) bool {
+			for _, r := range page.Reservations {
+				for _, i := range r.Instances {
+					instanceIDs = append(instanceIDs, i.InstanceId)
+				}
+			}
+			return true
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("error listing EC2 instances: %w", err)
+	}
+	if len(instanceIDs) == 0 {
+		pterm.Info.Printf("No EC2 instances running for project %v\n", projectName)
+		return nil
+	}
+
+	_, err = ec2Client.TerminateInstances(&ec2.TerminateInstancesInput{InstanceIds: instanceIDs})
+	if err != nil {
+		return fmt.Errorf("error terminating EC2 instances: %w", err)
+	}
+
+	spinner, _ := pterm.DefaultSpinner.Start("Waiting for EC2 instances to terminate...")
+	err = ec2Client.WaitUntilInstanceTerminated(&ec2.DescribeInstancesInput{InstanceIds: instanceIDs})
+	if err != nil {
+		spinner.Fail("Timed out waiting for EC2 instances to terminate")
+		return err
+	}
+	spinner.Success(fmt.Sprintf("%v EC2 instance(s) terminated", len(instanceIDs)))
+	return nil
+}
+
+// deregisterProjectTaskDefinitions deregisters all active task definitions
+// in the gltr task family which are tagged as belonging to the project
+func deregisterProjectTaskDefinitions(ecsClient *ecs.ECS, projectName string) error {
+	var taskDefinitionArns []*string
+	listTaskDefinitionsInput := ecs.ListTaskDefinitionsInput{
+		FamilyPrefix: aws.String("gltr-task"),
+		Status:       aws.String("ACTIVE"),
+	}
+	err := ecsClient.ListTaskDefinitionsPages(
+		&listTaskDefinitionsInput,
+		func(page *ecs.ListTaskDefinitionsOutput, lastPage bool) bool {
+			taskDefinitionArns = append(taskDefinitionArns, page.TaskDefinitionArns...)
+			return true
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("error listing task definitions: %w", err)
+	}
+
+	deregistered := 0
+	for _, arn := range taskDefinitionArns {
+		describeTaskDefinitionOutput, err := ecsClient.DescribeTaskDefinition(&ecs.DescribeTaskDefinitionInput{
+			TaskDefinition: arn,
+			Include:        []*string{aws.String("TAGS")},
+		})
+		if err != nil {
+			return fmt.Errorf("error describing task definition %v: %w", aws.StringValue(arn), err)
+		}
+		if len(describeTaskDefinitionOutput.Tags) == 0 {
+			continue
+		}
+		projectTag := getEcsTag(describeTaskDefinitionOutput.Tags, "gltr-project")
+		if projectTag == nil || aws.StringValue(projectTag.Value) != projectName {
+			continue
+		}
+		_, err = ecsClient.DeregisterTaskDefinition(&ecs.DeregisterTaskDefinitionInput{TaskDefinition: arn})
+		if err != nil {
+			return fmt.Errorf("error deregistering task definition %v: %w", aws.StringValue(arn), err)
+		}
+		deregistered++
+	}
+	pterm.Success.Printf("%v task definition(s) deregistered\n", deregistered)
+	return nil
+}
+
+// removeProjectSecurityGroups deletes the gltr managed security groups which
+// were created for the project. Network interfaces of recently terminated
+// tasks can hold on to the security groups for some time, so deletion is
+// retried for a few minutes.
+func removeProjectSecurityGroups(ec2Client *ec2.EC2, vpcID, projectName string) error {
+	filters := []*ec2.Filter{
+		{
+			Name:   aws.String("group-name"),
+			Values: aws.StringSlice(ProjectSecurityGroupNames(projectName)),
+		},
+		{
+			Name:   aws.String("tag:gltr-managed"),
+			Values: []*string{aws.String("true")},
+		},
+	}
+	if vpcID != "" {
+		filters = append(filters, &ec2.Filter{
+			Name:   aws.String("vpc-id"),
+			Values: []*string{aws.String(vpcID)},
+		})
+	}
+	describeSecurityGroupsOutput, err := ec2Client.DescribeSecurityGroups(&ec2.DescribeSecurityGroupsInput{
+		Filters: filters,
+	})
+	if err != nil {
+		return fmt.Errorf("error listing security groups: %w", err)
+	}
+	if len(describeSecurityGroupsOutput.SecurityGroups) == 0 {
+		pterm.Info.Printf("No security groups found for project %v\n", projectName)
+		return nil
+	}
+
+	for _, s := range describeSecurityGroupsOutput.SecurityGroups {
+		startTime := time.Now()
+		endTime := startTime.Add(5 * time.Minute)
+		for {
+			_, err = ec2Client.DeleteSecurityGroup(&ec2.DeleteSecurityGroupInput{GroupId: s.GroupId})
+			if err == nil {
+				pterm.Success.Printf(
+					"Security group %v removed (id: %v)\n",
+					aws.StringValue(s.GroupName),
+					aws.StringValue(s.GroupId),
+				)
+				break
+			}
+			aerr, ok := err.(awserr.Error)
+			if !ok || aerr.Code() != "DependencyViolation" || time.Now().After(endTime) {
+				return fmt.Errorf("error removing security group %v: %w", aws.StringValue(s.GroupName), err)
+			}
+			pterm.Info.Printf(
+				"Security group %v still in use - retrying in 10 seconds\n",
+				aws.StringValue(s.GroupName),
+			)
+			time.Sleep(10 * time.Second)
+		}
+	}
+	return nil
+}
+
+// ProjectDestroyAws removes the AWS resources belonging to a single project:
+// it kills all of the project's ECS and EC2 tasks, deletes the project
+// security groups and deregisters the project's task definitions. Resources
+// shared between projects (VPC, subnet, cluster) are left in place; these
+// are removed by powerhose.
+func ProjectDestroyAws(gt Task, config Config) error {
+	_, ec2Client, err := getEc2Client()
+	if err != nil {
+		return err
+	}
+	_, ecsClient, err := getEcsClient()
+	if err != nil {
+		return err
+	}
+
+	if ecsProjectConfig, ok := gt.GetExecutionPlatformProjectConfig(EcsFargate).(EcsProjectConfig); ok {
+		pterm.Info.Printf("Stopping ECS tasks for project %v\n", gt.ProjectName)
+		err = killProjectTasksEcs(ecsClient, ecsProjectConfig.ClusterName, gt.ProjectName)
+		if err != nil {
+			return err
+		}
+	}
+
+	pterm.Info.Printf("Terminating EC2 instances for project %v\n", gt.ProjectName)
+	err = killProjectTasksEc2(ec2Client, gt.ProjectName)
+	if err != nil {
+		return err
+	}
+
+	pterm.Info.Printf("Removing security groups for project %v\n", gt.ProjectName)
+	err = removeProjectSecurityGroups(ec2Client, config.ProviderConfiguration.AWS.VpcID, gt.ProjectName)
+	if err != nil {
+		return err
+	}
+
+	pterm.Info.Printf("Deregistering task definitions for project %v\n", gt.ProjectName)
+	err = deregisterProjectTaskDefinitions(ecsClient, gt.ProjectName)
+	if err != nil {
+		return err
+	}
+
+	awsSession, err := newAWSSession()
+	if err != nil {
+		return err
+	}
+	pterm.Info.Printf("Removing task secrets for project %v\n", gt.ProjectName)
+	return deleteProjectSecretParameters(ssm.New(awsSession), gt.ProjectName)
+}
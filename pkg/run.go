@@ -1,15 +1,14 @@
 package gltr
 
 import (
-	"bytes"
 	"context"
 	"encoding/base64"
 	"errors"
 	"fmt"
 	"io"
 	"log"
-	"net"
 	"os"
+	"strconv"
 	"time"
 
 	compute "cloud.google.com/go/compute/apiv1"
@@ -17,12 +16,10 @@ import (
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/ssm"
 	"github.com/google/uuid"
-	"github.com/oriser/regroup"
 	"github.com/pterm/pterm"
 	"github.com/samber/lo"
-	"golang.org/x/crypto/ssh"
-	"golang.org/x/crypto/ssh/agent"
 	"google.golang.org/api/option"
 	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
 	"google.golang.org/protobuf/proto"
@@ -101,7 +98,7 @@ func generateTaskID() (taskID string) {
 // performs a run on AWS. Assumes the following:
 // - AWS credenials are available
 // - AWS has been initialized as described elswhere
-func RunAwsEcs(gt Task, config Config, gltrPrivateKey []byte, hostname string) (networkAddress string, err error) {
+func RunAwsEcs(gt Task, config Config, gltrPrivateKey []byte, hostKey HostKey, hostname string) (endpoint TaskEndpoint, err error) {
 
 	ecsProjectConfig := gt.GetExecutionPlatformProjectConfig(EcsFargate).(EcsProjectConfig)
 	// fmt.Printf("Ecs confg = %v\n", ecsProjectConfig)
@@ -111,9 +108,7 @@ func RunAwsEcs(gt Task, config Config, gltrPrivateKey []byte, hostname string) (
 	// }
 
 	// initialize AWS session
-	awsSession, err := session.NewSessionWithOptions(session.Options{
-		SharedConfigState: session.SharedConfigEnable,
-	})
+	awsSession, err := newAWSSession()
 
 	taskID := generateTaskID()
 
@@ -140,14 +135,56 @@ func RunAwsEcs(gt Task, config Config, gltrPrivateKey []byte, hostname string) (
 		os.Exit(1)
 	}
 
-	b64EncodedPrivateKey := base64.StdEncoding.EncodeToString(gltrPrivateKey)
+	// the keys are passed as secrets which ECS resolves when the container
+	// starts, so they are not part of the task definition
+	executionRoleArn := ecsProjectConfig.ExecutionRoleArn
+	if executionRoleArn == "" {
+		executionRoleArn, err = ensureEcsExecutionRole(awsSession)
+		if err != nil {
+			pterm.Error.Printf("Error setting up the task execution role: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	ssmClient := ssm.New(awsSession)
+	containerSecrets, secretParameters, err := putTaskSecretParameters(
+		ssmClient, gt, taskID, taskSecrets(gltrPrivateKey, hostKey),
+	)
+	if err != nil {
+		pterm.Error.Printf("Error storing task secrets: %v\n", err)
+		os.Exit(1)
+	}
+	// ECS resolves the secrets when it starts the container, so they are
+	// deleted once the task is running; a task which does not get there is
+	// stopped first, as it could still be starting. From here on errors are
+	// returned rather than exiting, which would leave the secrets behind.
+	var taskArn string
+	secretsDeleted := false
+	deleteSecrets := func() {
+		secretsDeleted = true
+		if err := deleteSecretParameters(ssmClient, secretParameters); err != nil {
+			pterm.Warning.Printf("Error deleting task secrets: %v\n", err)
+		}
+	}
+	defer func() {
+		if secretsDeleted {
+			return
+		}
+		if taskArn != "" {
+			if err := stopStartingEcsTask(ecsClient, clusterArn, taskArn); err != nil {
+				pterm.Warning.Printf("Error stopping task %v: %v\n", taskArn, err)
+				pterm.Warning.Printf("Its secrets are left in SSM until gltr project destroy removes them\n")
+				return
+			}
+		}
+		deleteSecrets()
+	}()
 
-	user := gt.Users[0]
-	b64EncodedSSHKey := base64.StdEncoding.EncodeToString([]byte(user.SshKey))
+	b64EncodedSSHKey := base64.StdEncoding.EncodeToString([]byte(gt.AuthorizedKeys(config.User)))
 	b64EncodedUserName := base64.StdEncoding.EncodeToString([]byte(config.User.Name))
 	b64EncodedUserEmail := base64.StdEncoding.EncodeToString([]byte(config.User.Email))
 
-	repoFetch, repoPush := getFetchAndPushRepos(gt.GitRepo)
+	repoFetch, repoPush := gt.FetchAndPushRepos()
+	vscodeExtensions, vscodeCommit := vscodeEnvironment(gt)
 
 	pterm.Info.Printf("Registering updated task definition\n")
 	taskDefinitionInput := ecs.RegisterTaskDefinitionInput{
@@ -159,12 +196,15 @@ func RunAwsEcs(gt Task, config Config, gltrPrivateKey []byte, hostname string) (
 					{Name: aws.String("SSH_PUBLIC_KEY"), Value: aws.String(b64EncodedSSHKey)},
 					{Name: aws.String("GIT_REPO_FETCH"), Value: aws.String(repoFetch)},
 					{Name: aws.String("GIT_REPO_PUSH"), Value: aws.String(repoPush)},
-					{Name: aws.String("GLTR_PRIVATE_KEY"), Value: aws.String(b64EncodedPrivateKey)},
+					{Name: aws.String("GLTR_GIT_ACCESS"), Value: aws.String(gt.GitAccessMode())},
 					{Name: aws.String("GLTR_PROJECT_ID"), Value: aws.String(gt.ProjectID)},
 					{Name: aws.String("GLTR_PROJECT_NAME"), Value: aws.String(gt.ProjectName)},
 					{Name: aws.String("GLTR_USER_NAME"), Value: aws.String(b64EncodedUserName)},
 					{Name: aws.String("GLTR_USER_EMAIL"), Value: aws.String(b64EncodedUserEmail)},
+					{Name: aws.String("GLTR_VSCODE_EXTENSIONS"), Value: aws.String(vscodeExtensions)},
+					{Name: aws.String("GLTR_VSCODE_COMMIT"), Value: aws.String(vscodeCommit)},
 				},
+				Secrets:     containerSecrets,
 				Image:       aws.String(gt.ContainerImage),
 				Interactive: aws.Bool(false),
 				Memory:      aws.Int64(int64(ecsProjectConfig.MemoryRequirements)),
@@ -208,16 +248,33 @@ func RunAwsEcs(gt Task, config Config, gltrPrivateKey []byte, hostname string) (
 				Value: aws.String(taskID),
 			},
 		},
-		Family: lo.ToPtr("gltr-task"),
+		Family:           lo.ToPtr("gltr-task"),
+		ExecutionRoleArn: aws.String(executionRoleArn),
+	}
+	if ecsProjectConfig.TaskRoleArn != "" {
+		taskDefinitionInput.TaskRoleArn = aws.String(ecsProjectConfig.TaskRoleArn)
+	}
+	if userAccounts := gt.UserAccountsSpec(); userAccounts != "" {
+		containerDefinition := taskDefinitionInput.ContainerDefinitions[0]
+		containerDefinition.Environment = append(containerDefinition.Environment, &ecs.KeyValuePair{
+			Name:  aws.String("GLTR_USER_ACCOUNTS"),
+			Value: aws.String(base64.StdEncoding.EncodeToString([]byte(userAccounts))),
+		})
 	}
 	registerTaskDefinitionOutput, err := ecsClient.RegisterTaskDefinition(&taskDefinitionInput)
 	if err != nil {
-		pterm.Error.Printf("Error registering task: %v\n", err.Error())
-		os.Exit(1)
+		return TaskEndpoint{}, fmt.Errorf("error registering task: %w", err)
 	} else {
 		pterm.Success.Printf("Task definition registered (ARN: %v)\n", *registerTaskDefinitionOutput.TaskDefinition.TaskDefinitionArn)
 	}
 
+	// tasks in private subnets are reached via ssm or the bastion rather than
+	// a public IP
+	assignPublicIP := "DISABLED"
+	if ecsProjectConfig.ConnectionMode.IsPublic() {
+		assignPublicIP = "ENABLED"
+	}
+
 	pterm.Info.Printf("Running task on ECS Cluster\n")
 	runTaskInput := ecs.RunTaskInput{
 		LaunchType:     lo.ToPtr("FARGATE"),
@@ -226,7 +283,7 @@ func RunAwsEcs(gt Task, config Config, gltrPrivateKey []byte, hostname string) (
 		Count:          lo.ToPtr(int64(1)),
 		NetworkConfiguration: &ecs.NetworkConfiguration{
 			AwsvpcConfiguration: &ecs.AwsVpcConfiguration{
-				AssignPublicIp: lo.ToPtr("ENABLED"),
+				AssignPublicIp: lo.ToPtr(assignPublicIP),
 				Subnets: []*string{
 					lo.ToPtr(ecsProjectConfig.SubnetID),
 				},
@@ -249,16 +306,20 @@ func RunAwsEcs(gt Task, config Config, gltrPrivateKey []byte, hostname string) (
 		},
 		//PropagateTags: aws.String("NONE"),
 		// EnableECSManagedTags: aws.Bool(false),
+		// ECS Exec provides the SSM agent which ssm mode connects through
+		EnableExecuteCommand: aws.Bool(ecsProjectConfig.ConnectionMode == ConnectionSSM),
 	}
 
 	runTaskOutput, err := ecsClient.RunTask(&runTaskInput)
 	if err != nil {
-		fmt.Printf("Error registering task: %v\n", err.Error())
-		os.Exit(1)
+		return TaskEndpoint{}, fmt.Errorf("error running task: %w", err)
 	}
 
-	taskArn := *runTaskOutput.Tasks[0].Containers[0].TaskArn
-	spinner, err := pterm.DefaultSpinner.Start("Waiting for task to enter RUNNING state...")
+	if len(runTaskOutput.Failures) > 0 || len(runTaskOutput.Tasks) == 0 {
+		return TaskEndpoint{}, fmt.Errorf("error running task: %v", runTaskOutput.Failures)
+	}
+	taskArn = aws.StringValue(runTaskOutput.Tasks[0].TaskArn)
+	spinner, _ := pterm.DefaultSpinner.Start("Waiting for task to enter RUNNING state...")
 
 	describeTaskInput := ecs.DescribeTasksInput{
 		Cluster: lo.ToPtr(clusterArn),
@@ -272,8 +333,8 @@ func RunAwsEcs(gt Task, config Config, gltrPrivateKey []byte, hostname string) (
 	for time.Now().Before(endTime) && running == false {
 		describeTaskOutput, err = ecsClient.DescribeTasks(&describeTaskInput)
 		if err != nil {
-			pterm.Error.Printf("Error retrieving task info: %v\n", err.Error())
-			os.Exit(1)
+			spinner.Fail("Error retrieving task info")
+			return TaskEndpoint{}, err
 		}
 		taskStatus := *describeTaskOutput.Tasks[0].Containers[0].LastStatus
 		if taskStatus == "RUNNING" {
@@ -281,23 +342,39 @@ func RunAwsEcs(gt Task, config Config, gltrPrivateKey []byte, hostname string) (
 			spinner.Success("Task entered RUNNING state")
 			break
 		}
+		if taskStatus == "STOPPED" {
+			spinner.Fail("Task stopped before entering RUNNING state")
+			return TaskEndpoint{}, fmt.Errorf(
+				"task stopped: %v", aws.StringValue(describeTaskOutput.Tasks[0].StoppedReason),
+			)
+		}
 		time.Sleep(10 * time.Second)
 	}
 	if !running {
 		spinner.Fail("Timed out waiting for task to enter RUNNING state")
-
-		// should perform some clean up in this case...
-		return "", errors.New("Error waiting for task to enter running state")
+		return TaskEndpoint{}, errors.New("Error waiting for task to enter running state")
 	}
+	deleteSecrets()
 
 	// get eni-id
-	networkAddress, err = getNetworkAddressEcs(awsSession, describeTaskOutput.Tasks[0].Attachments[0].Details)
+	endpoint, err = ecsTaskEndpoint(
+		awsSession,
+		ecsProjectConfig.ClusterName,
+		describeTaskOutput.Tasks[0],
+		ecsProjectConfig.ConnectionMode,
+	)
+	if err != nil {
+		return
+	}
+	endpoint.TaskID = taskID
 
-	pterm.Info.Printf("Container IP address: %v\n", networkAddress)
+	pterm.Info.Printf("Container IP address: %v\n", endpoint.Address)
 	return
 }
 
-func getNetworkAddressEcs(awsSession *session.Session, attachmentDetails []*ecs.KeyValuePair) (string, error) {
+// getNetworkAddressEcs returns the public DNS name or IP of the task; if the
+// task has no public IP or public is false, the private IP is returned
+func getNetworkAddressEcs(awsSession *session.Session, attachmentDetails []*ecs.KeyValuePair, public bool) (string, error) {
 	var eniID *string
 	for _, n := range attachmentDetails {
 		if *n.Name == "networkInterfaceId" {
@@ -306,8 +383,7 @@ func getNetworkAddressEcs(awsSession *session.Session, attachmentDetails []*ecs.
 		}
 	}
 	if eniID == nil {
-		fmt.Printf("Unable to find Elastic Network Interface ID\n")
-		os.Exit(1)
+		return "", errors.New("unable to find Elastic Network Interface ID")
 	}
 
 	// now we have the eni id, now we need to convert to a public IP
@@ -315,58 +391,50 @@ func getNetworkAddressEcs(awsSession *session.Session, attachmentDetails []*ecs.
 	describeNetworkInterfacesInput := ec2.DescribeNetworkInterfacesInput{NetworkInterfaceIds: []*string{eniID}}
 	networkInterfaces, err := ec2Client.DescribeNetworkInterfaces(&describeNetworkInterfacesInput)
 	if err != nil {
-		fmt.Printf("Error retrieving network interfaces: %v\n", err)
-		os.Exit(1)
+		return "", fmt.Errorf("error retrieving network interfaces: %w", err)
+	}
+	networkInterface := networkInterfaces.NetworkInterfaces[0]
+	if !public || networkInterface.Association == nil {
+		return aws.StringValue(networkInterface.PrivateIpAddress), nil
 	}
-	publicIP := networkInterfaces.NetworkInterfaces[0].Association.PublicDnsName
+	publicIP := networkInterface.Association.PublicDnsName
 	if *publicIP == "" {
-		publicIP = networkInterfaces.NetworkInterfaces[0].Association.PublicIp
+		publicIP = networkInterface.Association.PublicIp
 	}
 	return *publicIP, nil
 }
 
-func launchEc2Instance(ec2Config Ec2ProjectConfig, gt Task) (instanceID, publicDNSName string, err error) {
+func launchEc2Instance(ec2Config Ec2ProjectConfig, gt Task, taskID string, userData string, sshPort int) (instanceID string, endpoint TaskEndpoint, err error) {
 
 	pterm.Info.Printf("Initializing communication with AWS\n")
 
 	_, ec2Client, err := getEc2Client()
 	if err != nil {
-		pterm.Error.Printf("Error initializing EC2 API: %v", err)
-		os.Exit(1)
+		return
 	}
 
-	taskID := generateTaskID()
+	// the root device name depends on the AMI
+	rootDevice, err := rootBlockDeviceMapping(ec2Client, ec2Config)
+	if err != nil {
+		return
+	}
 
 	// Specify the details of the instance that you want to create.
 
 	pterm.Info.Printf("Launching instance on Ec2...\n")
 	runInstancesInput := &ec2.RunInstancesInput{
-		ImageId:      aws.String(ec2Config.DefaultImage),
-		InstanceType: aws.String(ec2Config.DefaultInstanceType),
-		MinCount:     aws.Int64(1),
-		MaxCount:     aws.Int64(1),
-		KeyName:      aws.String(ec2Config.KeyName),
-		BlockDeviceMappings: []*ec2.BlockDeviceMapping{
-			{
-				// this is a hardcoded assumption which relates to the
-				// way the AMI is created. This really needs to be made
-				// more flexible/robust - it's prob possible to query
-				// the AMI before creation and get the device identifier
-				// of the root disk
-				// also, 10GB is hard coded here for no specific reason
-				DeviceName: aws.String("/dev/sda1"),
-				Ebs: &ec2.EbsBlockDevice{
-					VolumeSize: aws.Int64(40),
-					// by default, delete the volume on termination...
-					DeleteOnTermination: aws.Bool(true),
-				},
-			},
-		},
+		ImageId:             aws.String(ec2Config.DefaultImage),
+		InstanceType:        aws.String(ec2Config.DefaultInstanceType),
+		MinCount:            aws.Int64(1),
+		MaxCount:            aws.Int64(1),
+		KeyName:             aws.String(ec2Config.KeyName),
+		UserData:            aws.String(userData),
+		BlockDeviceMappings: []*ec2.BlockDeviceMapping{rootDevice},
 		// DeleteOnTermination: aws.Bool(true),
 		NetworkInterfaces: []*ec2.InstanceNetworkInterfaceSpecification{
 			{
 				SubnetId:                 aws.String(ec2Config.SubnetID),
-				AssociatePublicIpAddress: aws.Bool(true),
+				AssociatePublicIpAddress: aws.Bool(ec2Config.ConnectionMode.IsPublic()),
 				DeviceIndex:              aws.Int64(0),
 				Groups: []*string{
 					aws.String(ec2Config.SecurityGroupID),
@@ -374,10 +442,15 @@ func launchEc2Instance(ec2Config Ec2ProjectConfig, gt Task) (instanceID, publicD
 			},
 		},
 	}
+	if ec2Config.InstanceProfileName != "" {
+		runInstancesInput.IamInstanceProfile = &ec2.IamInstanceProfileSpecification{
+			Name: aws.String(ec2Config.InstanceProfileName),
+		}
+	}
 	runInstancesOutput, err := ec2Client.RunInstances(runInstancesInput)
 
 	if err != nil {
-		pterm.Error.Println("Error creating Ec2 instance", err)
+		err = fmt.Errorf("error creating EC2 instance: %w", err)
 		return
 	}
 
@@ -404,10 +477,14 @@ func launchEc2Instance(ec2Config Ec2ProjectConfig, gt Task) (instanceID, publicD
 				Key:   aws.String("gltr-task-id"),
 				Value: aws.String(taskID),
 			},
+			{
+				Key:   aws.String("gltr-ssh-port"),
+				Value: aws.String(strconv.Itoa(sshPort)),
+			},
 		},
 	})
 	if errtag != nil {
-		pterm.Error.Println("Could not create tags for instance", runInstancesOutput.Instances[0].InstanceId, errtag)
+		err = fmt.Errorf("could not create tags for instance %v: %w", instanceID, errtag)
 		return
 	}
 
@@ -442,214 +519,203 @@ func launchEc2Instance(ec2Config Ec2ProjectConfig, gt Task) (instanceID, publicD
 	}
 
 	if !running {
-		pterm.Error.Printf(
-			"Instance has not reach RUNNING state within 2 minutes...terminating - please check your EC2 account\n",
-		)
-		os.Exit(1)
+		spinner.Fail("Instance has not reached RUNNING state within 2 minutes")
+		err = fmt.Errorf("instance %v not running within 2 minutes - please check your EC2 account", instanceID)
+		return
 	}
 
-	publicDNSName = *describeInstancesOutput.Reservations[0].Instances[0].PublicDnsName
-	pterm.Info.Printf("Instance public DNS: %v\n", publicDNSName)
+	instance := describeInstancesOutput.Reservations[0].Instances[0]
+	endpoint = ec2InstanceEndpoint(instance, ec2Config.ConnectionMode)
+	endpoint.TaskID = taskID
+	if ec2Config.ConnectionMode.IsPublic() {
+		pterm.Info.Printf("Instance public DNS: %v\n", endpoint.Address)
+	} else {
+		pterm.Info.Printf("Instance private IP: %v\n", endpoint.Address)
+	}
 
 	return
 
 }
 
-func waitForSSH(serverName string, gt Task, port int) (*ssh.Client, error) {
-	// var hostKey ssh.PublicKey
-	// An SSH client is represented with a ClientConn.
-	//
-	// To authenticate with the remote server you must pass at least one
-	// implementation of AuthMethod via the Auth field in ClientConfig,
-	// and provide a HostKeyCallback.
-	conn, err := net.Dial("unix", os.Getenv("SSH_AUTH_SOCK"))
-	if err != nil {
-		log.Fatal(err)
-	}
-	// defer conn.Close()
-	ag := agent.NewClient(conn)
-	auths := []ssh.AuthMethod{ssh.PublicKeysCallback(ag.Signers)}
-
-	// this is a terrible hack...
+// RunAwsEc2 launches an instance which runs the task container and returns
+// the endpoint of the task and the host key which the instance generated
+// for it
+func RunAwsEc2(gt Task, config Config, privateKey []byte, hostname string) (endpoint TaskEndpoint, hostKey HostKey, err error) {
 	ec2Config := gt.GetExecutionPlatformProjectConfig(Ec2).(Ec2ProjectConfig)
-	var user string
-	// not cool at all - manageable for a demo context...
-	if ec2Config.GpuRequired {
-		user = "ubuntu"
-	} else {
-		user = "root"
-	}
-	config := &ssh.ClientConfig{
-		User: user,
-		// Auth: []ssh.AuthMethod{
-		// 	ssh.Password("yourpassword"),
-		// },
-		Auth:            auths,
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-	}
-	serverWithPort := fmt.Sprintf("%v:%v", serverName, port)
-	// dial 10 times with a 10 second delay...
-	startTime := time.Now()
-	endTime := startTime.Add(2 * time.Minute)
-	var client *ssh.Client
-	for time.Now().Unix() < endTime.Unix() {
-		client, err = ssh.Dial("tcp", serverWithPort, config)
-		if err == nil {
-			// successful connection established...
-			return client, nil
-		}
-		time.Sleep(10 * time.Second)
+	// fail before anything is launched if the instance cannot be placed
+	if err = ValidateInstanceType(ec2Config); err != nil {
+		return
 	}
 
-	return client, nil
-}
-
-func RunAwsEc2(gt Task, config Config, privateKey []byte, hostname string) (publicDnsName string, err error) {
-	// fmt.Printf("Ec2 not yet supported.")
-	// os.Exit(1)
+	// the container sshd is published on the port of the ssh login
+	login := gt.Ec2SSHLogin(config)
+	if err = login.validate(); err != nil {
+		return
+	}
 
-	// instanceID, publicDnsName, err := launchEc2Instance(gt)
-	ec2Config := gt.GetExecutionPlatformProjectConfig(Ec2).(Ec2ProjectConfig)
-	_, publicDnsName, err = launchEc2Instance(ec2Config, gt)
+	// the login is needed to install the project key in the container
+	auths, err := SSHAuthMethods(config.SSH.IdentityFile)
 	if err != nil {
-		fmt.Printf("Error launching EC2 instance: %v\n", err)
-		os.Exit(1)
+		return
 	}
 
-	spinner, err := pterm.DefaultSpinner.Start("Waiting for SSH server to come up...")
-	// wait until sshd is running
-	client, err := waitForSSH(publicDnsName, gt, 2222)
+	// the task id is generated here so that the container and the instance
+	// carry the same id
+	taskID := generateTaskID()
+	// the container is started by cloud-init rather than over ssh; user data
+	// can be read from the instance metadata, so the keys are left out of it
+	userData, err := ec2TaskUserData(
+		dockerTaskEnvironment(gt, config),
+		dockerRunArguments(gt, taskID, false, hostname, ec2Config.GpuRequired, login.Port),
+		login.Port,
+	)
 	if err != nil {
-		errorString := fmt.Sprintf("Error establishing ssh connection: %v\n", err)
-		spinner.Fail(errorString)
-		os.Exit(1)
+		return
 	}
 
-	// Each ClientConn can support multiple interactive sessions,
-	// represented by a Session.
-	session, err := client.NewSession()
+	_, ec2Client, err := getEc2Client()
 	if err != nil {
-		errorString := fmt.Sprintf("Failed to create session: %v", err)
-		spinner.Fail(errorString)
-		os.Exit(1)
+		return
+	}
+	instanceID, endpoint, err := launchEc2Instance(ec2Config, gt, taskID, userData, login.Port)
+	// like a task on ECS, an instance whose workspace did not come up is not
+	// left running
+	if instanceID != "" {
+		defer func() {
+			if err != nil {
+				terminateFailedInstance(ec2Client, instanceID)
+			}
+		}()
+	}
+	if err != nil {
+		err = fmt.Errorf("error launching EC2 instance: %w", err)
+		return
 	}
-	defer session.Close()
-	spinner.Success("SSH connection established")
 
-	// Once a Session is created, you can execute a single command on
-	// the remote side using the Run method.
-	pterm.Info.Printf("Launching docker container inside EC2 instance\n")
-	var b bytes.Buffer
-	session.Stdout = &b
-	taskID := generateTaskID()
-	commandArray := createDockerRunInstruction(gt, config, privateKey, taskID, false, hostname, ec2Config.GpuRequired)
-	dockerRunString := ""
-	for _, c := range commandArray {
-		dockerRunString = dockerRunString + c + " "
+	spinner, _ := pterm.DefaultSpinner.Start("Waiting for the task container to start...")
+	hostKey.PublicKey, err = waitForTaskContainer(ec2Client, instanceID, endpoint, config.ProviderConfiguration.AWS, auths, login.Port)
+	if err != nil {
+		spinner.Fail("Task container did not start")
+		return
 	}
-	// fmt.Printf("Running command: %v\n", dockerRunString)
+	spinner.Success("Container launched on ec2 instance")
 
-	if err := session.Run(dockerRunString); err != nil {
-		pterm.Error.Printf("Failed to run: %v - retrying", err.Error())
-		time.Sleep(10 * time.Second)
-		if err := session.Run(dockerRunString); err != nil {
-			pterm.Error.Printf("Giving up after second attempt...\n")
-			os.Exit(1)
+	client, err := DialTaskSSH(endpoint, config.ProviderConfiguration.AWS, login.Port, SharedAccount, auths, hostKey.PublicKey)
+	if err != nil {
+		return endpoint, hostKey, fmt.Errorf("error connecting to the task container: %w", err)
+	}
+	defer client.Close()
+	if err = installProjectKeySSH(client, gt.ProjectID, privateKey); err != nil {
+		return
+	}
+	pterm.Success.Printf("Project key installed in the task container\n")
+	if gt.GitAccessMode() == GitAccessDeployKey {
+		if err = cloneRepositorySSH(client); err != nil {
+			return
 		}
+		pterm.Success.Printf("Git repository cloned in the task container\n")
+	}
+	if len(gt.Secrets) > 0 {
+		if err = installWorkspaceSecretsSSH(client, gt.ProjectName); err != nil {
+			return
+		}
+		pterm.Success.Printf("Workspace secrets installed in the task container\n")
 	}
-	// if we get here, the run command did not generate an error...
-	pterm.Success.Printf("Container launched on ec2 instance\n")
-
-	// fmt.Println(b.String())
 	return
 }
 
-// this is not robust...the basic idea is ok but the regexes are not well thought through...
-func getFetchAndPushRepos(repoName string) (string, string) {
-	httpPrefix := "https://github.com"
-	gitPrefix := "git@github.com"
-	switch {
-	case repoName[0:len(httpPrefix)] == httpPrefix:
-		fetchURL := repoName
-		// convert from a fetchurl to a git url
-		// FIXME - this is not robust but in fact it is prob not used frequently, so
-		// it was deprioritized
-		re := regroup.MustCompile("https://github.com/(?P<name>\\w+)/(?P<repo>.+)")
-		matches, _ := re.Groups(repoName)
-		name := matches["name"]
-		repo := matches["repo"]
-		pushURL := fmt.Sprintf("git@github.com:%s/%s", name, repo)
-		return fetchURL, pushURL
-	case repoName[0:len(gitPrefix)] == gitPrefix:
-		pushURL := repoName
-		// convert from a git url to a http url
-		// original taken from Stack Overflow - covers all scenarios
-		// ((git|ssh|http(s)?)|(git@[\w\.-]+))(:(//)?)([\w\.@\:/\-~]+)(\.git)(/)?
-		re := regroup.MustCompile("git@(?P<gitprovider>[\\w\\.-]+):(?P<repo>[\\w\\.@\\:/\\-~]+)(\\.git)(/)?")
-		matches, _ := re.Groups(repoName)
-		gitprovider := matches["gitprovider"]
-		repo := matches["repo"]
-		fetchURL := fmt.Sprintf("https://%s/%s.git", gitprovider, repo)
-		return fetchURL, pushURL
-	default:
-		fmt.Printf("Warning - cannot parse fetch and push repos\n")
-	}
-	return repoName, repoName
+// terminateFailedInstance terminates the instance of a task which failed to
+// start; a failure to terminate is only reported, as the error of the task
+// is the one returned
+func terminateFailedInstance(ec2Client *ec2.EC2, instanceID string) {
+	pterm.Warning.Printf("Terminating instance %v\n", instanceID)
+	_, err := ec2Client.TerminateInstances(&ec2.TerminateInstancesInput{
+		InstanceIds: []*string{aws.String(instanceID)},
+	})
+	if err != nil {
+		pterm.Warning.Printf("Error terminating instance %v: %v - terminate it with gltr kill-task\n", instanceID, err)
+	}
+}
+
+// dockerTaskEnvironment returns the environment of the task container as
+// KEY=VALUE pairs; values which may contain spaces or newlines are base64
+// encoded so the pairs can also be written to a docker env file. Keys are
+// not part of the environment, see taskSecrets.
+func dockerTaskEnvironment(gt Task, config Config) (env []string) {
+	b64EncodedSSHKey := base64.StdEncoding.EncodeToString([]byte(gt.AuthorizedKeys(config.User)))
+	b64EncodedUserName := base64.StdEncoding.EncodeToString([]byte(config.User.Name))
+	b64EncodedUserEmail := base64.StdEncoding.EncodeToString([]byte(config.User.Email))
+
+	repoFetch, repoPush := gt.FetchAndPushRepos()
+
+	env = append(env, fmt.Sprintf("SSH_PUBLIC_KEY=%v", b64EncodedSSHKey))
+	env = append(env, fmt.Sprintf("GIT_REPO_FETCH=%v", repoFetch))
+	env = append(env, fmt.Sprintf("GIT_REPO_PUSH=%v", repoPush))
+	env = append(env, fmt.Sprintf("GLTR_GIT_ACCESS=%v", gt.GitAccessMode()))
+	env = append(env, fmt.Sprintf("GLTR_PROJECT_ID=%v", gt.ProjectID))
+	env = append(env, fmt.Sprintf("GLTR_PROJECT_NAME=%v", gt.ProjectName))
+	env = append(env, fmt.Sprintf("GLTR_USER_NAME=%v", b64EncodedUserName))
+	env = append(env, fmt.Sprintf("GLTR_USER_EMAIL=%v", b64EncodedUserEmail))
+	if vscodeExtensions, vscodeCommit := vscodeEnvironment(gt); vscodeExtensions != "" {
+		env = append(env, fmt.Sprintf("GLTR_VSCODE_EXTENSIONS=%v", vscodeExtensions))
+		env = append(env, fmt.Sprintf("GLTR_VSCODE_COMMIT=%v", vscodeCommit))
+	}
+	if userAccounts := gt.UserAccountsSpec(); userAccounts != "" {
+		env = append(env, fmt.Sprintf("GLTR_USER_ACCOUNTS=%v", base64.StdEncoding.EncodeToString([]byte(userAccounts))))
+	}
+	return
 }
 
-func createDockerRunInstruction(
+// dockerRunArguments returns the docker run arguments which follow the
+// environment: gpus, labels, hostname, ports, name and image. Without
+// dynamic port assignment the container sshd is published on sshPort.
+func dockerRunArguments(
 	gt Task,
-	config Config,
-	privateKey []byte,
 	taskID string,
 	dynamicPortAssignment bool,
 	hostname string,
 	useGpus bool,
-) (command []string) {
-
-	b64EncodedPrivateKey := base64.StdEncoding.EncodeToString(privateKey)
-	user := gt.Users[0]
-	b64EncodedSSHKey := base64.StdEncoding.EncodeToString([]byte(user.SshKey))
-	b64EncodedUserName := base64.StdEncoding.EncodeToString([]byte(config.User.Name))
-	b64EncodedUserEmail := base64.StdEncoding.EncodeToString([]byte(config.User.Email))
-
-	repoFetch, repoPush := getFetchAndPushRepos(gt.GitRepo)
-
-	// build the command...
-	command = append(command, "docker", "run", "--rm", "-d")
-	// // the pubkey contains spaces, so we need the quotes here...
-	envVar := fmt.Sprintf("SSH_PUBLIC_KEY=%v", b64EncodedSSHKey)
-	command = append(command, "-e", envVar)
-	envVar = fmt.Sprintf("GIT_REPO_FETCH=%v", repoFetch)
-	command = append(command, "-e", envVar)
-	envVar = fmt.Sprintf("GIT_REPO_PUSH=%v", repoPush)
-	command = append(command, "-e", envVar)
-	envVar = fmt.Sprintf("GLTR_PRIVATE_KEY=%v", b64EncodedPrivateKey)
-	command = append(command, "-e", envVar)
-	envVar = fmt.Sprintf("GLTR_PROJECT_ID=%v", gt.ProjectID)
-	command = append(command, "-e", envVar)
-	envVar = fmt.Sprintf("GLTR_PROJECT_NAME=%v", gt.ProjectName)
-	command = append(command, "-e", envVar)
-	envVar = fmt.Sprintf("GLTR_USER_NAME=%v", b64EncodedUserName)
-	command = append(command, "-e", envVar)
-	envVar = fmt.Sprintf("GLTR_USER_EMAIL=%v", b64EncodedUserEmail)
-	command = append(command, "-e", envVar)
+	sshPort int,
+) (args []string) {
 	if useGpus {
-		command = append(command, "--gpus", "all")
+		args = append(args, "--gpus", "all")
 	}
-	command = append(command, "-l", "gltr-managed=true")
-	envVar = fmt.Sprintf("gltr-task-id=%v", taskID)
-	command = append(command, "-l", envVar)
-	command = append(command, "--hostname", hostname)
+	args = append(args, "-l", "gltr-managed=true")
+	args = append(args, "-l", fmt.Sprintf("gltr-task-id=%v", taskID))
+	args = append(args, "-l", fmt.Sprintf("gltr-project=%v", gt.ProjectName))
+	args = append(args, "--hostname", hostname)
 	if dynamicPortAssignment {
 		// open ports, but we will need to determine wihch ports on the local
 		// machine have been bound
-		command = append(command, "-p", "8888", "-p", "22")
+		args = append(args, "-p", "8888", "-p", "22")
 	} else {
-		command = append(command, "-p", "8888:8888", "-p", "22:22")
+		args = append(args, "-p", "8888:8888", "-p", fmt.Sprintf("%v:22", sshPort))
+	}
+	args = append(args, "--name", gt.ProjectName)
+	args = append(args, gt.ContainerImage)
+	return
+}
+
+// createDockerCreateInstruction returns the docker command which creates the
+// task container with the secrets in secretsDir mounted read-only at
+// taskSecretsDir
+func createDockerCreateInstruction(
+	gt Task,
+	config Config,
+	taskID string,
+	dynamicPortAssignment bool,
+	hostname string,
+	useGpus bool,
+	secretsDir string,
+) (command []string) {
+
+	// build the command...
+	command = append(command, "docker", "create", "--rm")
+	command = append(command, "-v", fmt.Sprintf("%v:%v:ro", secretsDir, taskSecretsDir))
+	for _, envVar := range dockerTaskEnvironment(gt, config) {
+		command = append(command, "-e", envVar)
 	}
-	command = append(command, "--name", gt.ProjectName)
-	command = append(command, gt.ContainerImage)
+	command = append(command, dockerRunArguments(gt, taskID, dynamicPortAssignment, hostname, useGpus, 22)...)
 
 	return
 }
@@ -761,72 +827,16 @@ func createInstanceGcp(
 
 	log.Printf("Instance created (Id %v) with IP address %v\n", instanceID, instanceIPAddress)
 
-	return string(instanceID), instanceIPAddress, nil
+	return fmt.Sprint(instanceID), instanceIPAddress, nil
 }
 
-// this is currently not used....
-func RunGcp(gt Task, config Config, gltrPrivateKey []byte) error {
-
-	// launch VM
-	projectID := "gltr-testing"
-	zone := "us-central1-a"
-	instanceName := "gltr-instance"
-	machineType := "n1-standard-1"
-	sourceImage := "projects/ml-images/global/images/c0-deeplearning-common-cpu-v20230126-debian-10"
-	networkName := "global/networks/default"
-
-	var buf bytes.Buffer
-	_, publicDNSName, err := createInstanceGcp(
-		&buf,
-		projectID,
-		zone,
-		instanceName,
-		machineType,
-		sourceImage,
-		networkName,
-	)
-	if err != nil {
-		fmt.Printf("Error creating GCP instance: %s\n", err)
-		return err
-	}
-
-	client, err := waitForSSH(publicDNSName, gt, 22)
-	// log.Printf("conn = %v %v\n", conn, ag)
-	if err != nil {
-		fmt.Printf("Error establishing ssh connection: %v\n", err)
-		return err
-	}
-
-	// Each ClientConn can support multiple interactive sessions,
-	// represented by a Session.
-	session, err := client.NewSession()
-	if err != nil {
-		fmt.Printf("Failed to create session: %v", err)
-		os.Exit(1)
-	}
-	defer session.Close()
-
-	// Once a Session is created, you can execute a single command on
-	// the remote side using the Run method.
-	var b bytes.Buffer
-	session.Stdout = &b
-	taskID := generateTaskID()
-	commandArray := createDockerRunInstruction(gt, config, gltrPrivateKey, taskID, true, "gcp-testing", false)
-	dockerRunString := ""
-	for _, c := range commandArray {
-		dockerRunString = dockerRunString + c + " "
-	}
-	fmt.Printf("Running command: %v\n", dockerRunString)
+// ErrGcpNotSupported is returned by RunGcp: GCP instances are not given a
+// gltr host key or the project key yet, so a workspace on GCP could neither
+// be verified nor decrypt its secrets
+var ErrGcpNotSupported = errors.New("GCP is currently not supported")
 
-	if err := session.Run(dockerRunString); err != nil {
-		fmt.Printf("Failed to run: %v - retrying", err.Error())
-		time.Sleep(10 * time.Second)
-		fmt.Printf("trying again...")
-		if err := session.Run(dockerRunString); err != nil {
-			fmt.Printf("Giving up after second attempt...\n")
-			os.Exit(1)
-		}
-	}
-	fmt.Println(b.String())
-	return nil
+// RunGcp runs the project on GCP Compute Engine, which is not supported yet;
+// createInstanceGcp is the start of it
+func RunGcp(gt Task, config Config, gltrPrivateKey []byte) error {
+	return ErrGcpNotSupported
 }
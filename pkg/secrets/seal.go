@@ -0,0 +1,77 @@
+package secrets
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/agessh"
+	"filippo.io/age/armor"
+)
+
+// Seal encrypts the data for the ssh ed25519 public keys, in authorized keys
+// format, as an armored age file; it is used to hand the project key to
+// other users
+func Seal(data []byte, sshPublicKeys ...[]byte) ([]byte, error) {
+	if len(sshPublicKeys) == 0 {
+		return nil, errors.New("no key to encrypt for")
+	}
+	var recipients []age.Recipient
+	for _, k := range sshPublicKeys {
+		key := strings.TrimSpace(string(k))
+		if !strings.HasPrefix(key, "ssh-ed25519 ") {
+			return nil, errors.New("only ssh ed25519 keys are supported")
+		}
+		r, err := agessh.ParseRecipient(key)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing ssh key: %w", err)
+		}
+		recipients = append(recipients, r)
+	}
+
+	var buf bytes.Buffer
+	armorWriter := armor.NewWriter(&buf)
+	w, err := age.Encrypt(armorWriter, recipients...)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	if err := armorWriter.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Unseal decrypts data encrypted by Seal with the first of the ssh private
+// keys it is encrypted for
+func Unseal(sealed []byte, sshPrivateKeys ...[]byte) ([]byte, error) {
+	if len(sshPrivateKeys) == 0 {
+		return nil, errors.New("no key to decrypt with")
+	}
+	var identities []age.Identity
+	for _, k := range sshPrivateKeys {
+		identity, err := agessh.ParseIdentity(k)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing ssh key: %w", err)
+		}
+		identities = append(identities, identity)
+	}
+
+	r, err := age.Decrypt(armor.NewReader(bytes.NewReader(sealed)), identities...)
+	var noMatch *age.NoIdentityMatchError
+	if errors.As(err, &noMatch) {
+		return nil, ErrNoMatchingKey
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error decrypting: %w", err)
+	}
+	return io.ReadAll(r)
+}
@@ -0,0 +1,321 @@
+// Package secrets reads and writes the sops encrypted secrets file of a
+// project. The file is encrypted with age for recipients derived from ssh
+// ed25519 keys; the age identity is derived from the ssh private key in
+// memory and never written to disk.
+package secrets
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	sshage "github.com/Mic92/ssh-to-age"
+	"go.mozilla.org/sops/v3"
+	sopsaes "go.mozilla.org/sops/v3/aes"
+	"go.mozilla.org/sops/v3/age"
+	"go.mozilla.org/sops/v3/cmd/sops/common"
+	"go.mozilla.org/sops/v3/logging"
+	sopsyaml "go.mozilla.org/sops/v3/stores/yaml"
+)
+
+func init() {
+	// the age keys are tried one after the other and a key which does not fit
+	// is expected, so the failures are reported by Open rather than logged
+	if ageLogger, ok := logging.Loggers["AGE"]; ok {
+		ageLogger.SetOutput(io.Discard)
+	}
+}
+
+// DefaultFileName is the name of the secrets file in the project directory
+const DefaultFileName = "gltr-secrets.yaml"
+
+// ErrNoMatchingKey is returned by Open if the secrets file is not encrypted
+// for any of the keys
+var ErrNoMatchingKey = errors.New("secrets file is not encrypted for any of the keys")
+
+// the sops version recorded in the metadata of new files
+const sopsVersion = "3.7.3"
+
+// File is an opened secrets file; values are kept decrypted in memory and
+// every change is encrypted and written back to the file straight away
+type File struct {
+	path     string
+	metadata sops.Metadata
+	values   map[string][]byte
+}
+
+// Open decrypts the secrets file at path with the first of the ssh private
+// keys which it is encrypted for. If the file does not exist yet, an empty
+// file is returned which is encrypted for the public half of the first key
+// unless other recipients are set before the first secret is.
+func Open(path string, sshPrivateKeys ...[]byte) (*File, error) {
+	if len(sshPrivateKeys) == 0 {
+		return nil, errors.New("no key to open the secrets file with")
+	}
+	var identities age.ParsedIdentities
+	var recipients []string
+	for _, k := range sshPrivateKeys {
+		ageIdentity, ageRecipient, err := sshage.SSHPrivateKeyToAge(k, nil)
+		if err != nil {
+			return nil, fmt.Errorf("error deriving age key: %w", err)
+		}
+		if err := identities.Import(*ageIdentity); err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, *ageRecipient)
+	}
+
+	contents, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return newFile(path, recipients[:1])
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading secrets file: %w", err)
+	}
+	return decryptFile(path, contents, identities)
+}
+
+// Recipient returns the age recipient of an ssh public key in authorized
+// keys format; only ed25519 keys can be converted
+func Recipient(sshPublicKey []byte) (string, error) {
+	ageRecipient, err := sshage.SSHPublicKeyToAge(sshPublicKey)
+	if err != nil {
+		return "", fmt.Errorf("error converting ssh key to age: %w", err)
+	}
+	return *ageRecipient, nil
+}
+
+// PrivateKeyRecipient returns the age recipient of the ssh private key, ie
+// the recipient a file has to be encrypted for to be opened with the key
+func PrivateKeyRecipient(sshPrivateKey []byte) (string, error) {
+	_, ageRecipient, err := sshage.SSHPrivateKeyToAge(sshPrivateKey, nil)
+	if err != nil {
+		return "", fmt.Errorf("error deriving age key: %w", err)
+	}
+	return *ageRecipient, nil
+}
+
+// newFile returns an empty secrets file which is encrypted for the age
+// recipients
+func newFile(path string, recipients []string) (*File, error) {
+	var keyGroup sops.KeyGroup
+	for _, r := range recipients {
+		masterKey, err := age.MasterKeyFromRecipient(r)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing age recipient: %w", err)
+		}
+		keyGroup = append(keyGroup, masterKey)
+	}
+	return &File{
+		path: path,
+		metadata: sops.Metadata{
+			KeyGroups: []sops.KeyGroup{keyGroup},
+			Version:   sopsVersion,
+		},
+		values: map[string][]byte{},
+	}, nil
+}
+
+// decryptFile decrypts the contents of a secrets file and verifies its MAC
+func decryptFile(path string, contents []byte, identities age.ParsedIdentities) (*File, error) {
+	store := sopsyaml.Store{}
+	tree, err := store.LoadEncryptedFile(contents)
+	if err != nil {
+		return nil, fmt.Errorf("error loading secrets file: %w", err)
+	}
+
+	dataKey, err := decryptDataKey(tree.Metadata, identities)
+	if err != nil {
+		return nil, err
+	}
+
+	cipher := sopsaes.NewCipher()
+	mac, err := tree.Decrypt(dataKey, cipher)
+	if err != nil {
+		return nil, fmt.Errorf("error decrypting secrets file: %w", err)
+	}
+	// Compute the hash of the cleartext tree and compare it with
+	// the one that was stored in the document. If they match,
+	// integrity was preserved
+	originalMac, err := cipher.Decrypt(
+		tree.Metadata.MessageAuthenticationCode,
+		dataKey,
+		tree.Metadata.LastModified.Format(time.RFC3339),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error decrypting MAC of secrets file: %w", err)
+	}
+	if originalMac != mac {
+		return nil, fmt.Errorf("failed to verify data integrity of secrets file: expected mac %q, got %q", originalMac, mac)
+	}
+
+	values := map[string][]byte{}
+	for _, branch := range tree.Branches {
+		for _, item := range branch {
+			key, ok := item.Key.(string)
+			if !ok {
+				continue
+			}
+			encoded, ok := item.Value.(string)
+			if !ok {
+				return nil, fmt.Errorf("secret %v is not a string", key)
+			}
+			value, err := base64.StdEncoding.DecodeString(encoded)
+			if err != nil {
+				return nil, fmt.Errorf("secret %v is not base64 encoded: %w", key, err)
+			}
+			values[key] = value
+		}
+	}
+	return &File{path: path, metadata: tree.Metadata, values: values}, nil
+}
+
+// decryptDataKey decrypts the sops data key with the first age key of the
+// metadata which the identities can decrypt
+func decryptDataKey(metadata sops.Metadata, identities age.ParsedIdentities) ([]byte, error) {
+	var errs []error
+	for _, group := range metadata.KeyGroups {
+		for _, k := range group {
+			ageKey, ok := k.(*age.MasterKey)
+			if !ok {
+				continue
+			}
+			identities.ApplyToMasterKey(ageKey)
+			dataKey, err := ageKey.Decrypt()
+			if err == nil {
+				return dataKey, nil
+			}
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) == 0 {
+		return nil, errors.New("secrets file has no age recipients")
+	}
+	return nil, fmt.Errorf("%w: %v", ErrNoMatchingKey, errs[0])
+}
+
+// Get returns the value of the secret
+func (f *File) Get(key string) ([]byte, bool) {
+	value, ok := f.values[key]
+	return value, ok
+}
+
+// Set sets the value of the secret and writes the file
+func (f *File) Set(key string, value []byte) error {
+	f.values[key] = value
+	return f.write()
+}
+
+// Delete removes the secret and writes the file; it returns false if the
+// secret does not exist
+func (f *File) Delete(key string) (bool, error) {
+	if _, ok := f.values[key]; !ok {
+		return false, nil
+	}
+	delete(f.values, key)
+	return true, f.write()
+}
+
+// List returns the names of the secrets in sorted order
+func (f *File) List() []string {
+	var names []string
+	for k := range f.values {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Replace replaces all secrets with the values and writes the file
+func (f *File) Replace(values map[string][]byte) error {
+	f.values = map[string][]byte{}
+	for k, v := range values {
+		f.values[k] = v
+	}
+	return f.write()
+}
+
+// Recipients returns the age recipients the file is encrypted for
+func (f *File) Recipients() []string {
+	var recipients []string
+	for _, group := range f.metadata.KeyGroups {
+		for _, k := range group {
+			if ageKey, ok := k.(*age.MasterKey); ok {
+				recipients = append(recipients, ageKey.Recipient)
+			}
+		}
+	}
+	return recipients
+}
+
+// SetRecipients makes the file be encrypted for the age recipients instead
+// of its current ones the next time it is written
+func (f *File) SetRecipients(recipients []string) error {
+	if len(recipients) == 0 {
+		return errors.New("secrets file needs at least one recipient")
+	}
+	rekeyed, err := newFile(f.path, recipients)
+	if err != nil {
+		return err
+	}
+	f.metadata = rekeyed.metadata
+	return nil
+}
+
+// Rekey encrypts the file for the age recipients instead of its current
+// ones and writes it; only keys of the new recipients can open it afterwards
+func (f *File) Rekey(recipients []string) error {
+	metadata := f.metadata
+	if err := f.SetRecipients(recipients); err != nil {
+		return err
+	}
+	if err := f.write(); err != nil {
+		f.metadata = metadata
+		return err
+	}
+	return nil
+}
+
+// write encrypts the secrets with a new data key and writes the file; values
+// are stored base64 encoded so that files and binary values survive yaml
+func (f *File) write() error {
+	branch := sops.TreeBranch{}
+	for _, k := range f.List() {
+		branch = append(branch, sops.TreeItem{
+			Key:   k,
+			Value: base64.StdEncoding.EncodeToString(f.values[k]),
+		})
+	}
+	tree := sops.Tree{
+		Branches: []sops.TreeBranch{branch},
+		Metadata: f.metadata,
+		FilePath: f.path,
+	}
+	dataKey, errs := tree.GenerateDataKey()
+	if len(errs) > 0 {
+		return fmt.Errorf("could not generate data key: %v", errs)
+	}
+	err := common.EncryptTree(common.EncryptTreeOpts{
+		DataKey: dataKey,
+		Tree:    &tree,
+		Cipher:  sopsaes.NewCipher(),
+	})
+	if err != nil {
+		return fmt.Errorf("error encrypting secrets: %w", err)
+	}
+
+	store := sopsyaml.Store{}
+	encrypted, err := store.EmitEncryptedFile(tree)
+	if err != nil {
+		return fmt.Errorf("error encoding secrets file: %w", err)
+	}
+	if err := os.WriteFile(f.path, encrypted, 0600); err != nil {
+		return fmt.Errorf("error writing secrets file: %w", err)
+	}
+	f.metadata = tree.Metadata
+	return nil
+}
@@ -0,0 +1,201 @@
+package secrets
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mikesmitty/edkey"
+	"golang.org/x/crypto/ssh"
+)
+
+// newTestKey returns a throwaway ed25519 key pair in the formats gltr keeps
+// project keys in: an OpenSSH PEM private key and an authorized keys line
+func newTestKey(t *testing.T) (privateKey []byte, publicKey []byte) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sshPublicKey, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{
+		Type:  "OPENSSH PRIVATE KEY",
+		Bytes: edkey.MarshalED25519PrivateKey(priv),
+	}), ssh.MarshalAuthorizedKey(sshPublicKey)
+}
+
+func TestRoundTrip(t *testing.T) {
+	privateKey, _ := newTestKey(t)
+	path := filepath.Join(t.TempDir(), DefaultFileName)
+
+	f, err := Open(path, privateKey)
+	if err != nil {
+		t.Fatalf("Open of a new file: %v", err)
+	}
+	if names := f.List(); len(names) != 0 {
+		t.Fatalf("new file has secrets %v", names)
+	}
+	if err := f.Set("token", []byte("s3cret")); err != nil {
+		t.Fatal(err)
+	}
+	// values are stored base64 encoded, so binary values survive yaml
+	if err := f.Set("cert", []byte{0, 1, 2, 0xff, '\n'}); err != nil {
+		t.Fatal(err)
+	}
+	if value, ok := f.Get("token"); !ok || string(value) != "s3cret" {
+		t.Fatalf("Get(token) = %q, %v", value, ok)
+	}
+	if names := f.List(); !reflect.DeepEqual(names, []string{"cert", "token"}) {
+		t.Fatalf("List() = %v", names)
+	}
+
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(contents), "s3cret") {
+		t.Fatalf("secrets file contains a value in clear text:\n%s", contents)
+	}
+
+	reopened, err := Open(path, privateKey)
+	if err != nil {
+		t.Fatalf("reopening: %v", err)
+	}
+	if value, ok := reopened.Get("cert"); !ok || !reflect.DeepEqual(value, []byte{0, 1, 2, 0xff, '\n'}) {
+		t.Fatalf("Get(cert) after reopening = %v, %v", value, ok)
+	}
+
+	deleted, err := reopened.Delete("token")
+	if err != nil || !deleted {
+		t.Fatalf("Delete(token) = %v, %v", deleted, err)
+	}
+	deleted, err = reopened.Delete("token")
+	if err != nil || deleted {
+		t.Fatalf("Delete of a missing secret = %v, %v", deleted, err)
+	}
+	reopened, err = Open(path, privateKey)
+	if err != nil {
+		t.Fatalf("reopening after Delete: %v", err)
+	}
+	if names := reopened.List(); !reflect.DeepEqual(names, []string{"cert"}) {
+		t.Fatalf("List() after Delete = %v", names)
+	}
+}
+
+func TestTamperedFileFailsMAC(t *testing.T) {
+	privateKey, _ := newTestKey(t)
+	path := filepath.Join(t.TempDir(), DefaultFileName)
+
+	f, err := Open(path, privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Set("a", []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Set("b", []byte("2")); err != nil {
+		t.Fatal(err)
+	}
+
+	// every remaining value still decrypts, only the MAC shows that a secret
+	// has been removed
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tampered []string
+	for _, line := range strings.Split(string(contents), "\n") {
+		if !strings.HasPrefix(line, "b: ") {
+			tampered = append(tampered, line)
+		}
+	}
+	if len(tampered) == len(strings.Split(string(contents), "\n")) {
+		t.Fatalf("secret b not found in:\n%s", contents)
+	}
+	if err := os.WriteFile(path, []byte(strings.Join(tampered, "\n")), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = Open(path, privateKey)
+	if err == nil || !strings.Contains(err.Error(), "data integrity") {
+		t.Fatalf("Open of a tampered file = %v, want a MAC error", err)
+	}
+}
+
+func TestWrongKey(t *testing.T) {
+	privateKey, _ := newTestKey(t)
+	otherKey, _ := newTestKey(t)
+	path := filepath.Join(t.TempDir(), DefaultFileName)
+
+	f, err := Open(path, privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Set("a", []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Open(path, otherKey); !errors.Is(err, ErrNoMatchingKey) {
+		t.Fatalf("Open with the wrong key = %v, want ErrNoMatchingKey", err)
+	}
+	// the keys are tried in turn
+	if _, err := Open(path, otherKey, privateKey); err != nil {
+		t.Fatalf("Open with the right key second: %v", err)
+	}
+}
+
+func TestRekey(t *testing.T) {
+	oldKey, _ := newTestKey(t)
+	newKey, newPublicKey := newTestKey(t)
+	path := filepath.Join(t.TempDir(), DefaultFileName)
+
+	f, err := Open(path, oldKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Set("a", []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+
+	recipient, err := Recipient(newPublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateKeyRecipient, err := PrivateKeyRecipient(newKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recipient != privateKeyRecipient {
+		t.Fatalf("recipients of the halves of a key pair differ: %v, %v", recipient, privateKeyRecipient)
+	}
+	if err := f.Rekey([]string{recipient}); err != nil {
+		t.Fatal(err)
+	}
+	if recipients := f.Recipients(); !reflect.DeepEqual(recipients, []string{recipient}) {
+		t.Fatalf("Recipients() = %v", recipients)
+	}
+
+	if _, err := Open(path, oldKey); !errors.Is(err, ErrNoMatchingKey) {
+		t.Fatalf("Open with the old key after Rekey = %v, want ErrNoMatchingKey", err)
+	}
+	rekeyed, err := Open(path, newKey)
+	if err != nil {
+		t.Fatalf("Open with the new key after Rekey: %v", err)
+	}
+	if value, ok := rekeyed.Get("a"); !ok || string(value) != "1" {
+		t.Fatalf("Get(a) after Rekey = %q, %v", value, ok)
+	}
+
+	if err := rekeyed.Rekey(nil); err == nil {
+		t.Fatal("Rekey without recipients succeeded")
+	}
+}
@@ -0,0 +1,433 @@
+package gltr
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/pterm/pterm"
+	"github.com/samber/lo"
+)
+
+// these return the caller's public address as plain text; the first only
+// answers over IPv4 and the second only over IPv6
+var publicIPServices = []string{
+	"https://checkip.amazonaws.com",
+	"https://api6.ipify.org",
+}
+
+var errNotGltrManaged = errors.New("security group is not managed by gltr")
+
+// SecurityGroupIngress describes the ingress rules which gltr maintains on a
+// security group; every port is opened to every CIDR and source group
+type SecurityGroupIngress struct {
+	Ports                  []int
+	CIDRs                  []string
+	SourceSecurityGroupIDs []string
+	// CIDRs of single users keyed by user, whose rules are marked with the
+	// user. The rules of users who are not in the map were added by them
+	// and are kept; if the map is nil the rules of all users are revoked.
+	UserCIDRs map[string][]string
+}
+
+// the description of the rules gltr adds; rules for the CIDRs of a user
+// carry the user after userRulePrefix
+const (
+	ruleDescription = "gltr"
+	userRulePrefix  = "gltr user "
+)
+
+// security group rule descriptions only allow these characters
+var ruleDescriptionInvalidChars = regexp.MustCompile(`[^a-zA-Z0-9. _:/()#,@\[\]+=&;{}!$*-]+`)
+
+// ruleOwner returns how the rules for the CIDRs of the user are marked: their
+// email or else their name
+func ruleOwner(u User) string {
+	owner := strings.TrimSpace(u.Email)
+	if owner == "" {
+		owner = strings.TrimSpace(u.Name)
+	}
+	owner = ruleDescriptionInvalidChars.ReplaceAllString(owner, "-")
+	if owner == "" {
+		owner = "unknown"
+	}
+	if limit := 255 - len(userRulePrefix); len(owner) > limit {
+		owner = owner[:limit]
+	}
+	return owner
+}
+
+// NormalizeCIDR turns a plain IP address into a single host CIDR and checks
+// that CIDRs are valid
+func NormalizeCIDR(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if ip := net.ParseIP(s); ip != nil {
+		if ip.To4() != nil {
+			return fmt.Sprintf("%v/32", ip), nil
+		}
+		return fmt.Sprintf("%v/128", ip), nil
+	}
+	_, ipNet, err := net.ParseCIDR(s)
+	if err != nil {
+		return "", fmt.Errorf("invalid CIDR %v", s)
+	}
+	return ipNet.String(), nil
+}
+
+// NormalizeCIDRs normalizes a list of CIDRs, dropping empty entries
+func NormalizeCIDRs(cidrs []string) ([]string, error) {
+	var normalized []string
+	for _, c := range cidrs {
+		if strings.TrimSpace(c) == "" {
+			continue
+		}
+		n, err := NormalizeCIDR(c)
+		if err != nil {
+			return nil, err
+		}
+		normalized = append(normalized, n)
+	}
+	return normalized, nil
+}
+
+// DetectCallerCIDRs returns single host CIDRs for the public IPv4 and IPv6
+// addresses of this machine; an error is only returned if neither address
+// can be determined
+func DetectCallerCIDRs() ([]string, error) {
+	client := http.Client{Timeout: 5 * time.Second}
+	var cidrs []string
+	for _, url := range publicIPServices {
+		resp, err := client.Get(url)
+		if err != nil {
+			continue
+		}
+		body, err := io.ReadAll(io.LimitReader(resp.Body, 256))
+		resp.Body.Close()
+		if err != nil || resp.StatusCode != http.StatusOK {
+			continue
+		}
+		cidr, err := NormalizeCIDR(string(body))
+		if err != nil {
+			continue
+		}
+		cidrs = append(cidrs, cidr)
+	}
+	if len(cidrs) == 0 {
+		return nil, errors.New("unable to determine public IP address - specify CIDRs explicitly")
+	}
+	return cidrs, nil
+}
+
+// ingressPermission returns the permission which opens a single tcp port to
+// a single CIDR or source security group
+func ingressPermission(port int64, source string, description string) *ec2.IpPermission {
+	permission := &ec2.IpPermission{
+		IpProtocol: aws.String("tcp"),
+		FromPort:   aws.Int64(port),
+		ToPort:     aws.Int64(port),
+	}
+	switch {
+	case strings.HasPrefix(source, "sg-"):
+		permission.UserIdGroupPairs = []*ec2.UserIdGroupPair{
+			{GroupId: aws.String(source), Description: aws.String(description)},
+		}
+	case strings.Contains(source, ":"):
+		permission.Ipv6Ranges = []*ec2.Ipv6Range{
+			{CidrIpv6: aws.String(source), Description: aws.String(description)},
+		}
+	default:
+		permission.IpRanges = []*ec2.IpRange{
+			{CidrIp: aws.String(source), Description: aws.String(description)},
+		}
+	}
+	return permission
+}
+
+// ingressRuleKey identifies a single port/source rule
+func ingressRuleKey(permission *ec2.IpPermission, source string) string {
+	return fmt.Sprintf(
+		"%v/%v-%v/%v",
+		aws.StringValue(permission.IpProtocol),
+		aws.Int64Value(permission.FromPort),
+		aws.Int64Value(permission.ToPort),
+		source,
+	)
+}
+
+// desiredIngressRules returns the permissions for the ingress, keyed by rule
+func desiredIngressRules(ingress SecurityGroupIngress) map[string]*ec2.IpPermission {
+	var sources []string
+	sources = append(sources, ingress.CIDRs...)
+	sources = append(sources, ingress.SourceSecurityGroupIDs...)
+
+	rules := map[string]*ec2.IpPermission{}
+	for _, p := range ingress.Ports {
+		for _, s := range sources {
+			permission := ingressPermission(int64(p), s, ruleDescription)
+			rules[ingressRuleKey(permission, s)] = permission
+		}
+		for _, user := range sortedUsers(ingress.UserCIDRs) {
+			for _, c := range ingress.UserCIDRs[user] {
+				key := ingressRuleKey(ingressPermission(int64(p), c, ""), c)
+				if _, ok := rules[key]; !ok {
+					rules[key] = ingressPermission(int64(p), c, userRulePrefix+user)
+				}
+			}
+		}
+	}
+	return rules
+}
+
+func sortedUsers(userCIDRs map[string][]string) []string {
+	var users []string
+	for u := range userCIDRs {
+		users = append(users, u)
+	}
+	sort.Strings(users)
+	return users
+}
+
+// otherUsersRules returns the keys of the rules which users who are not in
+// the ingress added for their CIDRs on its ports
+func otherUsersRules(permissions []*ec2.IpPermission, ingress SecurityGroupIngress) map[string]bool {
+	kept := map[string]bool{}
+	if ingress.UserCIDRs == nil {
+		return kept
+	}
+	ports := map[int64]bool{}
+	for _, p := range ingress.Ports {
+		ports[int64(p)] = true
+	}
+	otherUser := func(description *string) bool {
+		d := aws.StringValue(description)
+		if !strings.HasPrefix(d, userRulePrefix) {
+			return false
+		}
+		_, ok := ingress.UserCIDRs[strings.TrimPrefix(d, userRulePrefix)]
+		return !ok
+	}
+	for _, p := range permissions {
+		if aws.StringValue(p.IpProtocol) != "tcp" ||
+			aws.Int64Value(p.FromPort) != aws.Int64Value(p.ToPort) || !ports[aws.Int64Value(p.FromPort)] {
+			continue
+		}
+		for _, r := range p.IpRanges {
+			if otherUser(r.Description) {
+				kept[ingressRuleKey(p, aws.StringValue(r.CidrIp))] = true
+			}
+		}
+		for _, r := range p.Ipv6Ranges {
+			if otherUser(r.Description) {
+				kept[ingressRuleKey(p, aws.StringValue(r.CidrIpv6))] = true
+			}
+		}
+	}
+	return kept
+}
+
+// existingIngressRules splits the permissions of a security group into
+// single port/source rules, keyed the same way as desiredIngressRules
+func existingIngressRules(permissions []*ec2.IpPermission) map[string]*ec2.IpPermission {
+	rules := map[string]*ec2.IpPermission{}
+	for _, p := range permissions {
+		for _, r := range p.IpRanges {
+			rule := &ec2.IpPermission{
+				IpProtocol: p.IpProtocol, FromPort: p.FromPort, ToPort: p.ToPort,
+				IpRanges: []*ec2.IpRange{{CidrIp: r.CidrIp}},
+			}
+			rules[ingressRuleKey(p, aws.StringValue(r.CidrIp))] = rule
+		}
+		for _, r := range p.Ipv6Ranges {
+			rule := &ec2.IpPermission{
+				IpProtocol: p.IpProtocol, FromPort: p.FromPort, ToPort: p.ToPort,
+				Ipv6Ranges: []*ec2.Ipv6Range{{CidrIpv6: r.CidrIpv6}},
+			}
+			rules[ingressRuleKey(p, aws.StringValue(r.CidrIpv6))] = rule
+		}
+		for _, g := range p.UserIdGroupPairs {
+			rule := &ec2.IpPermission{
+				IpProtocol: p.IpProtocol, FromPort: p.FromPort, ToPort: p.ToPort,
+				UserIdGroupPairs: []*ec2.UserIdGroupPair{{GroupId: g.GroupId}},
+			}
+			rules[ingressRuleKey(p, aws.StringValue(g.GroupId))] = rule
+		}
+	}
+	return rules
+}
+
+func sortedRuleKeys(rules map[string]*ec2.IpPermission) []string {
+	var keys []string
+	for k := range rules {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// staleIngressRules returns the keys of the rules of the permissions which
+// are not in the ingress and were not added by other users
+func staleIngressRules(permissions []*ec2.IpPermission, ingress SecurityGroupIngress) []string {
+	desired := desiredIngressRules(ingress)
+	kept := otherUsersRules(permissions, ingress)
+	var stale []string
+	for _, k := range sortedRuleKeys(existingIngressRules(permissions)) {
+		if _, ok := desired[k]; !ok && !kept[k] {
+			stale = append(stale, k)
+		}
+	}
+	return stale
+}
+
+// syncSecurityGroupIngress makes the ingress rules of the security group
+// match the given ingress: missing rules are added and all other rules,
+// except those of other users, are revoked. This must only be used on gltr
+// managed security groups.
+func syncSecurityGroupIngress(svc *ec2.EC2, securityGroupID string, ingress SecurityGroupIngress) (added, removed int, err error) {
+	describeSecurityGroupsOutput, err := svc.DescribeSecurityGroups(&ec2.DescribeSecurityGroupsInput{
+		GroupIds: []*string{aws.String(securityGroupID)},
+	})
+	if err != nil {
+		return 0, 0, fmt.Errorf("error describing security group %v: %w", securityGroupID, err)
+	}
+	if len(describeSecurityGroupsOutput.SecurityGroups) != 1 {
+		return 0, 0, fmt.Errorf("security group %v not found", securityGroupID)
+	}
+	securityGroup := describeSecurityGroupsOutput.SecurityGroups[0]
+	if getEc2Tag(securityGroup.Tags, "gltr-managed") == nil {
+		return 0, 0, fmt.Errorf("%v: %w", securityGroupID, errNotGltrManaged)
+	}
+
+	desired := desiredIngressRules(ingress)
+	existing := existingIngressRules(securityGroup.IpPermissions)
+
+	var toRevoke []*ec2.IpPermission
+	for _, k := range staleIngressRules(securityGroup.IpPermissions, ingress) {
+		toRevoke = append(toRevoke, existing[k])
+	}
+	if len(toRevoke) > 0 {
+		_, err = svc.RevokeSecurityGroupIngress(&ec2.RevokeSecurityGroupIngressInput{
+			GroupId:       aws.String(securityGroupID),
+			IpPermissions: toRevoke,
+		})
+		if err != nil {
+			return 0, 0, fmt.Errorf("error removing stale rules from %v: %w", securityGroupID, err)
+		}
+	}
+
+	var toAuthorize []*ec2.IpPermission
+	for _, k := range sortedRuleKeys(desired) {
+		if _, ok := existing[k]; !ok {
+			toAuthorize = append(toAuthorize, desired[k])
+		}
+	}
+	if len(toAuthorize) > 0 {
+		_, err = svc.AuthorizeSecurityGroupIngress(&ec2.AuthorizeSecurityGroupIngressInput{
+			GroupId:       aws.String(securityGroupID),
+			IpPermissions: toAuthorize,
+		})
+		if err != nil {
+			return 0, len(toRevoke), fmt.Errorf("error adding rules to %v: %w", securityGroupID, err)
+		}
+	}
+	return len(toAuthorize), len(toRevoke), nil
+}
+
+// SyncSecurityGroupIngress updates the rules of a gltr managed security
+// group to match the given ingress
+func SyncSecurityGroupIngress(securityGroupID string, ingress SecurityGroupIngress) error {
+	_, ec2Client, err := getEc2Client()
+	if err != nil {
+		return err
+	}
+	added, removed, err := syncSecurityGroupIngress(ec2Client, securityGroupID, ingress)
+	if err != nil {
+		return err
+	}
+	pterm.Success.Printf(
+		"Security group %v updated (%v rule(s) added, %v stale rule(s) removed)\n",
+		securityGroupID, added, removed,
+	)
+	return nil
+}
+
+// projectIngress returns the ingress rules for a project security group. In
+// public mode the project ports are opened to the CIDRs of the project and
+// of the user, keeping those other users allowed; in bastion mode only to
+// the bastion; in ssm mode no ingress is needed since the SSM agent connects
+// outwards. A non-zero sshPort, the port EC2 instances publish the container
+// sshd on, is opened along with the project ports.
+func projectIngress(gt Task, config Config, mode ConnectionMode, sshPort int) SecurityGroupIngress {
+	awsConfig := config.ProviderConfiguration.AWS
+	ports := gt.Ports
+	if sshPort != 0 && !lo.Contains(ports, sshPort) {
+		ports = append(append([]int{}, ports...), sshPort)
+	}
+	switch mode {
+	case ConnectionSSM:
+		return SecurityGroupIngress{}
+	case ConnectionBastion:
+		if awsConfig.Bastion.SecurityGroupID == "" {
+			return SecurityGroupIngress{}
+		}
+		return SecurityGroupIngress{
+			Ports:                  ports,
+			SourceSecurityGroupIDs: []string{awsConfig.Bastion.SecurityGroupID},
+		}
+	default:
+		return SecurityGroupIngress{
+			Ports: ports,
+			CIDRs: gt.AllowedCIDRs,
+			UserCIDRs: map[string][]string{
+				ruleOwner(config.User): config.AllowedCIDRs[gt.ProjectID],
+			},
+		}
+	}
+}
+
+// UpdateProjectIngress brings the rules of the project security groups in
+// line with the allowed CIDRs of the project and the user and with the
+// connection modes. Security groups which were not created by gltr are left
+// untouched, as are those of other AWS environments.
+func UpdateProjectIngress(gt Task, config Config) error {
+	awsConfig := config.ProviderConfiguration.AWS
+	for _, c := range gt.ExecutionPlatformConfigs {
+		if !gt.inAWSEnvironment(c.Configuration) {
+			continue
+		}
+		var securityGroupID string
+		var mode ConnectionMode
+		var sshPort int
+		switch pc := c.Configuration.(type) {
+		case Ec2ProjectConfig:
+			securityGroupID, mode = pc.SecurityGroupID, pc.ConnectionMode
+			sshPort = gt.Ec2SSHLogin(config).Port
+		case EcsProjectConfig:
+			securityGroupID, mode = pc.SecurityGroupID, pc.ConnectionMode
+		default:
+			continue
+		}
+		if securityGroupID == "" {
+			continue
+		}
+		if mode == ConnectionBastion && awsConfig.Bastion.SecurityGroupID == "" {
+			pterm.Warning.Printf("No bastion configured - %v workspaces will not be reachable\n", c.Type.ToString())
+		}
+		err := SyncSecurityGroupIngress(securityGroupID, projectIngress(gt, config, mode, sshPort))
+		if err != nil {
+			if errors.Is(err, errNotGltrManaged) {
+				pterm.Warning.Printf("Skipping security group %v: %v\n", securityGroupID, err)
+				continue
+			}
+			return err
+		}
+	}
+	return nil
+}
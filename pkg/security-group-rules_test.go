@@ -0,0 +1,111 @@
+package gltr
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+func TestRuleOwner(t *testing.T) {
+	tests := []struct {
+		user User
+		want string
+	}{
+		{User{Name: "Alice", Email: "alice@example.com"}, "alice@example.com"},
+		{User{Name: "Alice Ångström"}, "Alice -ngstr-m"},
+		{User{}, "unknown"},
+	}
+	for _, tt := range tests {
+		if got := ruleOwner(tt.user); got != tt.want {
+			t.Errorf("ruleOwner(%v) = %q, want %q", tt.user, got, tt.want)
+		}
+	}
+}
+
+func TestProjectIngressKeepsOtherUsers(t *testing.T) {
+	permissions := []*ec2.IpPermission{{
+		IpProtocol: aws.String("tcp"),
+		FromPort:   aws.Int64(22),
+		ToPort:     aws.Int64(22),
+		IpRanges: []*ec2.IpRange{
+			{CidrIp: aws.String("192.0.2.1/32"), Description: aws.String("gltr user alice@example.com")},
+			{CidrIp: aws.String("198.51.100.7/32"), Description: aws.String("gltr user bob@example.com")},
+			// a shared CIDR which has been removed from the gltr file
+			{CidrIp: aws.String("203.0.113.0/24"), Description: aws.String("gltr")},
+		},
+	}, {
+		// a port which has been removed from the project
+		IpProtocol: aws.String("tcp"),
+		FromPort:   aws.Int64(8888),
+		ToPort:     aws.Int64(8888),
+		IpRanges: []*ec2.IpRange{
+			{CidrIp: aws.String("198.51.100.7/32"), Description: aws.String("gltr user bob@example.com")},
+		},
+	}}
+	gt := Task{ProjectID: "project", Ports: []int{22}}
+	alice := Config{
+		User:         User{Name: "Alice", Email: "alice@example.com"},
+		AllowedCIDRs: map[string][]string{"project": {"192.0.2.99/32"}},
+	}
+
+	ingress := projectIngress(gt, alice, ConnectionPublic, 0)
+	want := []string{"tcp/22-22/192.0.2.1/32", "tcp/22-22/203.0.113.0/24", "tcp/8888-8888/198.51.100.7/32"}
+	if revoked := staleIngressRules(permissions, ingress); !reflect.DeepEqual(revoked, want) {
+		t.Errorf("public mode revokes %v, want %v", revoked, want)
+	}
+	added := desiredIngressRules(ingress)["tcp/22-22/192.0.2.99/32"]
+	if added == nil || aws.StringValue(added.IpRanges[0].Description) != "gltr user alice@example.com" {
+		t.Errorf("rule for the CIDR of alice is %v", added)
+	}
+
+	// without CIDRs of her own the rules alice added are revoked, but not
+	// those of bob
+	ingress = projectIngress(gt, Config{User: alice.User}, ConnectionPublic, 0)
+	want = []string{"tcp/22-22/192.0.2.1/32", "tcp/22-22/203.0.113.0/24", "tcp/8888-8888/198.51.100.7/32"}
+	if revoked := staleIngressRules(permissions, ingress); !reflect.DeepEqual(revoked, want) {
+		t.Errorf("public mode without CIDRs of the user revokes %v, want %v", revoked, want)
+	}
+
+	// only the bastion may connect in bastion mode
+	alice.ProviderConfiguration.AWS.Bastion.SecurityGroupID = "sg-bastion"
+	ingress = projectIngress(gt, alice, ConnectionBastion, 0)
+	want = []string{
+		"tcp/22-22/192.0.2.1/32", "tcp/22-22/198.51.100.7/32", "tcp/22-22/203.0.113.0/24", "tcp/8888-8888/198.51.100.7/32",
+	}
+	if revoked := staleIngressRules(permissions, ingress); !reflect.DeepEqual(revoked, want) {
+		t.Errorf("bastion mode revokes %v, want %v", revoked, want)
+	}
+}
+
+func TestSharedAndUserCIDRsOverlap(t *testing.T) {
+	gt := Task{ProjectID: "project", Ports: []int{22}, AllowedCIDRs: []string{"203.0.113.0/24"}}
+	config := Config{
+		User:         User{Email: "alice@example.com"},
+		AllowedCIDRs: map[string][]string{"project": {"203.0.113.0/24"}},
+	}
+	rules := desiredIngressRules(projectIngress(gt, config, ConnectionPublic, 0))
+	if len(rules) != 1 {
+		t.Fatalf("desired rules %v", sortedRuleKeys(rules))
+	}
+	// a shared CIDR is not marked with the user, so it is not revoked by
+	// other users
+	if d := aws.StringValue(rules["tcp/22-22/203.0.113.0/24"].IpRanges[0].Description); d != ruleDescription {
+		t.Errorf("shared CIDR rule has description %q", d)
+	}
+}
+
+func TestProjectIngressSSHPort(t *testing.T) {
+	gt := Task{ProjectID: "project", Ports: []int{8888, 22}, AllowedCIDRs: []string{"203.0.113.0/24"}}
+	ingress := projectIngress(gt, Config{}, ConnectionPublic, 2200)
+	if want := []int{8888, 22, 2200}; !reflect.DeepEqual(ingress.Ports, want) {
+		t.Errorf("ports %v, want %v", ingress.Ports, want)
+	}
+	if !reflect.DeepEqual(gt.Ports, []int{8888, 22}) {
+		t.Errorf("ports of the project changed to %v", gt.Ports)
+	}
+	if ingress = projectIngress(gt, Config{}, ConnectionPublic, 22); !reflect.DeepEqual(ingress.Ports, gt.Ports) {
+		t.Errorf("ports %v, want %v", ingress.Ports, gt.Ports)
+	}
+}
@@ -56,7 +56,7 @@ func ShowTaskEcs(clusterName, taskID string) {
 	}
 
 	// get task ip/name
-	networkAddress, err := getNetworkAddressEcs(awsSession, describeTaskOutput.Tasks[0].Attachments[0].Details)
+	networkAddress, err := getNetworkAddressEcs(awsSession, describeTaskOutput.Tasks[0].Attachments[0].Details, true)
 
 	tab := table.NewWriter()
 	tab.SetOutputMirror(os.Stdout)
@@ -132,7 +132,8 @@ func ShowTaskEc2(taskID string) {
 	tab.AppendRow([]interface{}{"Machine Image ID", *i.ImageId})
 	tab.AppendRow([]interface{}{"Start Time", i.LaunchTime.String()})
 	tab.AppendRow([]interface{}{"Running Time", time.Now().Sub(*i.LaunchTime).String()})
-	tab.AppendRow([]interface{}{"Network Address", *i.PublicDnsName})
+	tab.AppendRow([]interface{}{"Network Address", aws.StringValue(i.PublicDnsName)})
+	tab.AppendRow([]interface{}{"Private Address", aws.StringValue(i.PrivateIpAddress)})
 	tab.AppendRow([]interface{}{"Task-ID", taskID})
 
 	tab.Render()
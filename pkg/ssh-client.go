@@ -0,0 +1,193 @@
+package gltr
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/term"
+)
+
+// SSHAuthMethods returns the methods used to log in to tasks: the keys held
+// by the ssh agent and, if one is configured, the identity file
+func SSHAuthMethods(identityFile string) ([]ssh.AuthMethod, error) {
+	var auths []ssh.AuthMethod
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		conn, err := net.Dial("unix", sock)
+		if err != nil {
+			return nil, fmt.Errorf("error connecting to ssh agent: %w", err)
+		}
+		auths = append(auths, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+	}
+	if identityFile != "" {
+		auth, err := identityFileAuth(identityFile)
+		if err != nil {
+			return nil, err
+		}
+		auths = append(auths, auth)
+	}
+	if len(auths) == 0 {
+		return nil, errors.New("no ssh agent running (SSH_AUTH_SOCK is not set) and no identity file configured")
+	}
+	return auths, nil
+}
+
+// identityFileAuth returns an auth method for the private key in the
+// file; as in the ssh config, a leading ~ refers to the home directory
+func identityFileAuth(identityFile string) (ssh.AuthMethod, error) {
+	path := identityFile
+	if strings.HasPrefix(path, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		path = filepath.Join(home, path[2:])
+	}
+	dat, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := ssh.ParsePrivateKey(dat)
+	if err != nil {
+		// keys with a passphrase have to be added to the agent instead
+		return nil, fmt.Errorf("error reading identity file %v: %w", identityFile, err)
+	}
+	return ssh.PublicKeys(signer), nil
+}
+
+// DialTaskSSH opens an ssh connection to the given port of a task; only the
+// given host key is accepted
+func DialTaskSSH(
+	endpoint TaskEndpoint,
+	awsConfig AWSConfig,
+	port int,
+	user string,
+	auths []ssh.AuthMethod,
+	hostKey ssh.PublicKey,
+) (*ssh.Client, error) {
+	if hostKey == nil {
+		return nil, errors.New("no host key available to verify the ssh server")
+	}
+	config := &ssh.ClientConfig{
+		User:    user,
+		Auth:    auths,
+		Timeout: 10 * time.Second,
+	}
+	hostKeyClientConfig(config, hostKey)
+
+	taskConn, err := dialTask(endpoint, awsConfig, auths, port)
+	if err != nil {
+		return nil, err
+	}
+	c, chans, reqs, err := newSSHClientConn(taskConn, fmt.Sprintf("%v:%v", endpoint.Address, port), config)
+	if err != nil {
+		taskConn.Close()
+		return nil, err
+	}
+	return ssh.NewClient(c, chans, reqs), nil
+}
+
+// newSSHClientConn runs the ssh handshake on the connection within the
+// timeout of the config, which ssh.NewClientConn does not apply itself.
+// Connections through the bastion do not support deadlines, so they are
+// closed once the timeout passes instead.
+func newSSHClientConn(conn net.Conn, addr string, config *ssh.ClientConfig) (ssh.Conn, <-chan ssh.NewChannel, <-chan *ssh.Request, error) {
+	if config.Timeout <= 0 {
+		return ssh.NewClientConn(conn, addr, config)
+	}
+	deadline := time.Now().Add(config.Timeout)
+	if err := conn.SetDeadline(deadline); err == nil {
+		c, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+		if err != nil {
+			// the handshake error does not wrap the deadline error
+			if !time.Now().Before(deadline) {
+				return nil, nil, nil, fmt.Errorf("ssh handshake with %v timed out after %v", addr, config.Timeout)
+			}
+			return nil, nil, nil, err
+		}
+		conn.SetDeadline(time.Time{})
+		return c, chans, reqs, nil
+	}
+	timer := time.AfterFunc(config.Timeout, func() { conn.Close() })
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	if !timer.Stop() {
+		if err == nil {
+			c.Close()
+		}
+		return nil, nil, nil, fmt.Errorf("ssh handshake with %v timed out after %v", addr, config.Timeout)
+	}
+	return c, chans, reqs, err
+}
+
+// RunSSHSession runs the command in a new session on the client, connected
+// to stdin, stdout and stderr; if no command is given an interactive shell
+// is started. As with ssh, the command arguments are joined with spaces and
+// interpreted by the remote shell. The exit code of the remote command is
+// returned.
+func RunSSHSession(client *ssh.Client, command []string, forwardAgent bool, tty bool) (int, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return 0, err
+	}
+	defer session.Close()
+
+	if forwardAgent {
+		if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+			err = agent.ForwardToRemote(client, sock)
+			if err == nil {
+				err = agent.RequestAgentForwarding(session)
+			}
+			if err != nil {
+				return 0, fmt.Errorf("error forwarding ssh agent: %w", err)
+			}
+		}
+	}
+
+	session.Stdin = os.Stdin
+	session.Stdout = os.Stdout
+	session.Stderr = os.Stderr
+
+	fd := int(os.Stdin.Fd())
+	if (tty || len(command) == 0) && term.IsTerminal(fd) {
+		width, height, err := term.GetSize(fd)
+		if err != nil {
+			width, height = 80, 24
+		}
+		termType := os.Getenv("TERM")
+		if termType == "" {
+			termType = "xterm-256color"
+		}
+		err = session.RequestPty(termType, height, width, ssh.TerminalModes{ssh.ECHO: 1})
+		if err != nil {
+			return 0, fmt.Errorf("error requesting pty: %w", err)
+		}
+		state, err := term.MakeRaw(fd)
+		if err != nil {
+			return 0, err
+		}
+		defer term.Restore(fd, state)
+		stop := watchWindowSize(session, fd)
+		defer stop()
+	}
+
+	if len(command) == 0 {
+		err = session.Shell()
+		if err == nil {
+			err = session.Wait()
+		}
+	} else {
+		err = session.Run(strings.Join(command, " "))
+	}
+
+	var exitError *ssh.ExitError
+	if errors.As(err, &exitError) {
+		return exitError.ExitStatus(), nil
+	}
+	return 0, err
+}
@@ -0,0 +1,202 @@
+package gltr
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// SSMProxyCommand returns the ssh ProxyCommand which tunnels an ssh
+// connection through an AWS SSM session; %h and %p are expanded by ssh to
+// the host (the SSM target) and port. A role to assume is not passed on, so
+// the profile has to give access to the account of the task.
+func SSMProxyCommand(awsConfig AWSConfig) string {
+	command := []string{"aws", "ssm", "start-session"}
+	if awsConfig.Profile != "" {
+		command = append(command, "--profile", awsConfig.Profile)
+	}
+	if awsConfig.RegionName != "" {
+		command = append(command, "--region", awsConfig.RegionName)
+	}
+	command = append(
+		command,
+		"--target", "%h",
+		"--document-name", "AWS-StartSSHSession",
+		"--parameters", "portNumber=%p",
+	)
+	return strings.Join(command, " ")
+}
+
+// commandConn is a net.Conn which reads from and writes to the stdout and
+// stdin of a proxy command - this is the same mechanism as ssh ProxyCommand.
+// The pipes cannot be interrupted, so the command is killed once a deadline
+// passes and the connection cannot be used afterwards.
+type commandConn struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout io.ReadCloser
+
+	mu        sync.Mutex
+	closeOnce sync.Once
+	// the read and write deadline timers
+	deadlines [2]*time.Timer
+	timedOut  bool
+}
+
+type commandAddr struct{}
+
+func (a commandAddr) Network() string { return "command" }
+func (a commandAddr) String() string  { return "command" }
+
+func (c *commandConn) Read(b []byte) (int, error) {
+	n, err := c.stdout.Read(b)
+	return n, c.deadlineError(err)
+}
+
+func (c *commandConn) Write(b []byte) (int, error) {
+	n, err := c.stdin.Write(b)
+	return n, c.deadlineError(err)
+}
+
+// deadlineError returns os.ErrDeadlineExceeded for the errors of the pipes
+// which were closed as a deadline passed
+func (c *commandConn) deadlineError(err error) error {
+	if err == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.timedOut {
+		return os.ErrDeadlineExceeded
+	}
+	return err
+}
+
+func (c *commandConn) Close() error {
+	c.closeOnce.Do(func() {
+		c.stdin.Close()
+		if c.cmd.Process != nil {
+			c.cmd.Process.Kill()
+		}
+		c.cmd.Wait()
+	})
+	return nil
+}
+
+func (c *commandConn) LocalAddr() net.Addr  { return commandAddr{} }
+func (c *commandConn) RemoteAddr() net.Addr { return commandAddr{} }
+
+func (c *commandConn) SetDeadline(t time.Time) error {
+	c.setDeadline(0, t)
+	c.setDeadline(1, t)
+	return nil
+}
+
+func (c *commandConn) SetReadDeadline(t time.Time) error  { c.setDeadline(0, t); return nil }
+func (c *commandConn) SetWriteDeadline(t time.Time) error { c.setDeadline(1, t); return nil }
+
+// setDeadline replaces the read (0) or write (1) deadline timer; a zero time
+// clears the deadline
+func (c *commandConn) setDeadline(i int, t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.deadlines[i] != nil {
+		c.deadlines[i].Stop()
+		c.deadlines[i] = nil
+	}
+	if t.IsZero() || c.timedOut {
+		return
+	}
+	c.deadlines[i] = time.AfterFunc(time.Until(t), func() {
+		c.mu.Lock()
+		c.timedOut = true
+		c.mu.Unlock()
+		c.Close()
+	})
+}
+
+func dialCommand(env []string, name string, args ...string) (net.Conn, error) {
+	cmd := exec.Command(name, args...)
+	cmd.Env = env
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err = cmd.Start(); err != nil {
+		return nil, fmt.Errorf("error starting %v: %w", name, err)
+	}
+	return &commandConn{cmd: cmd, stdin: stdin, stdout: stdout}, nil
+}
+
+// bastionConn is a connection tunnelled through the bastion; closing it also
+// closes the ssh connection to the bastion
+type bastionConn struct {
+	net.Conn
+	client *ssh.Client
+}
+
+func (c *bastionConn) Close() error {
+	c.Conn.Close()
+	return c.client.Close()
+}
+
+// dialTask opens a connection to the given port of a task using the
+// connection mode of the endpoint
+func dialTask(endpoint TaskEndpoint, awsConfig AWSConfig, auths []ssh.AuthMethod, port int) (net.Conn, error) {
+	switch endpoint.ConnectionMode {
+	case ConnectionSSM:
+		// an assumed role is passed to the aws cli as temporary credentials,
+		// which a profile would take precedence over
+		env, err := awsCommandEnv()
+		if err != nil {
+			return nil, err
+		}
+		if env != nil {
+			awsConfig.Profile = ""
+		}
+		args := strings.Fields(SSMProxyCommand(awsConfig))
+		for i, a := range args {
+			a = strings.ReplaceAll(a, "%h", endpoint.SSMTarget)
+			args[i] = strings.ReplaceAll(a, "%p", fmt.Sprintf("%v", port))
+		}
+		return dialCommand(env, args[0], args[1:]...)
+	case ConnectionBastion:
+		if awsConfig.Bastion.Host == "" {
+			return nil, errors.New("no bastion configured - run gltr config add-bastion")
+		}
+		bastionHostKey, err := ParseHostPublicKey(awsConfig.Bastion.HostKey)
+		if err != nil {
+			return nil, fmt.Errorf("bastion host key: %w", err)
+		}
+		bastionConfig := &ssh.ClientConfig{
+			User:    awsConfig.Bastion.User,
+			Auth:    auths,
+			Timeout: 10 * time.Second,
+		}
+		hostKeyClientConfig(bastionConfig, bastionHostKey)
+		bastionClient, err := ssh.Dial("tcp", fmt.Sprintf("%v:22", awsConfig.Bastion.Host), bastionConfig)
+		if err != nil {
+			return nil, fmt.Errorf("error connecting to bastion: %w", err)
+		}
+		conn, err := bastionClient.Dial("tcp", fmt.Sprintf("%v:%v", endpoint.Address, port))
+		if err != nil {
+			bastionClient.Close()
+			return nil, err
+		}
+		return &bastionConn{Conn: conn, client: bastionClient}, nil
+	default:
+		return net.DialTimeout("tcp", fmt.Sprintf("%v:%v", endpoint.Address, port), 10*time.Second)
+	}
+}
@@ -0,0 +1,72 @@
+package gltr
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestCommandConnDeadline(t *testing.T) {
+	conn, err := dialCommand(nil, "sleep", "30")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	start := time.Now()
+	_, err = conn.Read(make([]byte, 1))
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("Read after the deadline = %v, want os.ErrDeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("Read returned after %v", elapsed)
+	}
+}
+
+func TestCommandConnClearedDeadline(t *testing.T) {
+	conn, err := dialCommand(nil, "cat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(100 * time.Millisecond))
+	conn.SetDeadline(time.Time{})
+	time.Sleep(200 * time.Millisecond)
+	if _, err := conn.Write([]byte("x")); err != nil {
+		t.Fatalf("Write after clearing the deadline: %v", err)
+	}
+	b := make([]byte, 1)
+	if _, err := conn.Read(b); err != nil || b[0] != 'x' {
+		t.Fatalf("Read after clearing the deadline = %q, %v", b, err)
+	}
+}
+
+// a proxy command which never answers, eg an SSM session to an agent which
+// is not up yet, must not hang the ssh handshake
+func TestSSHHandshakeTimeout(t *testing.T) {
+	conn, err := dialCommand(nil, "sleep", "30")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	config := &ssh.ClientConfig{
+		User:            SharedAccount,
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Timeout:         200 * time.Millisecond,
+	}
+	start := time.Now()
+	_, _, _, err = newSSHClientConn(conn, "task:22", config)
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("handshake = %v, want a timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("handshake returned after %v", elapsed)
+	}
+}
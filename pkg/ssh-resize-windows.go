@@ -0,0 +1,10 @@
+//go:build windows
+
+package gltr
+
+import "golang.org/x/crypto/ssh"
+
+// watchWindowSize is a no-op on windows, which has no SIGWINCH
+func watchWindowSize(session *ssh.Session, fd int) func() {
+	return func() {}
+}
@@ -0,0 +1,31 @@
+//go:build !windows
+
+package gltr
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/term"
+)
+
+// watchWindowSize passes changes of the local terminal size on to the
+// remote pty; the returned function stops watching
+func watchWindowSize(session *ssh.Session, fd int) func() {
+	sigwinch := make(chan os.Signal, 1)
+	signal.Notify(sigwinch, syscall.SIGWINCH)
+	go func() {
+		for range sigwinch {
+			width, height, err := term.GetSize(fd)
+			if err == nil {
+				session.WindowChange(height, width)
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(sigwinch)
+		close(sigwinch)
+	}
+}
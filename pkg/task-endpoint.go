@@ -0,0 +1,203 @@
+package gltr
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/docker/docker/api/types"
+)
+
+// ec2InstanceEndpoint returns the endpoint of a running instance for the
+// connection mode
+func ec2InstanceEndpoint(instance *ec2.Instance, mode ConnectionMode) TaskEndpoint {
+	endpoint := TaskEndpoint{ConnectionMode: mode}
+	if mode.IsPublic() {
+		endpoint.Address = aws.StringValue(instance.PublicDnsName)
+	} else {
+		endpoint.Address = aws.StringValue(instance.PrivateIpAddress)
+	}
+	if mode == ConnectionSSM {
+		endpoint.SSMTarget = aws.StringValue(instance.InstanceId)
+	}
+	if taskIDTag := getEc2Tag(instance.Tags, "gltr-task-id"); taskIDTag != nil {
+		endpoint.TaskID = aws.StringValue(taskIDTag.Value)
+	}
+	return endpoint
+}
+
+// ecsTaskEndpoint returns the endpoint of a running task for the connection
+// mode
+func ecsTaskEndpoint(awsSession *session.Session, clusterName string, task *ecs.Task, mode ConnectionMode) (TaskEndpoint, error) {
+	endpoint := TaskEndpoint{ConnectionMode: mode}
+	if len(task.Attachments) == 0 || len(task.Containers) == 0 {
+		return endpoint, errors.New("task has no network attachment")
+	}
+	address, err := getNetworkAddressEcs(awsSession, task.Attachments[0].Details, mode.IsPublic())
+	if err != nil {
+		return endpoint, err
+	}
+	endpoint.Address = address
+	if mode == ConnectionSSM {
+		// ECS Exec targets have the form ecs:<cluster>_<task-id>_<runtime-id>
+		taskArnParts := strings.Split(aws.StringValue(task.TaskArn), "/")
+		endpoint.SSMTarget = fmt.Sprintf(
+			"ecs:%v_%v_%v",
+			clusterName,
+			taskArnParts[len(taskArnParts)-1],
+			aws.StringValue(task.Containers[0].RuntimeId),
+		)
+	}
+	if taskIDTag := getEcsTag(task.Tags, "gltr-task-id"); taskIDTag != nil {
+		endpoint.TaskID = aws.StringValue(taskIDTag.Value)
+	}
+	return endpoint, nil
+}
+
+// FindTaskEndpoint looks up a running task of the project on the execution
+// platform and returns its endpoint and ssh port. If no task id is given the
+// most recently started task of the project is used.
+func FindTaskEndpoint(gt Task, platform ExecutionPlatformType, taskID string) (endpoint TaskEndpoint, port int, err error) {
+	switch platform {
+	case Docker:
+		return findTaskEndpointDocker(gt, taskID)
+	case Ec2:
+		return findTaskEndpointEc2(gt, taskID)
+	case EcsFargate:
+		return findTaskEndpointEcs(gt, taskID)
+	}
+	return TaskEndpoint{}, 0, fmt.Errorf("execution platform %v not supported", platform.ToString())
+}
+
+func errNoTask(gt Task, taskID string) error {
+	if taskID != "" {
+		return fmt.Errorf("task %v not found", taskID)
+	}
+	return fmt.Errorf("no running task found for project %v", gt.ProjectName)
+}
+
+func findTaskEndpointDocker(gt Task, taskID string) (TaskEndpoint, int, error) {
+	d := DockerExecutionPlatform{}
+	containers, err := d.ListTasks()
+	if err != nil {
+		return TaskEndpoint{}, 0, err
+	}
+	var found *types.Container
+	for i, c := range containers {
+		project := d.GetTag(c, "gltr-project")
+		if project == nil || *project != gt.ProjectName {
+			continue
+		}
+		id := d.GetTag(c, "gltr-task-id")
+		if taskID != "" && (id == nil || *id != taskID) {
+			continue
+		}
+		if found == nil || c.Created > found.Created {
+			found = &containers[i]
+		}
+	}
+	if found == nil {
+		return TaskEndpoint{}, 0, errNoTask(gt, taskID)
+	}
+	endpoint := TaskEndpoint{Address: "localhost", ConnectionMode: ConnectionPublic}
+	if id := d.GetTag(*found, "gltr-task-id"); id != nil {
+		endpoint.TaskID = *id
+	}
+	for _, p := range found.Ports {
+		if p.PrivatePort == 22 && p.PublicPort != 0 {
+			return endpoint, int(p.PublicPort), nil
+		}
+	}
+	return endpoint, 0, errors.New("ssh port of container is not published")
+}
+
+func findTaskEndpointEc2(gt Task, taskID string) (TaskEndpoint, int, error) {
+	ec2Config := gt.GetExecutionPlatformProjectConfig(Ec2).(Ec2ProjectConfig)
+	_, ec2Client, err := getEc2Client()
+	if err != nil {
+		return TaskEndpoint{}, 0, err
+	}
+	filters := []*ec2.Filter{
+		{
+			Name:   aws.String("tag:gltr-project"),
+			Values: []*string{aws.String(gt.ProjectName)},
+		},
+		{
+			Name:   aws.String("instance-state-name"),
+			Values: []*string{aws.String("running")},
+		},
+	}
+	if taskID != "" {
+		filters = append(filters, &ec2.Filter{
+			Name:   aws.String("tag:gltr-task-id"),
+			Values: []*string{aws.String(taskID)},
+		})
+	}
+	describeInstancesOutput, err := ec2Client.DescribeInstances(&ec2.DescribeInstancesInput{Filters: filters})
+	if err != nil {
+		return TaskEndpoint{}, 0, err
+	}
+	var found *ec2.Instance
+	for _, r := range describeInstancesOutput.Reservations {
+		for _, i := range r.Instances {
+			if found == nil || aws.TimeValue(i.LaunchTime).After(aws.TimeValue(found.LaunchTime)) {
+				found = i
+			}
+		}
+	}
+	if found == nil {
+		return TaskEndpoint{}, 0, errNoTask(gt, taskID)
+	}
+	return ec2InstanceEndpoint(found, ec2Config.ConnectionMode), ec2InstanceSSHPort(found), nil
+}
+
+// ec2InstanceSSHPort returns the port the container sshd of the instance is
+// published on; instances launched before ssh_login was honoured have no
+// gltr-ssh-port tag and publish it on 22
+func ec2InstanceSSHPort(instance *ec2.Instance) int {
+	if tag := getEc2Tag(instance.Tags, "gltr-ssh-port"); tag != nil {
+		if port, err := strconv.Atoi(aws.StringValue(tag.Value)); err == nil {
+			return port
+		}
+	}
+	return 22
+}
+
+func findTaskEndpointEcs(gt Task, taskID string) (TaskEndpoint, int, error) {
+	ecsConfig := gt.GetExecutionPlatformProjectConfig(EcsFargate).(EcsProjectConfig)
+	awsSession, ecsClient, err := getEcsClient()
+	if err != nil {
+		return TaskEndpoint{}, 0, err
+	}
+	tasks, err := describeEcsTasks(ecsClient, ecsConfig.ClusterName)
+	if err != nil {
+		return TaskEndpoint{}, 0, err
+	}
+	var found *ecs.Task
+	for _, t := range tasks {
+		if aws.StringValue(t.LastStatus) != "RUNNING" {
+			continue
+		}
+		projectTag := getEcsTag(t.Tags, "gltr-project")
+		if projectTag == nil || aws.StringValue(projectTag.Value) != gt.ProjectName {
+			continue
+		}
+		taskIDTag := getEcsTag(t.Tags, "gltr-task-id")
+		if taskID != "" && (taskIDTag == nil || aws.StringValue(taskIDTag.Value) != taskID) {
+			continue
+		}
+		if found == nil || aws.TimeValue(t.StartedAt).After(aws.TimeValue(found.StartedAt)) {
+			found = t
+		}
+	}
+	if found == nil {
+		return TaskEndpoint{}, 0, errNoTask(gt, taskID)
+	}
+	endpoint, err := ecsTaskEndpoint(awsSession, ecsConfig.ClusterName, found, ecsConfig.ConnectionMode)
+	return endpoint, 22, err
+}
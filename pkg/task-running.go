@@ -0,0 +1,112 @@
+package gltr
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ecs"
+)
+
+// TaskRunningEc2 returns true if an instance with the given task id is
+// pending or running
+func TaskRunningEc2(taskID string) (bool, error) {
+	_, ec2Client, err := getEc2Client()
+	if err != nil {
+		return false, err
+	}
+	describeInstancesOutput, err := ec2Client.DescribeInstances(&ec2.DescribeInstancesInput{
+		Filters: []*ec2.Filter{
+			{
+				Name:   aws.String("tag:gltr-task-id"),
+				Values: []*string{aws.String(taskID)},
+			},
+			{
+				Name:   aws.String("instance-state-name"),
+				Values: []*string{aws.String("pending"), aws.String("running")},
+			},
+		},
+	})
+	if err != nil {
+		return false, err
+	}
+	for _, r := range describeInstancesOutput.Reservations {
+		if len(r.Instances) > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// describeEcsTasks returns the running and pending tasks of the cluster
+// together with their tags
+func describeEcsTasks(ecsClient *ecs.ECS, clusterName string) ([]*ecs.Task, error) {
+	var taskArns []*string
+	err := ecsClient.ListTasksPages(
+		&ecs.ListTasksInput{Cluster: aws.String(clusterName)},
+		func(page *ecs.ListTasksOutput, lastPage bool) bool {
+			taskArns = append(taskArns, page.TaskArns...)
+			return true
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var tasks []*ecs.Task
+	// DescribeTasks accepts at most 100 tasks per call
+	for len(taskArns) > 0 {
+		n := len(taskArns)
+		if n > 100 {
+			n = 100
+		}
+		describeTasksOutput, err := ecsClient.DescribeTasks(&ecs.DescribeTasksInput{
+			Cluster: aws.String(clusterName),
+			Tasks:   taskArns[:n],
+			Include: []*string{aws.String("TAGS")},
+		})
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, describeTasksOutput.Tasks...)
+		taskArns = taskArns[n:]
+	}
+	return tasks, nil
+}
+
+// TaskRunningEcs returns true if a task with the given task id is running in
+// the cluster; a missing cluster means the task is not running
+func TaskRunningEcs(clusterName, taskID string) (bool, error) {
+	_, ecsClient, err := getEcsClient()
+	if err != nil {
+		return false, err
+	}
+
+	tasks, err := describeEcsTasks(ecsClient, clusterName)
+	if err != nil {
+		if isAwsErrorCode(err, ecs.ErrCodeClusterNotFoundException) {
+			return false, nil
+		}
+		return false, err
+	}
+	for _, t := range tasks {
+		taskIDTag := getEcsTag(t.Tags, "gltr-task-id")
+		if taskIDTag != nil && aws.StringValue(taskIDTag.Value) == taskID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// TaskRunning returns true if a container with the given task id is running
+// on the local docker engine
+func (d DockerExecutionPlatform) TaskRunning(taskID string) (bool, error) {
+	tasks, err := d.ListTasks()
+	if err != nil {
+		return false, err
+	}
+	for _, t := range tasks {
+		if value := d.GetTag(t, "gltr-task-id"); value != nil && *value == taskID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,128 @@
+package gltr
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pterm/pterm"
+	"golang.org/x/crypto/ssh"
+)
+
+// the task container installs secrets from files in this directory; older
+// versions of gltr passed them in the container environment, which the
+// image still falls back to
+const taskSecretsDir = "/etc/gltr/secrets"
+
+// the task container creates this file once it has installed the secrets,
+// so that the copies which were passed to it can be deleted
+const taskSecretsInstalledFile = "/run/gltr/secrets-installed"
+
+// taskSecret is delivered to the task container outside of its environment,
+// so that it does not show up in task definitions, docker inspect or ps;
+// values are base64 encoded as they were in the environment
+type taskSecret struct {
+	Name  string
+	Value string
+}
+
+// taskSecrets returns the secrets of the task container: the project private
+// key and the private part of the task host key
+func taskSecrets(privateKey []byte, hostKey HostKey) []taskSecret {
+	secrets := []taskSecret{
+		{Name: "GLTR_PRIVATE_KEY", Value: base64.StdEncoding.EncodeToString(privateKey)},
+	}
+	return append(secrets, hostKeySecrets(hostKey)...)
+}
+
+// hostKeySecrets returns the private part of the task host key as a secret,
+// or nothing if the task has no host key
+func hostKeySecrets(hostKey HostKey) []taskSecret {
+	if len(hostKey.PrivateKeyPEM) == 0 {
+		return nil
+	}
+	return []taskSecret{{
+		Name:  "GLTR_SSH_HOST_KEY",
+		Value: base64.StdEncoding.EncodeToString(hostKey.PrivateKeyPEM),
+	}}
+}
+
+// hostTmpfsDirs are tmpfs directories of the host, in the order they are
+// tried; files in them never reach the disk of the host
+var hostTmpfsDirs = []string{os.Getenv("XDG_RUNTIME_DIR"), "/dev/shm"}
+
+// writeHostTaskSecrets writes the secrets to a new directory on a tmpfs of
+// the host, to be mounted at taskSecretsDir, and returns the directory. If
+// the host has no tmpfs, eg with Docker Desktop on macOS, the directory is
+// created in the temp directory instead. It must be removed once the
+// container has installed the secrets.
+func writeHostTaskSecrets(secrets []taskSecret) (string, error) {
+	var dir string
+	var err error
+	for _, tmpfs := range hostTmpfsDirs {
+		if tmpfs == "" {
+			continue
+		}
+		if dir, err = os.MkdirTemp(tmpfs, "gltr-secrets-"); err == nil {
+			break
+		}
+	}
+	if dir == "" {
+		pterm.Warning.Printf("No tmpfs found - the task secrets are kept in the temp directory until the container has installed them\n")
+		if dir, err = os.MkdirTemp("", "gltr-secrets-"); err != nil {
+			return "", err
+		}
+	}
+	for _, secret := range secrets {
+		err = os.WriteFile(filepath.Join(dir, secret.Name), []byte(secret.Value), 0400)
+		if err != nil {
+			os.RemoveAll(dir)
+			return "", err
+		}
+	}
+	return dir, nil
+}
+
+// installProjectKeySSH writes the project private key to the places the
+// gltr-init and ssh-init services of the image would have put it; the key
+// is passed on stdin so it never appears on a command line
+func installProjectKeySSH(client *ssh.Client, projectID string, privateKey []byte) error {
+	session, err := client.NewSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	projectKeyDir := `"$HOME"/.gltr/secrets/` + shellQuote(projectID)
+	command := fmt.Sprintf(
+		`umask 077 && mkdir -p "$HOME"/.ssh %[1]v && cat > "$HOME"/.ssh/gltr && cp "$HOME"/.ssh/gltr %[1]v/%[2]v`,
+		projectKeyDir, shellQuote(projectID),
+	)
+	session.Stdin = bytes.NewReader(privateKey)
+	output, err := session.CombinedOutput(command)
+	if err != nil {
+		return fmt.Errorf("error installing project key: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// installWorkspaceSecretsSSH installs the secrets declared in gltr.yaml in the
+// task container; on EC2 the project key arrives after the container has
+// started, so the gltr-secrets service of the image skips them
+func installWorkspaceSecretsSSH(client *ssh.Client, projectName string) error {
+	session, err := client.NewSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	command := fmt.Sprintf(`gltr install-secrets --dir "$HOME"/%v --wait 5m`, shellQuote(projectName))
+	output, err := session.CombinedOutput(command)
+	if err != nil {
+		return fmt.Errorf("error installing workspace secrets: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
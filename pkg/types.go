@@ -54,6 +54,41 @@ func (e ExecutionPlatformType) ToString() string {
 	return "UnknownPlatform"
 }
 
+// ConnectionMode determines how ssh connections reach a task running on AWS
+type ConnectionMode string
+
+const (
+	// the task has a public IP address and is reached directly
+	ConnectionPublic ConnectionMode = "public"
+	// the task has no public IP address and is reached via an AWS SSM session
+	ConnectionSSM ConnectionMode = "ssm"
+	// the task has no public IP address and is reached via the gltr bastion
+	ConnectionBastion ConnectionMode = "bastion"
+)
+
+var ConnectionModes = []string{
+	string(ConnectionPublic),
+	string(ConnectionSSM),
+	string(ConnectionBastion),
+}
+
+// IsPublic returns true if tasks are given a public IP address; configs
+// written before connection modes were introduced have an empty mode
+func (m ConnectionMode) IsPublic() bool {
+	return m == "" || m == ConnectionPublic
+}
+
+// TaskEndpoint describes where a running task can be reached over ssh
+type TaskEndpoint struct {
+	// public or private hostname/IP address, depending on the connection mode
+	Address        string
+	ConnectionMode ConnectionMode
+	// target passed to aws ssm start-session; only set in ssm mode
+	SSMTarget string
+	// the gltr-task-id tag of the task
+	TaskID string
+}
+
 type ExecutionPlatformConfiguration interface{}
 
 type ExecutionPlatform struct {
@@ -97,6 +132,52 @@ type Task struct {
 	Users                    []User                           `json:"users"                      yaml:"users"`
 	ExecutionPlatformConfigs []ExecutionPlatformProjectConfig `json:"execution_platform_configs" yaml:"execution_platform_configs"`
 	Ports                    []int                            `json:"ports"                      yaml:"ports"`
+	// CIDRs allowed for the whole team, eg an office network; the addresses
+	// of single users are kept in their gltr config
+	AllowedCIDRs   []string       `json:"allowed_cidrs" yaml:"allowed_cidrs,omitempty"`
+	Customizations Customizations `json:"customizations" yaml:"customizations,omitempty"`
+	// secrets from gltr-secrets.yaml which are installed in the workspace
+	Secrets []WorkspaceSecret `json:"secrets" yaml:"secrets,omitempty"`
+	// every project user gets a unix account in the workspace instead of
+	// all of them sharing the gltr account
+	UserAccounts bool `json:"user_accounts" yaml:"user_accounts,omitempty"`
+	// the AWS environment the project runs in unless --aws-env is given
+	AWSEnvironment string `json:"aws_environment" yaml:"aws_environment,omitempty"`
+	// how the workspace reaches the git repository, see GitAccessModes
+	GitAccess string `json:"git_access" yaml:"git_access,omitempty"`
+	// the hosting service of the git repository, for registering the project
+	// key as deploy key on servers which are not recognised by their host
+	GitProvider GitProviderSettings `json:"git_provider" yaml:"git_provider,omitempty"`
+
+	// the AWS environment selected for this run
+	awsEnvironment string
+}
+
+// Customizations contains tool specific settings for the workspace, in the
+// style of the devcontainer.json customizations property
+type Customizations struct {
+	VSCode VSCodeCustomizations `json:"vscode" yaml:"vscode,omitempty"`
+}
+
+// WorkspaceSecret declares how a secret of the project is made available in
+// the workspace: as an environment variable of login shells, as a file, or
+// both
+type WorkspaceSecret struct {
+	// the name of the secret in gltr-secrets.yaml
+	Name string `json:"name" yaml:"name"`
+	// the environment variable which holds the secret
+	Env string `json:"env" yaml:"env,omitempty"`
+	// the file the secret is written to; relative paths are relative to the
+	// repository clone
+	Path string `json:"path" yaml:"path,omitempty"`
+	// the octal permissions of the file, 0600 if not given
+	Mode string `json:"mode" yaml:"mode,omitempty"`
+}
+
+type VSCodeCustomizations struct {
+	// extension ids, eg ms-python.python, installed in the VS Code server
+	// when the workspace starts
+	Extensions []string `json:"extensions" yaml:"extensions,omitempty"`
 }
 
 func (d TaskEc2Config) Type() ExecutionPlatformType {
@@ -112,6 +193,17 @@ type TaskEc2Config struct {
 type Ec2Config struct {
 	// could be able to add some things here about volumes and EFS but ignore for now
 	DefaultLoginKeyName string `json:"default_login_key_name" yaml:"default_login_key_name" mapstructure:"default_login_key_name"`
+	// how the task container is logged in to in projects which set no
+	// ssh_login of their own
+	DefaultSSHLogin SSHLogin `json:"default_ssh_login,omitempty" yaml:"default_ssh_login,omitempty" mapstructure:"default_ssh_login"`
+}
+
+// SSHLogin sets how the sshd of an EC2 task container is logged in to: the
+// container account and the port of the instance the sshd is published on.
+// Empty fields take the defaults of the project, see Task.Ec2SSHLogin.
+type SSHLogin struct {
+	User string `json:"user,omitempty" yaml:"user,omitempty" mapstructure:"user"`
+	Port int    `json:"port,omitempty" yaml:"port,omitempty" mapstructure:"port"`
 }
 
 type EcsFargateConfig struct {
@@ -127,6 +219,14 @@ type DockerConfig struct {
 }
 
 type AWSConfig struct {
+	// the AWS cli profile, which may assume a role itself, and a role to
+	// assume on top of it; both are optional
+	Profile string `json:"profile,omitempty"  yaml:"profile,omitempty"`
+	RoleArn string `json:"role_arn,omitempty" yaml:"role_arn,omitempty"`
+	// the ECS cluster and EC2 key pair of a named environment; the default
+	// environment keeps them in the execution platform configs
+	ClusterName        string `json:"cluster_name,omitempty" yaml:"cluster_name,omitempty"`
+	KeyName            string `json:"key_name,omitempty"     yaml:"key_name,omitempty"`
 	Initialized        bool   `json:"initialized"           yaml:"initialized"`
 	Enabled            bool   `json:"enabled"               yaml:"enabled"`
 	SubnetID           string `json:"subnet_id"             yaml:"subnet_id"`
@@ -135,6 +235,68 @@ type AWSConfig struct {
 	IgwID              string `json:"igw_id"                yaml:"igw_id"`
 	DefaultAmiCPUImage string `json:"default_ami_cpu_image" yaml:"default_ami_cpu_image"`
 	DefaultAmiGPUImage string `json:"default_ami_gpu_image" yaml:"default_ami_gpu_image"`
+	// the default AMIs above pin an AMI id; otherwise the AMIs are resolved
+	// with these selectors, which default to Ubuntu 22.04 and the AWS deep
+	// learning base AMI
+	CPUAmi AmiSelector `json:"cpu_ami,omitempty" yaml:"cpu_ami,omitempty"`
+	GPUAmi AmiSelector `json:"gpu_ami,omitempty" yaml:"gpu_ami,omitempty"`
+	// resolved AMIs by region and kind (eg gpu-x86_64)
+	AmiCache map[string]map[string]ResolvedAmi `json:"ami_cache,omitempty" yaml:"ami_cache,omitempty"`
+	// when the network is externally managed, gltr uses an existing VPC,
+	// subnets and optionally security groups and never removes them
+	ExternallyManaged bool              `json:"externally_managed" yaml:"externally_managed"`
+	Subnets           []AWSSubnetConfig `json:"subnets"            yaml:"subnets"`
+	SecurityGroupIDs  []string          `json:"security_group_ids" yaml:"security_group_ids"`
+	// the bastion is only created when projects use the bastion connection mode
+	Bastion AWSBastionConfig `json:"bastion" yaml:"bastion"`
+}
+
+// AmiSelector selects an AMI either by a public SSM parameter which holds
+// the AMI id or by the newest image matching the DescribeImages filters
+type AmiSelector struct {
+	SSMParameter string   `json:"ssm_parameter,omitempty" yaml:"ssm_parameter,omitempty"`
+	Owners       []string `json:"owners,omitempty"        yaml:"owners,omitempty"`
+	NamePattern  string   `json:"name_pattern,omitempty"  yaml:"name_pattern,omitempty"`
+	Architecture string   `json:"architecture,omitempty"  yaml:"architecture,omitempty"`
+}
+
+// ResolvedAmi is an AMI found for a selector in a region
+type ResolvedAmi struct {
+	ImageID        string    `json:"image_id"         yaml:"image_id"`
+	Name           string    `json:"name"             yaml:"name"`
+	RootDeviceName string    `json:"root_device_name" yaml:"root_device_name"`
+	ResolvedAt     time.Time `json:"resolved_at"      yaml:"resolved_at"`
+}
+
+type AWSBastionConfig struct {
+	InstanceID      string   `json:"instance_id"       yaml:"instance_id"`
+	SecurityGroupID string   `json:"security_group_id" yaml:"security_group_id"`
+	Host            string   `json:"host"              yaml:"host"`
+	User            string   `json:"user"              yaml:"user"`
+	AllowedCIDRs    []string `json:"allowed_cidrs"     yaml:"allowed_cidrs"`
+	// public host key installed by gltr, in authorized_keys format
+	HostKey string `json:"host_key" yaml:"host_key"`
+}
+
+type AWSSubnetConfig struct {
+	SubnetID         string `json:"subnet_id"         yaml:"subnet_id"`
+	AvailabilityZone string `json:"availability_zone" yaml:"availability_zone"`
+	Public           bool   `json:"public"            yaml:"public"`
+}
+
+// GetSubnetIDs returns the ids of all subnets gltr can launch tasks into
+func (c AWSConfig) GetSubnetIDs() []string {
+	if len(c.Subnets) == 0 {
+		if c.SubnetID == "" {
+			return nil
+		}
+		return []string{c.SubnetID}
+	}
+	var subnetIDs []string
+	for _, s := range c.Subnets {
+		subnetIDs = append(subnetIDs, s.SubnetID)
+	}
+	return subnetIDs
 }
 
 type AzureConfig struct {
@@ -151,6 +313,13 @@ type User struct {
 	Name   string `json:"name"    yaml:"name"`
 	Email  string `json:"email"   yaml:"email"`
 	SshKey string `json:"ssh_key" yaml:"ssh_key"`
+	// further keys of the user, eg all of their keys on GitHub
+	SshKeys []string `json:"ssh_keys" yaml:"ssh_keys,omitempty"`
+	// where the keys were looked up, eg https://github.com/<username>.keys
+	KeysFrom string `json:"keys_from" yaml:"keys_from,omitempty"`
+	// unix account of the user in workspaces with user accounts; derived
+	// from the name if empty
+	Account string `json:"account" yaml:"account,omitempty"`
 }
 
 // this structs contains basic provider configuration information for each of the
@@ -158,6 +327,15 @@ type User struct {
 type ProviderConfiguration struct {
 	AWS AWSConfig `json:"aws" yaml:"aws"`
 	GCP GCPConfig `json:"gcp" yaml:"gcp"`
+	// named AWS environments, eg other accounts or regions; aws above is the
+	// default environment
+	AWSEnvironments       map[string]AWSConfig `json:"aws_environments,omitempty"        yaml:"aws_environments,omitempty"`
+	DefaultAWSEnvironment string               `json:"default_aws_environment,omitempty" yaml:"default_aws_environment,omitempty"`
+
+	// while a named environment is active, its config is held in AWS and
+	// the default environment is kept here
+	activeAWSEnvironment string
+	defaultAWS           AWSConfig
 }
 
 type Config struct {
@@ -165,6 +343,82 @@ type Config struct {
 	ProviderConfiguration ProviderConfiguration `json:"provider_configuration" yaml:"provider_configuration"`
 	LastUpdate            time.Time             `json:"last_update"            yaml:"last_update"`
 	User                  User                  `json:"user"                   yaml:"user"`
+	SSH                   SSHSettings           `json:"ssh"                    yaml:"ssh"`
+	KeyStore              KeyStoreSettings      `json:"key_store"              yaml:"key_store,omitempty"`
+	// CIDRs of the user allowed to access the workspaces of projects, keyed
+	// by project ID; they are personal, so they are not in the gltr file
+	AllowedCIDRs map[string][]string `json:"allowed_cidrs" yaml:"allowed_cidrs,omitempty"`
+}
+
+// KeyStoreSettings select where the private keys of projects are kept
+type KeyStoreSettings struct {
+	// file (the default), passphrase-file, keyring or vault
+	Type  string                `json:"type"  yaml:"type"`
+	Vault VaultKeyStoreSettings `json:"vault" yaml:"vault,omitempty"`
+}
+
+// VaultKeyStoreSettings locate the project keys in HashiCorp Vault; the
+// token is taken from VAULT_TOKEN or ~/.vault-token
+type VaultKeyStoreSettings struct {
+	// address of the vault server; VAULT_ADDR is used if empty
+	Address string `json:"address" yaml:"address,omitempty"`
+	// mount of the KV version 2 secrets engine; secret if empty
+	Mount string `json:"mount" yaml:"mount,omitempty"`
+	// path of the keys in the secrets engine; gltr/project-keys if empty
+	Path string `json:"path" yaml:"path,omitempty"`
+}
+
+// GitProviderSettings identify the hosting service of a git repository and
+// its API; both are derived from the repository host if empty
+type GitProviderSettings struct {
+	// github, gitlab or bitbucket
+	Type string `json:"type" yaml:"type,omitempty"`
+	// base URL of the REST API, eg https://git.example.com/api/v4
+	APIURL string `json:"api_url" yaml:"api_url,omitempty"`
+}
+
+// SSHSettings control the entries gltr writes to ~/.ssh/config.gltr
+type SSHSettings struct {
+	// whether gltr may add an Include for config.gltr to ~/.ssh/config; nil
+	// until the user has been asked
+	ManageInclude *bool `json:"manage_include" yaml:"manage_include"`
+	// private key used to log in to tasks; empty leaves the choice to ssh
+	IdentityFile string `json:"identity_file" yaml:"identity_file"`
+	// seconds between keepalives; 0 uses the default and -1 disables them
+	ServerAliveInterval int `json:"server_alive_interval" yaml:"server_alive_interval"`
+	// local port forwarded to jupyter in the task; 0 uses the default and -1
+	// disables the forward
+	JupyterLocalPort int `json:"jupyter_local_port" yaml:"jupyter_local_port"`
+}
+
+const (
+	defaultServerAliveInterval = 60
+	// jupyter listens on this port inside every gltr container
+	JupyterPort = 8888
+)
+
+// GetServerAliveInterval returns the keepalive interval in seconds, or 0 if
+// keepalives are disabled
+func (s SSHSettings) GetServerAliveInterval() int {
+	switch {
+	case s.ServerAliveInterval == 0:
+		return defaultServerAliveInterval
+	case s.ServerAliveInterval < 0:
+		return 0
+	}
+	return s.ServerAliveInterval
+}
+
+// GetJupyterLocalPort returns the local port forwarded to jupyter, or 0 if
+// the forward is disabled
+func (s SSHSettings) GetJupyterLocalPort() int {
+	switch {
+	case s.JupyterLocalPort == 0:
+		return JupyterPort
+	case s.JupyterLocalPort < 0:
+		return 0
+	}
+	return s.JupyterLocalPort
 }
 
 type ExecutionPlatformProjectConfiguration interface{}
@@ -179,27 +433,52 @@ type DockerProjectConfig struct {
 }
 
 type EcsProjectConfig struct {
-	CPURequirements    int    `json:"cpu_requirements"    yaml:"cpu_requirements"    mapstructure:"cpu_requirements"`
-	MemoryRequirements int    `json:"memory_requirements" yaml:"memory_requirements" mapstructure:"memory_requirements"`
-	ClusterName        string `json:"cluster_name"        yaml:"cluster_name"        mapstructure:"cluster_name"`
-	SubnetID           string `json:"subnet_id"           yaml:"subnet_id"           mapstructure:"subnet_id"`
-	SecurityGroupID    string `json:"security_group_id"   yaml:"security_group_id"   mapstructure:"security_group_id"`
+	CPURequirements    int            `json:"cpu_requirements"    yaml:"cpu_requirements"    mapstructure:"cpu_requirements"`
+	MemoryRequirements int            `json:"memory_requirements" yaml:"memory_requirements" mapstructure:"memory_requirements"`
+	ClusterName        string         `json:"cluster_name"        yaml:"cluster_name"        mapstructure:"cluster_name"`
+	SubnetID           string         `json:"subnet_id"           yaml:"subnet_id"           mapstructure:"subnet_id"`
+	SecurityGroupID    string         `json:"security_group_id"   yaml:"security_group_id"   mapstructure:"security_group_id"`
+	ConnectionMode     ConnectionMode `json:"connection_mode" yaml:"connection_mode" mapstructure:"connection_mode"`
+	// ssm mode uses ECS Exec, which needs a task role with ssmmessages permissions
+	TaskRoleArn string `json:"task_role_arn" yaml:"task_role_arn" mapstructure:"task_role_arn"`
+	// ECS reads the secrets of the task with the execution role; gltr creates
+	// a role for this if none is given
+	ExecutionRoleArn string `json:"execution_role_arn,omitempty" yaml:"execution_role_arn,omitempty" mapstructure:"execution_role_arn"`
+	// the AWS environment the cluster, subnet and security group live in;
+	// empty means the default environment
+	AWSEnvironment string `json:"aws_environment,omitempty" yaml:"aws_environment,omitempty" mapstructure:"aws_environment"`
 }
 
 type Ec2ProjectConfig struct {
-	GpuRequired         bool   `json:"gpu_required"          yaml:"gpu_required"          mapstructure:"gpu_required"`
-	DefaultInstanceType string `json:"default_instance_type" yaml:"default_instance_type" mapstructure:"default_instance_type"`
-	DefaultImage        string `json:"default_image"         yaml:"default_image"         mapstructure:"default_image"`
-	KeyName             string `json:"key_name"              yaml:"key_name"              mapstructure:"key_name"`
-	SubnetID            string `json:"subnet_id"             yaml:"subnet_id"             mapstructure:"subnet_id"`
-	SecurityGroupID     string `json:"security_group_id"     yaml:"security_group_id"     mapstructure:"security_group_id"`
+	GpuRequired         bool           `json:"gpu_required"          yaml:"gpu_required"          mapstructure:"gpu_required"`
+	DefaultInstanceType string         `json:"default_instance_type" yaml:"default_instance_type" mapstructure:"default_instance_type"`
+	DefaultImage        string         `json:"default_image"         yaml:"default_image"         mapstructure:"default_image"`
+	KeyName             string         `json:"key_name"              yaml:"key_name"              mapstructure:"key_name"`
+	SubnetID            string         `json:"subnet_id"             yaml:"subnet_id"             mapstructure:"subnet_id"`
+	SecurityGroupID     string         `json:"security_group_id"     yaml:"security_group_id"     mapstructure:"security_group_id"`
+	ConnectionMode      ConnectionMode `json:"connection_mode" yaml:"connection_mode" mapstructure:"connection_mode"`
+	// ssm mode needs an instance profile which allows the SSM agent to register
+	InstanceProfileName string `json:"instance_profile_name" yaml:"instance_profile_name" mapstructure:"instance_profile_name"`
+	// root volume size in GiB and EBS volume type; 0 and empty mean the
+	// defaults (40GiB gp3). The size is raised to the snapshot size of the AMI.
+	RootVolumeSize int    `json:"root_volume_size,omitempty" yaml:"root_volume_size,omitempty" mapstructure:"root_volume_size"`
+	RootVolumeType string `json:"root_volume_type,omitempty" yaml:"root_volume_type,omitempty" mapstructure:"root_volume_type"`
+	// the AWS environment the subnet and security group live in; empty
+	// means the default environment
+	AWSEnvironment string `json:"aws_environment,omitempty" yaml:"aws_environment,omitempty" mapstructure:"aws_environment"`
+	// the login of the task container; overrides default_ssh_login of the
+	// user config
+	SSHLogin SSHLogin `json:"ssh_login,omitempty" yaml:"ssh_login,omitempty" mapstructure:"ssh_login"`
 }
 
+// GetExecutionPlatformProjectConfig returns the project config of the
+// platform; AWS platforms have a config per AWS environment, and the one for
+// the selected environment is returned
 func (t Task) GetExecutionPlatformProjectConfig(
 	platformType ExecutionPlatformType,
 ) ExecutionPlatformProjectConfiguration {
 	for _, c := range t.ExecutionPlatformConfigs {
-		if c.Type == platformType {
+		if c.Type == platformType && t.inAWSEnvironment(c.Configuration) {
 			return c.Configuration
 		}
 	}
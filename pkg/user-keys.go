@@ -0,0 +1,325 @@
+package gltr
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// DefaultKeySource is where the ssh keys of users added by username are
+// looked up
+const DefaultKeySource = "https://github.com"
+
+// Keys returns the ssh public keys of the user
+func (u User) Keys() []string {
+	var keys []string
+	for _, k := range append([]string{u.SshKey}, u.SshKeys...) {
+		if k = strings.TrimSpace(k); k != "" {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// FindUser returns the index of the project user with the name or email, or
+// -1 if there is none
+func (t Task) FindUser(nameOrEmail string) int {
+	for i, u := range t.Users {
+		if u.Name == nameOrEmail || (u.Email != "" && u.Email == nameOrEmail) {
+			return i
+		}
+	}
+	return -1
+}
+
+// SharedAccount is the unix account of the workspace image; users share it
+// unless the project has user accounts
+const SharedAccount = "gltr"
+
+// the git identity of the user connecting with a key is passed in these
+// variables, which the sshd of the image accepts from authorized_keys
+var identityEnvironment = []string{
+	"GIT_AUTHOR_NAME", "GIT_AUTHOR_EMAIL", "GIT_COMMITTER_NAME", "GIT_COMMITTER_EMAIL",
+}
+
+var accountInvalidChars = regexp.MustCompile(`[^a-z0-9_-]+`)
+
+// AuthorizedKeys returns the authorized_keys of the shared account: the keys
+// of all project users and of the user running the task, each setting the
+// git identity of its user. With user accounts only the keys of the user
+// running the task are in the shared account, which gltr itself logs in to.
+func (t Task) AuthorizedKeys(runner User) string {
+	users := append(append([]User{}, t.Users...), runner)
+	if t.UserAccounts {
+		users = []User{runner}
+		if i := t.FindUser(runner.Email); runner.Email != "" && i >= 0 {
+			users = []User{t.Users[i], runner}
+		}
+	}
+	var entries []string
+	seen := map[string]bool{}
+	for _, u := range users {
+		for _, k := range u.Keys() {
+			if !seen[k] {
+				seen[k] = true
+				entries = append(entries, authorizedKeyEntry(u, k))
+			}
+		}
+	}
+	if len(entries) == 0 {
+		return ""
+	}
+	return strings.Join(entries, "\n") + "\n"
+}
+
+// authorizedKeyEntry returns the authorized_keys line for the key of the
+// user, with options which set the git identity of the user
+func authorizedKeyEntry(u User, key string) string {
+	values := map[string]string{
+		"GIT_AUTHOR_NAME":     u.Name,
+		"GIT_AUTHOR_EMAIL":    u.Email,
+		"GIT_COMMITTER_NAME":  u.Name,
+		"GIT_COMMITTER_EMAIL": u.Email,
+	}
+	var options []string
+	for _, name := range identityEnvironment {
+		if value := authorizedKeyOptionValue(values[name]); value != "" {
+			options = append(options, fmt.Sprintf(`environment="%v=%v"`, name, value))
+		}
+	}
+	if len(options) == 0 {
+		return key
+	}
+	return strings.Join(options, ",") + " " + key
+}
+
+// authorizedKeyOptionValue makes the value safe to use in a quoted option:
+// sshd does not unescape option values, so quotes, backslashes and control
+// characters are dropped
+func authorizedKeyOptionValue(value string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '"' || r == '\\' || r < ' ' || r == 0x7f {
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(value))
+}
+
+// Accounts returns the unix accounts of the project users in the order of
+// the users: the account of the user or one derived from their name, made
+// unique with a number
+func (t Task) Accounts() []string {
+	var accounts []string
+	taken := map[string]bool{SharedAccount: true, "root": true}
+	for i, u := range t.Users {
+		account := u.Account
+		if account == "" {
+			account = strings.Trim(accountInvalidChars.ReplaceAllString(strings.ToLower(u.Name), "-"), "-_")
+		}
+		if account == "" || account[0] < 'a' || account[0] > 'z' {
+			account = fmt.Sprintf("user%v", i+1)
+		}
+		if len(account) > 28 {
+			account = account[:28]
+		}
+		unique := account
+		for n := 2; taken[unique]; n++ {
+			unique = fmt.Sprintf("%v%v", account, n)
+		}
+		taken[unique] = true
+		accounts = append(accounts, unique)
+	}
+	return accounts
+}
+
+// SSHUser returns the account the user logs in to: their own account if the
+// project has user accounts, else the shared account
+func (t Task) SSHUser(u User) string {
+	if !t.UserAccounts {
+		return SharedAccount
+	}
+	i := -1
+	if u.Email != "" {
+		i = t.FindUser(u.Email)
+	}
+	if i < 0 {
+		i = t.FindUser(u.Name)
+	}
+	if i < 0 {
+		return SharedAccount
+	}
+	return t.Accounts()[i]
+}
+
+// Ec2SSHLogin returns the login of the EC2 task container: the ssh_login of
+// the project over the default_ssh_login of the user config, falling back to
+// the account of SSHUser on port 22
+func (t Task) Ec2SSHLogin(config Config) SSHLogin {
+	var login SSHLogin
+	if p, ok := config.GetExecutionPlatformConfig(Ec2).(Ec2Config); ok {
+		login = p.DefaultSSHLogin
+	}
+	if pc, ok := t.GetExecutionPlatformProjectConfig(Ec2).(Ec2ProjectConfig); ok {
+		if pc.SSHLogin.User != "" {
+			login.User = pc.SSHLogin.User
+		}
+		if pc.SSHLogin.Port != 0 {
+			login.Port = pc.SSHLogin.Port
+		}
+	}
+	if login.User == "" {
+		login.User = t.SSHUser(config.User)
+	}
+	if login.Port == 0 {
+		login.Port = 22
+	}
+	return login
+}
+
+// validate checks that the port can carry the container sshd; 8888 is
+// published for jupyter
+func (l SSHLogin) validate() error {
+	if l.Port < 1 || l.Port > 65535 {
+		return fmt.Errorf("ssh login port %v is out of range", l.Port)
+	}
+	if l.Port == 8888 {
+		return errors.New("ssh login port 8888 is taken by jupyter")
+	}
+	return nil
+}
+
+// UserAccountsSpec returns the accounts the workspace creates for the project
+// users, one line per key: the account, name and email of the user and the
+// authorized_keys entry separated by tabs. It is empty unless the project
+// has user accounts.
+func (t Task) UserAccountsSpec() string {
+	if !t.UserAccounts {
+		return ""
+	}
+	var lines []string
+	accounts := t.Accounts()
+	for i, u := range t.Users {
+		for _, k := range u.Keys() {
+			lines = append(lines, strings.Join([]string{
+				accounts[i],
+				authorizedKeyOptionValue(u.Name),
+				authorizedKeyOptionValue(u.Email),
+				authorizedKeyEntry(u, k),
+			}, "\t"))
+		}
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// ParseAuthorizedKeys returns the keys of data in authorized_keys format,
+// one per line; comments and empty lines are skipped
+func ParseAuthorizedKeys(data string) ([]string, error) {
+	var keys []string
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if _, _, _, _, err := ssh.ParseAuthorizedKey([]byte(line)); err != nil {
+			return nil, fmt.Errorf("invalid ssh public key %q: %w", line, err)
+		}
+		keys = append(keys, line)
+	}
+	return keys, nil
+}
+
+// KeyLookup finds the ssh public keys of a user by username
+type KeyLookup interface {
+	LookupKeys(username string) ([]string, error)
+	// Location returns where the keys of the user are looked up
+	Location(username string) string
+}
+
+// NewKeyLookup returns the lookup for the source: a base URL serving
+// <username>.keys like GitHub and GitLab do, or a local directory holding
+// such files, eg for working offline
+func NewKeyLookup(source string) KeyLookup {
+	if strings.HasPrefix(source, "https://") || strings.HasPrefix(source, "http://") {
+		return &HTTPKeyLookup{
+			BaseURL: strings.TrimSuffix(source, "/"),
+			Client:  &http.Client{Timeout: 10 * time.Second},
+		}
+	}
+	return &DirKeyLookup{Dir: strings.TrimPrefix(source, "file://")}
+}
+
+// HTTPKeyLookup fetches <BaseURL>/<username>.keys
+type HTTPKeyLookup struct {
+	BaseURL string
+	Client  *http.Client
+}
+
+// Location returns the URL of the keys of the user
+func (l *HTTPKeyLookup) Location(username string) string {
+	return fmt.Sprintf("%v/%v.keys", l.BaseURL, username)
+}
+
+// LookupKeys returns the ssh public keys of the user
+func (l *HTTPKeyLookup) LookupKeys(username string) ([]string, error) {
+	url := l.Location(username)
+	resp, err := l.Client.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("error looking up keys of %v: %w", username, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("no user %v at %v", username, l.BaseURL)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error looking up keys of %v: %v returned %v", username, url, resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("error reading keys of %v: %w", username, err)
+	}
+	return lookedUpKeys(username, string(body))
+}
+
+// DirKeyLookup reads <Dir>/<username>.keys
+type DirKeyLookup struct {
+	Dir string
+}
+
+// Location returns the file with the keys of the user
+func (l *DirKeyLookup) Location(username string) string {
+	return filepath.Join(l.Dir, username+".keys")
+}
+
+// LookupKeys returns the ssh public keys of the user
+func (l *DirKeyLookup) LookupKeys(username string) ([]string, error) {
+	data, err := os.ReadFile(l.Location(username))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("no user %v in %v", username, l.Dir)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return lookedUpKeys(username, string(data))
+}
+
+func lookedUpKeys(username, data string) ([]string, error) {
+	keys, err := ParseAuthorizedKeys(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("user %v has no ssh public keys", username)
+	}
+	return keys, nil
+}
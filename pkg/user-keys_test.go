@@ -0,0 +1,230 @@
+package gltr
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// newTestPublicKey returns a throwaway ssh public key in authorized keys
+// format, without the trailing newline
+func newTestPublicKey(t *testing.T, comment string) string {
+	t.Helper()
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sshPublicKey, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(sshPublicKey))) + " " + comment
+}
+
+func TestDirKeyLookup(t *testing.T) {
+	dir := t.TempDir()
+	first, second := newTestPublicKey(t, "first"), newTestPublicKey(t, "second")
+	files := map[string]string{
+		"alice.keys": "# keys of alice\n" + first + "\n\n" + second + "\n",
+		"empty.keys": "# no keys\n",
+		"bad.keys":   "not a key\n",
+	}
+	for name, contents := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		username string
+		want     []string
+		wantErr  string
+	}{
+		{"alice", []string{first, second}, ""},
+		{"bob", nil, "no user bob"},
+		{"empty", nil, "has no ssh public keys"},
+		{"bad", nil, "invalid ssh public key"},
+	}
+	for _, source := range []string{dir, "file://" + dir} {
+		lookup := NewKeyLookup(source)
+		if _, ok := lookup.(*DirKeyLookup); !ok {
+			t.Fatalf("NewKeyLookup(%v) = %T", source, lookup)
+		}
+		if location := lookup.Location("alice"); location != filepath.Join(dir, "alice.keys") {
+			t.Errorf("Location(alice) = %v", location)
+		}
+		for _, tt := range tests {
+			keys, err := lookup.LookupKeys(tt.username)
+			checkLookup(t, tt.username, keys, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestHTTPKeyLookup(t *testing.T) {
+	first, second := newTestPublicKey(t, "first"), newTestPublicKey(t, "second")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/alice.keys":
+			w.Write([]byte(first + "\n" + second + "\n"))
+		case "/empty.keys":
+		case "/broken.keys":
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	lookup := NewKeyLookup(server.URL + "/")
+	if _, ok := lookup.(*HTTPKeyLookup); !ok {
+		t.Fatalf("NewKeyLookup(%v) = %T", server.URL, lookup)
+	}
+	if location := lookup.Location("alice"); location != server.URL+"/alice.keys" {
+		t.Errorf("Location(alice) = %v", location)
+	}
+
+	tests := []struct {
+		username string
+		want     []string
+		wantErr  string
+	}{
+		{"alice", []string{first, second}, ""},
+		{"bob", nil, "no user bob"},
+		{"empty", nil, "has no ssh public keys"},
+		{"broken", nil, "503"},
+	}
+	for _, tt := range tests {
+		keys, err := lookup.LookupKeys(tt.username)
+		checkLookup(t, tt.username, keys, err, tt.want, tt.wantErr)
+	}
+}
+
+func checkLookup(t *testing.T, username string, keys []string, err error, want []string, wantErr string) {
+	t.Helper()
+	if wantErr != "" {
+		if err == nil || !strings.Contains(err.Error(), wantErr) {
+			t.Errorf("LookupKeys(%v) = %v, %v, want error containing %q", username, keys, err, wantErr)
+		}
+		return
+	}
+	if err != nil {
+		t.Errorf("LookupKeys(%v): %v", username, err)
+		return
+	}
+	if !reflect.DeepEqual(keys, want) {
+		t.Errorf("LookupKeys(%v) = %v, want %v", username, keys, want)
+	}
+}
+
+func TestAuthorizedKeys(t *testing.T) {
+	aliceKey, aliceSecondKey := newTestPublicKey(t, "alice"), newTestPublicKey(t, "alice-laptop")
+	bobKey, runnerKey := newTestPublicKey(t, "bob"), newTestPublicKey(t, "runner")
+	alice := User{Name: "Alice", Email: "alice@example.com", SshKey: aliceKey, SshKeys: []string{aliceSecondKey}}
+	bob := User{Name: "Bob", Email: "bob@example.com", SshKeys: []string{bobKey}}
+	runner := User{Name: "Runner", Email: "runner@example.com", SshKey: runnerKey}
+
+	t.Run("shared account", func(t *testing.T) {
+		task := Task{Users: []User{alice, bob}}
+		lines := strings.Split(strings.TrimSuffix(task.AuthorizedKeys(runner), "\n"), "\n")
+		want := []struct{ key, email string }{
+			{aliceKey, alice.Email},
+			{aliceSecondKey, alice.Email},
+			{bobKey, bob.Email},
+			{runnerKey, runner.Email},
+		}
+		if len(lines) != len(want) {
+			t.Fatalf("AuthorizedKeys() has %v entries, want %v:\n%v", len(lines), len(want), strings.Join(lines, "\n"))
+		}
+		for i, w := range want {
+			if !strings.HasSuffix(lines[i], " "+w.key) {
+				t.Errorf("entry %v is %q, want key %q", i, lines[i], w.key)
+			}
+			if !strings.Contains(lines[i], `environment="GIT_AUTHOR_EMAIL=`+w.email+`"`) {
+				t.Errorf("entry %v does not set the git identity %v: %q", i, w.email, lines[i])
+			}
+			if _, _, _, _, err := ssh.ParseAuthorizedKey([]byte(lines[i])); err != nil {
+				t.Errorf("entry %v is invalid: %v", i, err)
+			}
+		}
+	})
+
+	t.Run("runner is a project user", func(t *testing.T) {
+		task := Task{Users: []User{alice, bob}}
+		keys := task.AuthorizedKeys(alice)
+		if n := strings.Count(keys, aliceKey); n != 1 {
+			t.Errorf("key of alice is in AuthorizedKeys() %v times:\n%v", n, keys)
+		}
+	})
+
+	t.Run("user accounts", func(t *testing.T) {
+		task := Task{Users: []User{alice, bob}, UserAccounts: true}
+		keys := task.AuthorizedKeys(runner)
+		if strings.Contains(keys, aliceKey) || strings.Contains(keys, bobKey) || !strings.Contains(keys, runnerKey) {
+			t.Errorf("AuthorizedKeys() with user accounts:\n%v", keys)
+		}
+	})
+
+	t.Run("no keys", func(t *testing.T) {
+		if keys := (Task{Users: []User{{Name: "Carol"}}}).AuthorizedKeys(User{}); keys != "" {
+			t.Errorf("AuthorizedKeys() without keys = %q", keys)
+		}
+	})
+}
+
+func TestEc2SSHLogin(t *testing.T) {
+	alice := User{Name: "Alice", Email: "alice@example.com"}
+	withDefault := func(login SSHLogin) Config {
+		return Config{User: alice, ExecutionPlatforms: []ExecutionPlatform{
+			{Type: Ec2, Configuration: Ec2Config{DefaultSSHLogin: login}},
+		}}
+	}
+	withProject := func(gt Task, login SSHLogin) Task {
+		gt.ExecutionPlatformConfigs = []ExecutionPlatformProjectConfig{
+			{Type: Ec2, Configuration: Ec2ProjectConfig{SSHLogin: login}},
+		}
+		return gt
+	}
+	accounts := Task{Users: []User{alice}, UserAccounts: true}
+
+	tests := []struct {
+		name   string
+		gt     Task
+		config Config
+		want   SSHLogin
+	}{
+		{"defaults", Task{}, Config{User: alice}, SSHLogin{User: SharedAccount, Port: 22}},
+		{"user accounts", accounts, Config{User: alice}, SSHLogin{User: "alice", Port: 22}},
+		{"user default", Task{}, withDefault(SSHLogin{Port: 2200}), SSHLogin{User: SharedAccount, Port: 2200}},
+		{
+			"project over user default",
+			withProject(Task{}, SSHLogin{User: "dev"}),
+			withDefault(SSHLogin{User: "ops", Port: 2200}),
+			SSHLogin{User: "dev", Port: 2200},
+		},
+		{
+			"project over user accounts",
+			withProject(accounts, SSHLogin{User: "dev", Port: 443}),
+			Config{User: alice},
+			SSHLogin{User: "dev", Port: 443},
+		},
+	}
+	for _, tt := range tests {
+		if got := tt.gt.Ec2SSHLogin(tt.config); got != tt.want {
+			t.Errorf("%v: Ec2SSHLogin() = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+
+	for _, port := range []int{-1, 8888, 65536} {
+		if err := (SSHLogin{Port: port}).validate(); err == nil {
+			t.Errorf("port %v is valid", port)
+		}
+	}
+}
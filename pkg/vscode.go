@@ -0,0 +1,37 @@
+package gltr
+
+import (
+	"os/exec"
+	"strings"
+)
+
+// LocalVSCodeCommit returns the commit of the locally installed VS Code, or
+// an empty string if VS Code is not installed
+func LocalVSCodeCommit() string {
+	out, err := exec.Command("code", "--version").Output()
+	if err != nil {
+		return ""
+	}
+	// code --version prints the version, the commit and the architecture
+	lines := strings.Split(string(out), "\n")
+	if len(lines) < 2 {
+		return ""
+	}
+	return strings.TrimSpace(lines[1])
+}
+
+// vscodeEnvironment returns the values passed to the vscode-server service
+// in the container. The service installs the VS Code server for the local
+// commit, so that Remote-SSH finds it on the first connection, and installs
+// the project extensions into it. Nothing is installed if the project has no
+// extensions or VS Code is not installed locally.
+func vscodeEnvironment(gt Task) (extensions string, commit string) {
+	if len(gt.Customizations.VSCode.Extensions) == 0 {
+		return "", ""
+	}
+	commit = LocalVSCodeCommit()
+	if commit == "" {
+		return "", ""
+	}
+	return strings.Join(gt.Customizations.VSCode.Extensions, ","), commit
+}
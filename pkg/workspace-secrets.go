@@ -0,0 +1,133 @@
+package gltr
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// WorkspaceSecretsEnvFile is written in the home directory of the workspace
+// user with the secrets which are environment variables; login shells
+// source it
+const WorkspaceSecretsEnvFile = ".gltr/secrets.env"
+
+var envNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// FileMode returns the permissions of the secret file
+func (s WorkspaceSecret) FileMode() (os.FileMode, error) {
+	if s.Mode == "" {
+		return 0600, nil
+	}
+	mode, err := strconv.ParseUint(s.Mode, 8, 32)
+	if err != nil || mode > 0777 {
+		return 0, fmt.Errorf("invalid mode %q for secret %v - expected octal permissions such as 0600", s.Mode, s.Name)
+	}
+	return os.FileMode(mode), nil
+}
+
+// ValidateSecrets checks the secrets declared for the workspace; available
+// are the names of the secrets in gltr-secrets.yaml
+func (t Task) ValidateSecrets(available []string) error {
+	defined := map[string]bool{}
+	for _, name := range available {
+		defined[name] = true
+	}
+	var missing []string
+	for _, s := range t.Secrets {
+		if s.Env == "" && s.Path == "" {
+			return fmt.Errorf("secret %v has neither env nor path", s.Name)
+		}
+		if s.Env != "" && !envNamePattern.MatchString(s.Env) {
+			return fmt.Errorf("secret %v: %q is not a valid environment variable name", s.Name, s.Env)
+		}
+		if _, err := s.FileMode(); err != nil {
+			return err
+		}
+		if !defined[s.Name] {
+			missing = append(missing, s.Name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("secrets not defined in gltr-secrets.yaml: %v", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// InstallWorkspaceSecrets writes the secrets declared for the workspace:
+// files are written to their path and environment variables to
+// WorkspaceSecretsEnvFile in the home directory. dir is the repository
+// clone, which relative paths refer to.
+func InstallWorkspaceSecrets(
+	t Task,
+	dir string,
+	homeDir string,
+	get func(name string) ([]byte, bool),
+) error {
+	var env []string
+	for _, s := range t.Secrets {
+		value, ok := get(s.Name)
+		if !ok {
+			return fmt.Errorf("secret %v not defined in gltr-secrets.yaml", s.Name)
+		}
+		if s.Env != "" {
+			env = append(env, fmt.Sprintf("export %v=%v\n", s.Env, shellQuote(string(value))))
+		}
+		if s.Path != "" {
+			if err := writeSecretFile(s, dir, homeDir, value); err != nil {
+				return err
+			}
+		}
+	}
+
+	envFile := filepath.Join(homeDir, WorkspaceSecretsEnvFile)
+	if err := os.MkdirAll(filepath.Dir(envFile), 0700); err != nil {
+		return err
+	}
+	return writeFileAtomic(envFile, []byte(strings.Join(env, "")), 0600)
+}
+
+// writeSecretFile writes the secret to its path with the mode of the secret
+func writeSecretFile(s WorkspaceSecret, dir, homeDir string, value []byte) error {
+	mode, err := s.FileMode()
+	if err != nil {
+		return err
+	}
+	path := s.Path
+	if strings.HasPrefix(path, "~/") {
+		path = filepath.Join(homeDir, path[2:])
+	} else if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("error creating directory for secret %v: %w", s.Name, err)
+	}
+	if err := writeFileAtomic(path, value, mode); err != nil {
+		return fmt.Errorf("error writing secret %v: %w", s.Name, err)
+	}
+	return nil
+}
+
+// writeFileAtomic writes the file under a temporary name and renames it, so
+// that the file never has other permissions or partial contents
+func writeFileAtomic(path string, data []byte, mode os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}